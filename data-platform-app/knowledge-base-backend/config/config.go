@@ -4,6 +4,7 @@ import (
     "log"
     "os"
     "path/filepath"
+    "strconv"
 
     "github.com/joho/godotenv"
 )
@@ -20,7 +21,24 @@ type Config struct {
     CouchbaseBucket    string
     CouchbaseScope     string
     CouchbaseCollection string
+    CouchbaseJobCollection string
+    CouchbaseBundleCollection string
+    CouchbaseChunkCollection string
+    CouchbaseQueryCollection string
+    CouchbaseSynonymCollection string
+    CouchbaseIssueCollection string
+    CouchbaseVersionCollection string
+    CouchbaseSearchIndex string // empty disables full-text search
+    SearchBackend      string // couchbase or bleve
+    SearchIndexPath    string // on-disk index of the bleve backend
     WorkerChannelSize  int
+    WorkerCount        int
+    ParseBacklogLimit  int
+    UploadRetryAfter   int // seconds
+    BundleMaxEntries   int
+    BundleMaxSizeMB    int
+    BundleMaxDepth     int
+    BundleMaxNestedMB  int
 }
 
 func LoadConfig() *Config {
@@ -51,7 +69,24 @@ func LoadConfig() *Config {
         CouchbaseBucket:    getEnv("COUCHBASE_BUCKET", "knowledge_based"),
         CouchbaseScope:     getEnv("COUCHBASE_SCOPE", "master_document"),
         CouchbaseCollection: getEnv("COUCHBASE_COLLECTION", "document"),
+        CouchbaseJobCollection: getEnv("COUCHBASE_JOB_COLLECTION", "parse_job"),
+        CouchbaseBundleCollection: getEnv("COUCHBASE_BUNDLE_COLLECTION", "bundle"),
+        CouchbaseChunkCollection: getEnv("COUCHBASE_CHUNK_COLLECTION", "chunk"),
+        CouchbaseQueryCollection: getEnv("COUCHBASE_QUERY_COLLECTION", "search_query"),
+        CouchbaseSynonymCollection: getEnv("COUCHBASE_SYNONYM_COLLECTION", "synonym"),
+        CouchbaseIssueCollection: getEnv("COUCHBASE_ISSUE_COLLECTION", "known_issue"),
+        CouchbaseVersionCollection: getEnv("COUCHBASE_VERSION_COLLECTION", "document_version"),
+        CouchbaseSearchIndex: getEnv("COUCHBASE_SEARCH_INDEX", "document_fts"),
+        SearchBackend:      getEnv("SEARCH_BACKEND", "couchbase"),
+        SearchIndexPath:    getEnv("SEARCH_INDEX_PATH", "data/search.bleve"),
         WorkerChannelSize:  10,
+        WorkerCount:        getEnvInt("WORKER_COUNT", 3),
+        ParseBacklogLimit:  getEnvInt("PARSE_BACKLOG_LIMIT", 500),
+        UploadRetryAfter:   getEnvInt("UPLOAD_RETRY_AFTER", 30),
+        BundleMaxEntries:   getEnvInt("BUNDLE_MAX_ENTRIES", 1000),
+        BundleMaxSizeMB:    getEnvInt("BUNDLE_MAX_SIZE_MB", 1024),
+        BundleMaxDepth:     getEnvInt("BUNDLE_MAX_DEPTH", 2),
+        BundleMaxNestedMB:  getEnvInt("BUNDLE_MAX_NESTED_MB", 64),
     }
 }
 
@@ -61,3 +96,13 @@ func getEnv(key, defaultValue string) string {
     }
     return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+    if value := os.Getenv(key); value != "" {
+        if n, err := strconv.Atoi(value); err == nil {
+            return n
+        }
+        log.Printf("Warning: invalid %s=%q, using %d", key, value, defaultValue)
+    }
+    return defaultValue
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "knowledge-base-backend/models"
+    "knowledge-base-backend/services"
+    "knowledge-base-backend/worker"
+)
+
+type AdminHandler struct {
+    couchbaseService *services.CouchbaseService
+    parserWorker     *worker.ParserWorker
+}
+
+func NewAdminHandler(
+    couchbaseService *services.CouchbaseService,
+    parserWorker *worker.ParserWorker,
+) *AdminHandler {
+    return &AdminHandler{
+        couchbaseService: couchbaseService,
+        parserWorker:     parserWorker,
+    }
+}
+
+// ListParseFailures returns dead-lettered documents and reparses with their
+// last error and attempt count.
+func (h *AdminHandler) ListParseFailures(c *gin.Context) {
+    failures, err := h.couchbaseService.ListParseFailures()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list parse failures", "details": err.Error()})
+        return
+    }
+
+    for _, failure := range failures {
+        failure.Document.ParsedText = ""
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "failures": failures,
+        "total":    len(failures),
+    })
+}
+
+// RetryParseFailure puts a dead-lettered document or reparse back on the
+// parse queue.
+func (h *AdminHandler) RetryParseFailure(c *gin.Context) {
+    docID := c.Param("id")
+
+    doc, err := h.couchbaseService.GetDocument(docID)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+        return
+    }
+
+    job, err := h.couchbaseService.GetParseJob(docID)
+    deadLettered := err == nil && job.Status == "failed"
+    if !deadLettered && doc.Status != "failed" && doc.Status != "error" {
+        c.JSON(http.StatusConflict, gin.H{"error": "Document has not failed parsing", "status": doc.Status})
+        return
+    }
+
+    if err := h.parserWorker.RetryJob(doc); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry document", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "Document requeued for parsing",
+        "document": doc,
+    })
+}
+
+// BulkReparse starts a throttled reparse of every document matching the
+// given path prefix, status and parser version filters.
+func (h *AdminHandler) BulkReparse(c *gin.Context) {
+    var req models.ReparseRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+        return
+    }
+
+    run, err := h.parserWorker.BulkReparse(req)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start reparse", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusAccepted, run)
+}
+
+// GetReparseRun reports how far a bulk reparse has got.
+func (h *AdminHandler) GetReparseRun(c *gin.Context) {
+    run, ok := h.parserWorker.ReparseRun(c.Param("id"))
+    if !ok {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Reparse run not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "mime/multipart"
+    "net/http"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "knowledge-base-backend/models"
+    "knowledge-base-backend/services"
+)
+
+// uploadBundle stores an uploaded archive and expands each supported entry
+// into its own document under the requested product/sub-product/category.
+// The archive is walked twice: once to enforce the bundle limits without
+// storing anything, then again to upload the entries.
+func (h *UploadHandler) uploadBundle(c *gin.Context, req *models.UploadRequest, file multipart.File, header *multipart.FileHeader) {
+    var supported int
+    var skipped []models.BundleSkippedEntry
+    hashes := make(map[string]string)
+    err := services.WalkArchive(file, header.Size, header.Filename, h.bundleLimits, func(entryPath string, r io.Reader) error {
+        if !services.IsSupportedFile(entryPath) {
+            skipped = append(skipped, models.BundleSkippedEntry{Path: entryPath, Reason: "File type not supported"})
+            return nil
+        }
+        supported++
+        hash, err := services.ContentHash(r)
+        hashes[entryPath] = hash
+        return err
+    })
+
+    var limitErr *services.ArchiveLimitError
+    if errors.As(err, &limitErr) {
+        c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Archive exceeds bundle limits", "details": limitErr.Error()})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archive", "details": err.Error()})
+        return
+    }
+    if supported == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Archive contains no supported files", "skipped": skipped})
+        return
+    }
+
+    // Every entry becomes a parse job, so the whole archive must fit in the
+    // backlog that single uploads are held to
+    if now, ever := h.parserWorker.Fits(supported); !ever {
+        c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+            "error":   "Archive has more files than the parse queue holds",
+            "entries": supported,
+        })
+        return
+    } else if !now {
+        c.Header("Retry-After", strconv.Itoa(h.retryAfter))
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error":   "Parse queue is full, please retry later",
+            "backlog": h.parserWorker.Backlog(),
+            "entries": supported,
+        })
+        return
+    }
+
+    safeName := sanitizeFilename(header.Filename)
+    archiveExt := services.ArchiveExt(safeName)
+    gcsDir := fmt.Sprintf("knowledge_based/%s/%s/%s", req.Product, req.SubProduct, req.Category)
+
+    // An archive uploaded again under the same name is kept next to the
+    // earlier ones, and its entries become new versions of theirs
+    previous, err := h.couchbaseService.FindBundleByName(req.Product, req.SubProduct, req.Category, safeName)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up existing bundle", "details": err.Error()})
+        return
+    }
+    bundleVersion := 1
+    if previous != nil {
+        bundleVersion = max(previous.Version, 1) + 1
+    }
+
+    now := time.Now()
+    bundle := &models.Bundle{
+        ID:           uuid.New().String(),
+        FileName:     safeName,
+        OriginalName: header.Filename,
+        FileType:     archiveExt,
+        FileSize:     header.Size,
+        GCSPath:      services.VersionedPath(gcsDir, safeName, bundleVersion),
+        Version:      bundleVersion,
+        Product:      req.Product,
+        SubProduct:   req.SubProduct,
+        Category:     req.Category,
+        DocumentIDs:  []string{},
+        Skipped:      skipped,
+        Status:       "expanded",
+        UploadedBy:   c.GetString("user_id"),
+        UploadedAt:   now,
+        UpdatedAt:    now,
+    }
+
+    ctx := c.Request.Context()
+    if _, err := h.gcsService.UploadFile(ctx, io.NewSectionReader(file, 0, header.Size), safeName, bundle.GCSPath); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file", "details": err.Error()})
+        return
+    }
+
+    // Entries live in a folder named after the archive
+    entryDir := gcsDir + "/" + safeName[:len(safeName)-len(archiveExt)]
+
+    var documents []*models.Document
+    var entries []bundleEntry
+    err = services.WalkArchive(file, header.Size, header.Filename, h.bundleLimits, func(entryPath string, r io.Reader) error {
+        if !services.IsSupportedFile(entryPath) {
+            return nil
+        }
+        entry, err := h.saveBundleEntry(ctx, bundle, entryDir, entryPath, hashes[entryPath], req.OnDuplicate, r)
+        if err != nil {
+            return fmt.Errorf("%s: %v", entryPath, err)
+        }
+        if entry.doc == nil {
+            bundle.Duplicates = append(bundle.Duplicates, models.BundleDuplicate{Path: entryPath, DocumentID: entry.original.ID})
+            return nil
+        }
+        documents = append(documents, entry.doc)
+        bundle.DocumentIDs = append(bundle.DocumentIDs, entry.doc.ID)
+        entries = append(entries, entry)
+        return nil
+    })
+    if err != nil {
+        bundle.Status = "partial"
+        bundle.Error = err.Error()
+    }
+
+    bundle.UpdatedAt = time.Now()
+    if saveErr := h.couchbaseService.SaveBundle(bundle); saveErr != nil {
+        log.Printf("Failed to save bundle %s: %v", bundle.ID, saveErr)
+    }
+
+    for _, entry := range entries {
+        var err error
+        switch {
+        case entry.unchanged:
+            continue
+        case entry.original != nil:
+            err = h.parserWorker.AddDuplicate(entry.doc, entry.original)
+        case entry.version:
+            err = h.parserWorker.AddVersion(entry.doc)
+        default:
+            err = h.parserWorker.AddJob(entry.doc)
+        }
+        if err != nil {
+            log.Printf("Failed to enqueue parse job for %s: %v", entry.doc.ID, err)
+        }
+    }
+
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expand bundle", "details": err.Error(), "bundle": bundle})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":   "Bundle uploaded successfully",
+        "bundle":    bundle,
+        "documents": documents,
+    })
+}
+
+// bundleEntry is an archive entry saved as a document of a bundle. doc is
+// nil for content already uploaded when on_duplicate is return.
+type bundleEntry struct {
+    doc       *models.Document
+    original  *models.Document // the document first uploaded with this content
+    version   bool             // a new version of the entry of an earlier upload
+    unchanged bool             // the same content as the entry of an earlier upload
+}
+
+// saveBundleEntry uploads one archive entry and records it as a document of
+// the bundle: a new version of the document of the same entry in an earlier
+// upload of the archive, or else a new document. An entry whose content,
+// hashed by the first walk, is unchanged is only moved to the bundle. New
+// content that was uploaded before is handled as onDuplicate says, as for
+// single uploads.
+func (h *UploadHandler) saveBundleEntry(ctx context.Context, bundle *models.Bundle, entryDir, entryPath, entryHash, onDuplicate string, r io.Reader) (bundleEntry, error) {
+    segments := strings.Split(entryPath, "/")
+    for i, segment := range segments {
+        segments[i] = sanitizeFilename(segment)
+        if segments[i] == "" {
+            segments[i] = "_"
+        }
+    }
+    safeName := segments[len(segments)-1]
+    dir := strings.Join(append([]string{entryDir}, segments[:len(segments)-1]...), "/")
+
+    current, err := h.couchbaseService.FindBundleEntry(bundle.Product, bundle.SubProduct, bundle.Category, bundle.FileName, entryPath)
+    if err != nil {
+        return bundleEntry{}, err
+    }
+    now := time.Now()
+    if current != nil && current.ContentHash == entryHash {
+        // Updated as stored, as another upload may have changed it since
+        doc, err := h.couchbaseService.UpdateDocument(current.ID, func(doc *models.Document) {
+            doc.BundleID = bundle.ID
+            doc.UpdatedAt = now
+        })
+        if err != nil {
+            return bundleEntry{}, err
+        }
+        return bundleEntry{doc: doc, unchanged: true}, nil
+    }
+
+    versionNumber := 1
+    if current != nil {
+        versionNumber, err = h.couchbaseService.ClaimVersion(current)
+        if err != nil {
+            return bundleEntry{}, err
+        }
+    }
+    gcsPath := services.VersionedPath(dir, safeName, versionNumber)
+
+    counter := &countingReader{r: r}
+    contentHash, err := h.gcsService.UploadFile(ctx, counter, safeName, gcsPath)
+    if err != nil {
+        return bundleEntry{}, err
+    }
+
+    version := models.DocumentVersion{
+        Version:      versionNumber,
+        GCSPath:      gcsPath,
+        FileSize:     counter.n,
+        ContentHash:  contentHash,
+        OriginalName: path.Base(entryPath),
+        UploadedBy:   bundle.UploadedBy,
+        UploadedAt:   now,
+    }
+
+    if current != nil {
+        doc, err := h.couchbaseService.UpdateDocument(current.ID, func(doc *models.Document) {
+            doc.BundleID = bundle.ID
+            doc.UpdatedAt = now
+            services.AddDocumentVersion(doc, version)
+        })
+        if err != nil {
+            return bundleEntry{}, err
+        }
+        return bundleEntry{doc: doc, version: true}, nil
+    }
+
+    original, err := h.couchbaseService.FindDocumentByHash(contentHash)
+    if err != nil {
+        return bundleEntry{}, err
+    }
+    if original != nil {
+        // The original's file serves both; drop the copy just stored
+        if err := h.gcsService.DeleteFile(ctx, gcsPath); err != nil {
+            log.Printf("Failed to delete duplicate bundle entry %s: %v", gcsPath, err)
+        }
+        if onDuplicate == onDuplicateReturn {
+            return bundleEntry{original: original}, nil
+        }
+        gcsPath = original.GCSPath
+        version.GCSPath = original.GCSPath
+    }
+
+    doc := &models.Document{
+        ID:           uuid.New().String(),
+        FileName:     safeName,
+        OriginalName: version.OriginalName,
+        FileType:     path.Ext(entryPath),
+        FileSize:     counter.n,
+        GCSPath:      gcsPath,
+        ContentHash:  contentHash,
+        Version:      versionNumber,
+        Versions:     []models.DocumentVersion{version},
+        Product:      bundle.Product,
+        SubProduct:   bundle.SubProduct,
+        Category:     bundle.Category,
+        Status:       "uploaded",
+        BundleID:     bundle.ID,
+        BundlePath:   entryPath,
+        UploadedBy:   bundle.UploadedBy,
+        UploadedAt:   now,
+        UpdatedAt:    now,
+    }
+
+    if original != nil {
+        doc.DuplicateOf = original.ID
+    }
+
+    if err := h.couchbaseService.SaveDocument(doc); err != nil {
+        return bundleEntry{}, err
+    }
+    return bundleEntry{doc: doc, original: original}, nil
+}
+
+type countingReader struct {
+    r io.Reader
+    n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+    n, err := c.r.Read(p)
+    c.n += int64(n)
+    return n, err
+}
+
+// GetBundle returns a bundle together with the documents expanded from it.
+func (h *DocumentsHandler) GetBundle(c *gin.Context) {
+    bundle, err := h.couchbaseService.GetBundle(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Bundle not found"})
+        return
+    }
+
+    documents, err := h.couchbaseService.ListBundleDocuments(bundle.ID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list bundle documents", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "bundle":    bundle,
+        "documents": documents,
+    })
+}
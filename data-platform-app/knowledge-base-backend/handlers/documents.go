@@ -3,31 +3,44 @@ package handlers
 import (
     "context"
     "fmt"
+    "log"
     "net/http"
+    "strconv"
     "strings"
+    "time"
 
     "github.com/gin-gonic/gin"
     "knowledge-base-backend/models"
     "knowledge-base-backend/services"
+    "knowledge-base-backend/worker"
 )
 
 type DocumentsHandler struct {
     gcsService       *services.GCSService
     couchbaseService *services.CouchbaseService
+    parserWorker     *worker.ParserWorker
 }
 
 func NewDocumentsHandler(
     gcsService *services.GCSService,
     couchbaseService *services.CouchbaseService,
+    parserWorker *worker.ParserWorker,
 ) *DocumentsHandler {
     return &DocumentsHandler{
         gcsService:       gcsService,
         couchbaseService: couchbaseService,
+        parserWorker:     parserWorker,
     }
 }
 
 func (h *DocumentsHandler) ListDocuments(c *gin.Context) {
     path := c.Query("path")
+
+    page, err := parsePage(c, services.SortUploadedAt, services.SortFileName, services.SortFileSize)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination", "details": err.Error()})
+        return
+    }
     
     var product, subProduct, category string
     
@@ -68,17 +81,21 @@ func (h *DocumentsHandler) ListDocuments(c *gin.Context) {
         })
     }
 
-    documents, err := h.couchbaseService.ListDocumentsByPath(product, subProduct, category)
+    documents, total, err := h.couchbaseService.ListDocumentsByPath(product, subProduct, category, page)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list documents", "details": err.Error()})
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{
+    response := gin.H{
         "folders":   folderItems,
         "documents": documents,
-        "total":     len(documents),
-    })
+        "total":     total,
+    }
+    if cursor := nextCursor(c, page, total); cursor != "" {
+        response["next_cursor"] = cursor
+    }
+    c.JSON(http.StatusOK, response)
 }
 
 func (h *DocumentsHandler) GetDocument(c *gin.Context) {
@@ -104,9 +121,25 @@ func (h *DocumentsHandler) DownloadDocument(c *gin.Context) {
         return
     }
 
+    // ?version= downloads an earlier version
+    gcsPath := doc.GCSPath
+    if value := c.Query("version"); value != "" {
+        number, err := parseVersion("version", value)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version", "details": err.Error()})
+            return
+        }
+        version := services.FindVersion(doc, number)
+        if version == nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+            return
+        }
+        gcsPath = version.GCSPath
+    }
+
     // Download file from GCS
     ctx := c.Request.Context()
-    fileData, err := h.gcsService.DownloadFile(ctx, doc.GCSPath)
+    fileData, err := h.gcsService.DownloadFile(ctx, gcsPath)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file", "details": err.Error()})
         return
@@ -131,11 +164,27 @@ func (h *DocumentsHandler) DeleteDocument(c *gin.Context) {
         return
     }
 
-    // Delete from GCS
+    // Delete every version from GCS, except files a linked duplicate still uses
     ctx := c.Request.Context()
-    if err := h.gcsService.DeleteFile(ctx, doc.GCSPath); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from GCS", "details": err.Error()})
-        return
+    deleted := make(map[string]bool)
+    for _, version := range services.DocumentVersions(doc) {
+        if deleted[version.GCSPath] {
+            continue
+        }
+        deleted[version.GCSPath] = true
+
+        inUse, err := h.couchbaseService.GCSPathInUse(version.GCSPath, doc.ID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for linked duplicates", "details": err.Error()})
+            return
+        }
+        if inUse {
+            continue
+        }
+        if err := h.gcsService.DeleteFile(ctx, version.GCSPath); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete from GCS", "details": err.Error()})
+            return
+        }
     }
 
     // Delete from Couchbase
@@ -144,26 +193,282 @@ func (h *DocumentsHandler) DeleteDocument(c *gin.Context) {
         return
     }
 
+    if err := h.couchbaseService.DeleteParseJob(docID); err != nil {
+        log.Printf("Failed to delete parse job for %s: %v", docID, err)
+    }
+    if err := h.couchbaseService.DeleteDocumentChunks(docID); err != nil {
+        log.Printf("Failed to delete chunks for %s: %v", docID, err)
+    }
+    if err := h.couchbaseService.DeleteVersionTexts(docID); err != nil {
+        log.Printf("Failed to delete version texts for %s: %v", docID, err)
+    }
+    h.parserWorker.DocumentDeleted(docID)
+
     c.JSON(http.StatusOK, gin.H{
         "message": "Document deleted successfully",
         "id":      docID,
     })
 }
 
+// ListVersions returns a document's versions, oldest first.
+func (h *DocumentsHandler) ListVersions(c *gin.Context) {
+    doc, err := h.couchbaseService.GetDocument(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+        return
+    }
+
+    versions := services.DocumentVersions(doc)
+    c.JSON(http.StatusOK, gin.H{
+        "id":              doc.ID,
+        "current_version": services.CurrentVersion(doc),
+        "versions":        versions,
+        "total":           len(versions),
+    })
+}
+
+// RestoreVersion makes an earlier version current again by adding it as a
+// new version, so the history is kept, and queues it for parsing.
+func (h *DocumentsHandler) RestoreVersion(c *gin.Context) {
+    doc, err := h.couchbaseService.GetDocument(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+        return
+    }
+
+    number, err := parseVersion("version", c.Param("version"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version", "details": err.Error()})
+        return
+    }
+    version := services.FindVersion(doc, number)
+    if version == nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+        return
+    }
+    if number == services.CurrentVersion(doc) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Version is already current"})
+        return
+    }
+
+    restored := *version
+    restored.Version, err = h.couchbaseService.ClaimVersion(doc)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to number the new version", "details": err.Error()})
+        return
+    }
+    restored.RestoredFrom = number
+    restored.UploadedBy = c.GetString("user_id")
+    restored.UploadedAt = time.Now()
+    doc, err = h.couchbaseService.UpdateDocument(doc.ID, func(doc *models.Document) {
+        services.AddDocumentVersion(doc, restored)
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metadata", "details": err.Error()})
+        return
+    }
+    if err := h.parserWorker.AddVersion(doc); err != nil {
+        log.Printf("Failed to enqueue parse job for %s: %v", doc.ID, err)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "Version restored",
+        "document": doc,
+    })
+}
+
+// DiffVersions compares the parsed text of two versions of a document, by
+// default the one before the current version and the current one. from
+// must be an earlier version than to.
+// ?unit=paragraph compares paragraphs instead of lines and ?format=unified
+// returns unified diff text instead of hunks.
+func (h *DocumentsHandler) DiffVersions(c *gin.Context) {
+    doc, err := h.couchbaseService.GetDocument(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+        return
+    }
+
+    to, err := versionParam(c, "to", services.CurrentVersion(doc))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version", "details": err.Error()})
+        return
+    }
+
+    // By default to is compared with the version before it; numbers claimed
+    // by failed uploads leave gaps
+    previous := 0
+    for _, version := range services.DocumentVersions(doc) {
+        if version.Version < to {
+            previous = version.Version
+        }
+    }
+    if previous == 0 && c.Query("from") == "" {
+        details := fmt.Sprintf("version %d has no earlier version to compare with", to)
+        if len(services.DocumentVersions(doc)) == 1 {
+            details = "document has only one version"
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to compare", "details": details})
+        return
+    }
+    from, err := versionParam(c, "from", previous)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version", "details": err.Error()})
+        return
+    }
+    if from >= to {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version", "details": "from must be an earlier version than to"})
+        return
+    }
+    for _, number := range []int{from, to} {
+        if services.FindVersion(doc, number) == nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Version not found", "details": fmt.Sprintf("document has no version %d", number)})
+            return
+        }
+    }
+
+    unit := c.DefaultQuery("unit", services.DiffUnitLine)
+    if !services.IsDiffUnit(unit) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unit", "details": "unit must be line or paragraph"})
+        return
+    }
+    format := c.DefaultQuery("format", "json")
+    if format != "json" && format != "unified" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format", "details": "format must be json or unified"})
+        return
+    }
+
+    ctx := c.Request.Context()
+    fromText, err := h.parserWorker.VersionText(ctx, doc, from)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read version text", "details": err.Error()})
+        return
+    }
+    toText, err := h.parserWorker.VersionText(ctx, doc, to)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read version text", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, services.DiffVersions(doc.FileName, fromText, toText, unit, format == "unified"))
+}
+
+// versionParam reads a version number from the query string, or returns
+// fallback when it is absent.
+func versionParam(c *gin.Context, name string, fallback int) (int, error) {
+    value := c.Query(name)
+    if value == "" {
+        return fallback, nil
+    }
+    return parseVersion(name, value)
+}
+
+// parseVersion reads the version number in parameter name.
+func parseVersion(name, value string) (int, error) {
+    number, err := strconv.Atoi(value)
+    if err != nil || number < 1 {
+        return 0, fmt.Errorf("%s must be a positive version number", name)
+    }
+    return number, nil
+}
+
+// ReparseDocument queues a document to be parsed again with the current
+// parser version.
+func (h *DocumentsHandler) ReparseDocument(c *gin.Context) {
+    docID := c.Param("id")
+
+    doc, err := h.couchbaseService.GetDocument(docID)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+        return
+    }
+
+    if err := h.parserWorker.Reparse(doc); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue reparse", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusAccepted, gin.H{
+        "message":        "Document queued for reparsing",
+        "id":             docID,
+        "parser_version": doc.ParserVersion,
+        "target_version": services.ParserVersion,
+    })
+}
+
+// ListChunks returns a document's passages with their page, sheet, slide or
+// heading location. With ?q= only passages containing the text are returned.
+func (h *DocumentsHandler) ListChunks(c *gin.Context) {
+    docID := c.Param("id")
+
+    if _, err := h.couchbaseService.GetDocument(docID); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+        return
+    }
+
+    chunks, err := h.couchbaseService.ListDocumentChunks(docID, c.Query("q"))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list chunks", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "chunks": chunks,
+        "total":  len(chunks),
+    })
+}
+
+// GetChunk returns a single passage of a document.
+func (h *DocumentsHandler) GetChunk(c *gin.Context) {
+    ordinal, err := strconv.Atoi(c.Param("ordinal"))
+    if err != nil || ordinal < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chunk ordinal"})
+        return
+    }
+
+    chunk, err := h.couchbaseService.GetChunk(c.Param("id"), ordinal)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Chunk not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, chunk)
+}
+
 func getContentType(fileType string) string {
     switch fileType {
     case ".pdf":
         return "application/pdf"
     case ".docx":
         return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+    case ".doc":
+        return "application/msword"
     case ".xlsx":
         return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+    case ".xls":
+        return "application/vnd.ms-excel"
     case ".csv":
         return "text/csv"
-    case ".ppt", ".pptx":
+    case ".pptx":
         return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+    case ".ppt":
+        return "application/vnd.ms-powerpoint"
     case ".txt":
         return "text/plain"
+    case ".zip":
+        return "application/zip"
+    case ".tar.gz", ".tgz":
+        return "application/gzip"
+    case ".log":
+        return "text/plain"
+    case ".md", ".markdown":
+        return "text/markdown"
+    case ".html", ".htm":
+        return "text/html"
+    case ".json":
+        return "application/json"
+    case ".yaml", ".yml":
+        return "application/yaml"
     default:
         return "application/octet-stream"
     }
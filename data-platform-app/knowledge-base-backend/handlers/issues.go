@@ -0,0 +1,191 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "knowledge-base-backend/models"
+    "knowledge-base-backend/services"
+)
+
+type IssuesHandler struct {
+    couchbaseService *services.CouchbaseService
+    issues           *services.IssueRegistry
+}
+
+func NewIssuesHandler(
+    couchbaseService *services.CouchbaseService,
+    issues *services.IssueRegistry,
+) *IssuesHandler {
+    return &IssuesHandler{
+        couchbaseService: couchbaseService,
+        issues:           issues,
+    }
+}
+
+func (h *IssuesHandler) ListIssues(c *gin.Context) {
+    issues, err := h.couchbaseService.ListKnownIssues()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list known issues", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "issues": issues,
+        "total":  len(issues),
+    })
+}
+
+func (h *IssuesHandler) GetIssue(c *gin.Context) {
+    issue, err := h.couchbaseService.GetKnownIssue(c.Param("id"))
+    if err != nil {
+        h.issueError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, issue)
+}
+
+// ListIssueDocuments lists the documents linked to a known issue, a page
+// at a time like ListDocuments.
+func (h *IssuesHandler) ListIssueDocuments(c *gin.Context) {
+    page, err := parsePage(c, services.SortUploadedAt, services.SortFileName, services.SortFileSize)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination", "details": err.Error()})
+        return
+    }
+
+    documents, total, err := h.couchbaseService.ListIssueDocuments(c.Param("id"), page)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list documents", "details": err.Error()})
+        return
+    }
+
+    response := gin.H{
+        "documents": documents,
+        "total":     total,
+    }
+    if cursor := nextCursor(c, page, total); cursor != "" {
+        response["next_cursor"] = cursor
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// MatchIssues returns the known issues matching a pasted log line or stack
+// trace, optionally only those affecting a product.
+func (h *IssuesHandler) MatchIssues(c *gin.Context) {
+    text := c.Query("text")
+    if strings.TrimSpace(text) == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'text' is required"})
+        return
+    }
+
+    issues := h.issues.Match(text, c.Query("product"))
+    c.JSON(http.StatusOK, gin.H{
+        "issues": issues,
+        "total":  len(issues),
+    })
+}
+
+func (h *IssuesHandler) CreateIssue(c *gin.Context) {
+    var req models.KnownIssueRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+        return
+    }
+    if err := services.NormalizeKnownIssue(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid known issue", "details": err.Error()})
+        return
+    }
+
+    now := time.Now()
+    issue := &models.KnownIssue{
+        ID:          uuid.New().String(),
+        Title:       req.Title,
+        Signature:   req.Signature,
+        Description: req.Description,
+        Products:    req.Products,
+        Resolution:  req.Resolution,
+        CreatedBy:   c.GetString("user_id"),
+        CreatedAt:   now,
+        UpdatedAt:   now,
+    }
+    if err := h.couchbaseService.SaveKnownIssue(issue); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save known issue", "details": err.Error()})
+        return
+    }
+    h.relink()
+
+    c.JSON(http.StatusCreated, issue)
+}
+
+func (h *IssuesHandler) UpdateIssue(c *gin.Context) {
+    var req models.KnownIssueRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+        return
+    }
+    if err := services.NormalizeKnownIssue(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid known issue", "details": err.Error()})
+        return
+    }
+
+    issue, err := h.couchbaseService.GetKnownIssue(c.Param("id"))
+    if err != nil {
+        h.issueError(c, err)
+        return
+    }
+    issue.Title = req.Title
+    issue.Signature = req.Signature
+    issue.Description = req.Description
+    issue.Products = req.Products
+    issue.Resolution = req.Resolution
+    issue.UpdatedAt = time.Now()
+    if err := h.couchbaseService.SaveKnownIssue(issue); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save known issue", "details": err.Error()})
+        return
+    }
+    h.relink()
+
+    c.JSON(http.StatusOK, issue)
+}
+
+func (h *IssuesHandler) DeleteIssue(c *gin.Context) {
+    if err := h.couchbaseService.DeleteKnownIssue(c.Param("id")); err != nil {
+        h.issueError(c, err)
+        return
+    }
+    h.relink()
+
+    c.JSON(http.StatusOK, gin.H{"message": "Known issue deleted successfully"})
+}
+
+func (h *IssuesHandler) issueError(c *gin.Context, err error) {
+    if errors.Is(err, services.ErrKnownIssueNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Known issue not found"})
+        return
+    }
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access known issue", "details": err.Error()})
+}
+
+// relink applies a change to matching right away and, in the background,
+// to the links of documents parsed before it.
+func (h *IssuesHandler) relink() {
+    if _, err := h.issues.Load(); err != nil {
+        log.Printf("Failed to reload known issues: %v", err)
+        return
+    }
+    go func() {
+        count, err := h.issues.Relink()
+        if err != nil {
+            log.Printf("Failed to relink documents to known issues: %v", err)
+            return
+        }
+        log.Printf("Relinked %d documents to known issues", count)
+    }()
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "knowledge-base-backend/services"
+)
+
+const (
+    defaultPageSize = 50
+    maxPageSize     = 200
+)
+
+// defaultDescending is the direction of each sort when no order is given.
+var defaultDescending = map[string]bool{
+    services.SortRelevance:  true,
+    services.SortUploadedAt: true,
+    services.SortFileName:   false,
+    services.SortFileSize:   true,
+}
+
+// pageCursor is the state carried from one page to the next. It is tied to
+// the query that produced it so it cannot be replayed against another one.
+type pageCursor struct {
+    Offset int    `json:"o"`
+    Query  string `json:"q"`
+}
+
+// parsePage reads page_size, cursor, sort and order from the query string.
+// sorts lists the orders the endpoint supports, the first being its default.
+func parsePage(c *gin.Context, sorts ...string) (services.Page, error) {
+    page := services.Page{Limit: defaultPageSize, Sort: sorts[0]}
+
+    if value := c.Query("page_size"); value != "" {
+        size, err := strconv.Atoi(value)
+        if err != nil || size < 1 || size > maxPageSize {
+            return page, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+        }
+        page.Limit = size
+    }
+
+    if value := c.Query("sort"); value != "" {
+        supported := false
+        for _, sort := range sorts {
+            supported = supported || sort == value
+        }
+        if !supported {
+            return page, fmt.Errorf("unsupported sort %q, expected one of %v", value, sorts)
+        }
+        page.Sort = value
+    }
+
+    page.Descending = defaultDescending[page.Sort]
+    switch c.Query("order") {
+    case "":
+    case "asc":
+        page.Descending = false
+    case "desc":
+        page.Descending = true
+    default:
+        return page, fmt.Errorf("order must be asc or desc")
+    }
+
+    if value := c.Query("cursor"); value != "" {
+        data, err := base64.RawURLEncoding.DecodeString(value)
+        var cursor pageCursor
+        if err == nil {
+            err = json.Unmarshal(data, &cursor)
+        }
+        if err != nil || cursor.Offset < 0 {
+            return page, fmt.Errorf("invalid cursor")
+        }
+        if cursor.Query != queryFingerprint(c) {
+            return page, fmt.Errorf("cursor belongs to a different query")
+        }
+        page.Offset = cursor.Offset
+    }
+
+    return page, nil
+}
+
+// nextCursor returns the cursor for the page after page, or "" on the last
+// page.
+func nextCursor(c *gin.Context, page services.Page, total int) string {
+    if page.Offset+page.Limit >= total {
+        return ""
+    }
+    data, _ := json.Marshal(pageCursor{Offset: page.Offset + page.Limit, Query: queryFingerprint(c)})
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// queryFingerprint identifies the query parameters that decide what a list
+// contains and in which order.
+func queryFingerprint(c *gin.Context) string {
+    params := c.Request.URL.Query()
+    params.Del("cursor")
+    params.Del("page_size")
+    sum := sha256.Sum256([]byte(params.Encode()))
+    return hex.EncodeToString(sum[:8])
+}
@@ -1,19 +1,39 @@
 package handlers
 
 import (
+    "errors"
+    "fmt"
+    "log"
     "net/http"
+    "strconv"
+    "strings"
+    "time"
 
     "github.com/gin-gonic/gin"
+    "knowledge-base-backend/models"
     "knowledge-base-backend/services"
 )
 
+const (
+    defaultSuggestLimit = 10
+    maxSuggestLimit     = 50
+    // fewResults is the result count below which a respelling is suggested.
+    fewResults = 3
+    // maxQueryLength bounds the search query in bytes.
+    maxQueryLength = 4096
+)
+
 type SearchHandler struct {
-    couchbaseService *services.CouchbaseService
+    searchBackend services.SearchBackend
+    suggester     *services.Suggester
+    synonyms      *services.SynonymDictionary
 }
 
-func NewSearchHandler(couchbaseService *services.CouchbaseService) *SearchHandler {
+func NewSearchHandler(searchBackend services.SearchBackend, suggester *services.Suggester, synonyms *services.SynonymDictionary) *SearchHandler {
     return &SearchHandler{
-        couchbaseService: couchbaseService,
+        searchBackend: searchBackend,
+        suggester:     suggester,
+        synonyms:      synonyms,
     }
 }
 
@@ -23,19 +43,194 @@ func (h *SearchHandler) Search(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
         return
     }
+    if len(query) > maxQueryLength {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Query parameter 'q' exceeds %d bytes", maxQueryLength)})
+        return
+    }
+
+    parsed, err := services.ParseQuery(query)
+    if err != nil {
+        var syntaxErr *services.QuerySyntaxError
+        if errors.As(err, &syntaxErr) {
+            c.JSON(http.StatusBadRequest, gin.H{
+                "error":    "Invalid search query",
+                "details":  syntaxErr.Message,
+                "position": syntaxErr.Position,
+            })
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search query", "details": err.Error()})
+        return
+    }
 
-    product := c.Query("product")
-    subProduct := c.Query("sub_product")
-    category := c.Query("category")
+    filter, err := parseSearchFilter(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search filter", "details": err.Error()})
+        return
+    }
+
+    page, err := parsePage(c, services.SortRelevance, services.SortUploadedAt, services.SortFileName, services.SortFileSize)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination", "details": err.Error()})
+        return
+    }
 
-    documents, err := h.couchbaseService.SearchDocuments(query, product, subProduct, category)
+    results, err := h.searchBackend.Search(h.synonyms.Expand(parsed, filter.Terms["product"]), filter, page)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed", "details": err.Error()})
         return
     }
 
+    // A search that finds nothing runs the respelled query instead, unless
+    // the caller asks for the query exactly as typed
+    var suggested string
+    corrected := false
+    if results.Total < fewResults {
+        var suggestedResults *services.SearchResults
+        suggested, suggestedResults = h.respell(query, parsed, filter, page, results.Total)
+        if suggestedResults != nil && results.Total == 0 && c.Query("autocorrect") != "false" {
+            results, corrected = suggestedResults, true
+        }
+    }
+
+    // Later pages of the same search are not searched again
+    if results.Total > 0 && page.Offset == 0 {
+        recorded := query
+        if corrected {
+            recorded = suggested
+        }
+        go func() {
+            if err := h.suggester.RecordQuery(recorded, filter); err != nil {
+                log.Printf("Failed to record search query: %v", err)
+            }
+        }()
+    }
+
+    includeText := c.Query("include_text") == "true"
+    documents := make([]models.SearchResult, len(results.Hits))
+    for i, hit := range results.Hits {
+        documents[i] = services.NewSearchResult(hit, includeText)
+    }
+
+    c.JSON(http.StatusOK, models.SearchResponse{
+        Documents:      documents,
+        Total:          results.Total,
+        Facets:         results.Facets,
+        NextCursor:     nextCursor(c, page, results.Total),
+        SuggestedQuery: suggested,
+        Corrected:      corrected,
+    })
+}
+
+// respell searches for a spelling correction of query, returning it only if
+// it finds more than the found documents.
+func (h *SearchHandler) respell(query string, parsed services.QueryNode, filter services.SearchFilter, page services.Page, found int) (string, *services.SearchResults) {
+    suggestion, ok := h.suggester.Correct(query, parsed)
+    if !ok {
+        return "", nil
+    }
+    suggestionParsed, err := services.ParseQuery(suggestion)
+    if err != nil {
+        return "", nil
+    }
+    results, err := h.searchBackend.Search(h.synonyms.Expand(suggestionParsed, filter.Terms["product"]), filter, page)
+    if err != nil {
+        log.Printf("Failed to search for suggested query %q: %v", suggestion, err)
+        return "", nil
+    }
+    if results.Total <= found {
+        return "", nil
+    }
+    return suggestion, results
+}
+
+// Suggest completes a partly typed query from file names, keywords, error
+// messages and popular past queries. path limits suggestions to a folder of
+// the document tree, as in ListDocuments.
+func (h *SearchHandler) Suggest(c *gin.Context) {
+    prefix := c.Query("prefix")
+    if strings.TrimSpace(prefix) == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'prefix' is required"})
+        return
+    }
+
+    limit := defaultSuggestLimit
+    if value := c.Query("limit"); value != "" {
+        n, err := strconv.Atoi(value)
+        if err != nil || n < 1 || n > maxSuggestLimit {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit", "details": fmt.Sprintf("limit must be between 1 and %d", maxSuggestLimit)})
+            return
+        }
+        limit = n
+    }
+
     c.JSON(http.StatusOK, gin.H{
-        "documents": documents,
-        "total":     len(documents),
+        "prefix":      prefix,
+        "suggestions": h.suggester.Suggest(prefix, c.Query("path"), limit),
     })
 }
+
+// parseSearchFilter reads the search filters from the query string. Facet
+// fields may be repeated to accept any of several values, e.g.
+// ?file_type=pdf&file_type=docx. Upload dates take RFC 3339 times or plain
+// dates, where uploaded_to includes the whole day; sizes are in bytes.
+func parseSearchFilter(c *gin.Context) (services.SearchFilter, error) {
+    filter := services.SearchFilter{Terms: make(map[string][]string)}
+
+    for field, values := range c.Request.URL.Query() {
+        if !services.IsFacetField(field) {
+            continue
+        }
+        for _, value := range values {
+            if value != "" {
+                filter.Terms[field] = append(filter.Terms[field], value)
+            }
+        }
+    }
+
+    var err error
+    if value := c.Query("uploaded_from"); value != "" {
+        if filter.UploadedFrom, err = parseFilterTime(value, false); err != nil {
+            return filter, fmt.Errorf("invalid uploaded_from: %v", err)
+        }
+    }
+    if value := c.Query("uploaded_to"); value != "" {
+        if filter.UploadedTo, err = parseFilterTime(value, true); err != nil {
+            return filter, fmt.Errorf("invalid uploaded_to: %v", err)
+        }
+    }
+    if value := c.Query("min_size"); value != "" {
+        if filter.MinSize, err = parseFilterSize(value); err != nil {
+            return filter, fmt.Errorf("invalid min_size: %v", err)
+        }
+    }
+    if value := c.Query("max_size"); value != "" {
+        if filter.MaxSize, err = parseFilterSize(value); err != nil {
+            return filter, fmt.Errorf("invalid max_size: %v", err)
+        }
+    }
+
+    return filter, nil
+}
+
+func parseFilterTime(value string, endOfDay bool) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    day, err := time.Parse("2006-01-02", value)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("expected a date (2006-01-02) or RFC 3339 time")
+    }
+    if endOfDay {
+        return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+    }
+    return day, nil
+}
+
+func parseFilterSize(value string) (*int64, error) {
+    size, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || size < 0 {
+        return nil, fmt.Errorf("expected a non-negative number of bytes")
+    }
+    return &size, nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+    "io"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "knowledge-base-backend/models"
+    "knowledge-base-backend/worker"
+)
+
+// statusPollInterval is how often a stream re-reads the document and its
+// job, which picks up progress made by workers on other instances.
+const statusPollInterval = 2 * time.Second
+
+type StatusHandler struct {
+    parserWorker *worker.ParserWorker
+}
+
+func NewStatusHandler(parserWorker *worker.ParserWorker) *StatusHandler {
+    return &StatusHandler{
+        parserWorker: parserWorker,
+    }
+}
+
+// StreamStatus sends the parse progress of a document as server-sent
+// events until it is parsed or has failed for good.
+func (h *StatusHandler) StreamStatus(c *gin.Context) {
+    docID := c.Param("id")
+
+    status, err := h.parserWorker.Status(docID)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+        return
+    }
+
+    updates, unsubscribe := h.parserWorker.Subscribe(docID)
+    defer unsubscribe()
+
+    c.Header("Content-Type", "text/event-stream")
+    c.Header("Cache-Control", "no-cache")
+    c.Header("Connection", "keep-alive")
+    c.Header("X-Accel-Buffering", "no")
+
+    c.SSEvent("status", status)
+    if status.Final() {
+        c.SSEvent("complete", status)
+        return
+    }
+    c.Writer.Flush()
+
+    ticker := time.NewTicker(statusPollInterval)
+    defer ticker.Stop()
+
+    last := *status
+    c.Stream(func(w io.Writer) bool {
+        select {
+        case <-c.Request.Context().Done():
+            return false
+        case update := <-updates:
+            status = &update
+        case <-ticker.C:
+            latest, err := h.parserWorker.Status(docID)
+            if err != nil {
+                c.SSEvent("error", gin.H{"error": "Document not found"})
+                return false
+            }
+            // Skip unchanged snapshots, but keep the connection alive
+            if sameProgress(&last, latest) {
+                c.SSEvent("ping", gin.H{"time": time.Now()})
+                return true
+            }
+            status = latest
+        }
+
+        last = *status
+        c.SSEvent("status", status)
+        if status.Final() {
+            c.SSEvent("complete", status)
+            return false
+        }
+        return true
+    })
+}
+
+// sameProgress reports whether two snapshots would look the same to a client.
+func sameProgress(a, b *models.ParseProgress) bool {
+    if a.Stage != b.Stage || a.Status != b.Status || a.QueuePosition != b.QueuePosition ||
+        a.Attempts != b.Attempts || a.Error != b.Error {
+        return false
+    }
+    if a.Progress == nil || b.Progress == nil {
+        return a.Progress == b.Progress
+    }
+    return *a.Progress == *b.Progress
+}
+
+// QueueOverview reports how many documents are waiting, being parsed,
+// backing off or dead-lettered, along with the stage of each active job.
+func (h *StatusHandler) QueueOverview(c *gin.Context) {
+    stats, err := h.parserWorker.QueueStats()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read queue", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "knowledge-base-backend/models"
+    "knowledge-base-backend/services"
+)
+
+type SynonymsHandler struct {
+    couchbaseService *services.CouchbaseService
+    synonyms         *services.SynonymDictionary
+}
+
+func NewSynonymsHandler(
+    couchbaseService *services.CouchbaseService,
+    synonyms *services.SynonymDictionary,
+) *SynonymsHandler {
+    return &SynonymsHandler{
+        couchbaseService: couchbaseService,
+        synonyms:         synonyms,
+    }
+}
+
+func (h *SynonymsHandler) ListSynonyms(c *gin.Context) {
+    synonyms, err := h.couchbaseService.ListSynonyms()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list synonyms", "details": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "synonyms": synonyms,
+        "total":    len(synonyms),
+    })
+}
+
+func (h *SynonymsHandler) GetSynonym(c *gin.Context) {
+    synonym, err := h.couchbaseService.GetSynonym(c.Param("id"))
+    if err != nil {
+        h.synonymError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, synonym)
+}
+
+func (h *SynonymsHandler) CreateSynonym(c *gin.Context) {
+    var req models.SynonymRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+        return
+    }
+    terms, err := services.NormalizeSynonymTerms(req.Terms)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid synonym", "details": err.Error()})
+        return
+    }
+
+    now := time.Now()
+    synonym := &models.Synonym{
+        ID:        uuid.New().String(),
+        Terms:     terms,
+        Product:   req.Product,
+        CreatedBy: c.GetString("user_id"),
+        CreatedAt: now,
+        UpdatedAt: now,
+    }
+    if err := h.couchbaseService.SaveSynonym(synonym); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save synonym", "details": err.Error()})
+        return
+    }
+    h.reload()
+
+    c.JSON(http.StatusCreated, synonym)
+}
+
+func (h *SynonymsHandler) UpdateSynonym(c *gin.Context) {
+    var req models.SynonymRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+        return
+    }
+    terms, err := services.NormalizeSynonymTerms(req.Terms)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid synonym", "details": err.Error()})
+        return
+    }
+
+    synonym, err := h.couchbaseService.GetSynonym(c.Param("id"))
+    if err != nil {
+        h.synonymError(c, err)
+        return
+    }
+    synonym.Terms = terms
+    synonym.Product = req.Product
+    synonym.UpdatedAt = time.Now()
+    if err := h.couchbaseService.SaveSynonym(synonym); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save synonym", "details": err.Error()})
+        return
+    }
+    h.reload()
+
+    c.JSON(http.StatusOK, synonym)
+}
+
+func (h *SynonymsHandler) DeleteSynonym(c *gin.Context) {
+    if err := h.couchbaseService.DeleteSynonym(c.Param("id")); err != nil {
+        h.synonymError(c, err)
+        return
+    }
+    h.reload()
+
+    c.JSON(http.StatusOK, gin.H{"message": "Synonym deleted successfully"})
+}
+
+func (h *SynonymsHandler) synonymError(c *gin.Context, err error) {
+    if errors.Is(err, services.ErrSynonymNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Synonym not found"})
+        return
+    }
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access synonym", "details": err.Error()})
+}
+
+// reload applies a change to searches right away; other instances pick it
+// up on their next periodic reload.
+func (h *SynonymsHandler) reload() {
+    if _, err := h.synonyms.Load(); err != nil {
+        log.Printf("Failed to reload synonyms: %v", err)
+    }
+}
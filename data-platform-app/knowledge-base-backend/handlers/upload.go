@@ -1,9 +1,13 @@
 package handlers
 
 import (
+    "errors"
     "fmt"
+    "io"
+    "log"
     "net/http"
     "path/filepath"
+    "strconv"
     "strings"
     "time"
 
@@ -18,27 +22,53 @@ type UploadHandler struct {
     gcsService       *services.GCSService
     couchbaseService *services.CouchbaseService
     parserWorker     *worker.ParserWorker
+    retryAfter       int // seconds suggested to clients when the queue is full
+    bundleLimits     services.ArchiveLimits
 }
 
 func NewUploadHandler(
     gcsService *services.GCSService,
     couchbaseService *services.CouchbaseService,
     parserWorker *worker.ParserWorker,
+    retryAfter int,
+    bundleLimits services.ArchiveLimits,
 ) *UploadHandler {
     return &UploadHandler{
         gcsService:       gcsService,
         couchbaseService: couchbaseService,
         parserWorker:     parserWorker,
+        retryAfter:       retryAfter,
+        bundleLimits:     bundleLimits,
     }
 }
 
 func (h *UploadHandler) Upload(c *gin.Context) {
+    // Shed load before accepting the file rather than growing the backlog
+    if h.parserWorker.Saturated() {
+        c.Header("Retry-After", strconv.Itoa(h.retryAfter))
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error":   "Parse queue is full, please retry later",
+            "backlog": h.parserWorker.Backlog(),
+        })
+        return
+    }
+
     var req models.UploadRequest
     if err := c.ShouldBind(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
         return
     }
 
+    // When the content was uploaded before, either return the existing
+    // document or record this upload as a duplicate sharing its file
+    if req.OnDuplicate == "" {
+        req.OnDuplicate = onDuplicateReturn
+    }
+    if req.OnDuplicate != onDuplicateReturn && req.OnDuplicate != onDuplicateLink {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid on_duplicate", "details": "on_duplicate must be return or link"})
+        return
+    }
+
     file, header, err := c.Request.FormFile("file")
     if err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
@@ -46,12 +76,13 @@ func (h *UploadHandler) Upload(c *gin.Context) {
     }
     defer file.Close()
 
-    ext := filepath.Ext(header.Filename)
-    allowedExts := map[string]bool{
-        ".pdf": true, ".docx": true, ".xlsx": true,
-        ".csv": true, ".ppt": true, ".pptx": true, ".txt": true,
+    if services.ArchiveExt(header.Filename) != "" {
+        h.uploadBundle(c, &req, file, header)
+        return
     }
-    if !allowedExts[ext] {
+
+    ext := filepath.Ext(header.Filename)
+    if !services.IsSupportedFile(header.Filename) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "File type not supported"})
         return
     }
@@ -62,17 +93,115 @@ func (h *UploadHandler) Upload(c *gin.Context) {
     // Keep original filename (sanitize)
     originalName := header.Filename
     safeName := sanitizeFilename(originalName)
-    
-    // Build GCS path with original filename
-    gcsPath := fmt.Sprintf("knowledge_based/%s/%s/%s/%s",
-        req.Product, req.SubProduct, req.Category, safeName)
+
+    // A file with the same name in the same folder is a new version of it
+    current, err := h.couchbaseService.FindDocumentByName(req.Product, req.SubProduct, req.Category, safeName)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up existing document", "details": err.Error()})
+        return
+    }
+    saved := false
+    if current == nil {
+        // Concurrent first uploads of a name all miss the lookup; only the
+        // one holding the reservation creates version 1
+        reserved, owner, err := h.couchbaseService.ReserveDocumentName(req.Product, req.SubProduct, req.Category, safeName, docID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve file name", "details": err.Error()})
+            return
+        }
+        if reserved {
+            defer func() {
+                if saved {
+                    return
+                }
+                if err := h.couchbaseService.ReleaseDocumentName(req.Product, req.SubProduct, req.Category, safeName, docID); err != nil {
+                    log.Printf("Failed to release file name %s: %v", safeName, err)
+                }
+            }()
+        } else {
+            current, err = h.couchbaseService.GetDocument(owner)
+            if errors.Is(err, services.ErrDocumentNotFound) {
+                c.Header("Retry-After", strconv.Itoa(h.retryAfter))
+                c.JSON(http.StatusConflict, gin.H{"error": "Another upload of this file is in progress, please retry later"})
+                return
+            }
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up existing document", "details": err.Error()})
+                return
+            }
+        }
+    }
+    if current != nil {
+        // Content identical to the current version neither takes a version
+        // number nor is stored again
+        contentHash, err := services.ContentHash(io.NewSectionReader(file, 0, header.Size))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file", "details": err.Error()})
+            return
+        }
+        if contentHash == current.ContentHash {
+            c.JSON(http.StatusOK, gin.H{
+                "message":   "File unchanged",
+                "duplicate": true,
+                "document":  current,
+            })
+            return
+        }
+    }
+    versionNumber := 1
+    if current != nil {
+        versionNumber, err = h.couchbaseService.ClaimVersion(current)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to number the new version", "details": err.Error()})
+            return
+        }
+    }
+
+    // Build GCS path with original filename and version
+    gcsPath := services.VersionedPath(fmt.Sprintf("knowledge_based/%s/%s/%s",
+        req.Product, req.SubProduct, req.Category), safeName, versionNumber)
 
     ctx := c.Request.Context()
-    if err := h.gcsService.UploadFile(ctx, file, safeName, gcsPath); err != nil {
+    contentHash, err := h.gcsService.UploadFile(ctx, file, safeName, gcsPath)
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file", "details": err.Error()})
         return
     }
 
+    version := models.DocumentVersion{
+        Version:      versionNumber,
+        GCSPath:      gcsPath,
+        FileSize:     header.Size,
+        ContentHash:  contentHash,
+        OriginalName: originalName,
+        UploadedBy:   c.GetString("user_id"),
+        UploadedAt:   time.Now(),
+    }
+    if current != nil {
+        h.uploadVersion(c, current, version)
+        return
+    }
+
+    original, err := h.couchbaseService.FindDocumentByHash(contentHash)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for duplicates", "details": err.Error()})
+        return
+    }
+    if original != nil {
+        // The original's file serves both; drop the copy just stored
+        if err := h.gcsService.DeleteFile(ctx, gcsPath); err != nil {
+            log.Printf("Failed to delete duplicate upload %s: %v", gcsPath, err)
+        }
+    }
+    if original != nil && req.OnDuplicate == onDuplicateReturn {
+        c.JSON(http.StatusOK, gin.H{
+            "message":   "File already uploaded",
+            "duplicate": true,
+            "document":  original,
+        })
+        return
+    }
+
     doc := &models.Document{
         ID:           docID,
         FileName:     safeName,  // Original filename
@@ -80,21 +209,44 @@ func (h *UploadHandler) Upload(c *gin.Context) {
         FileType:     ext,
         FileSize:     header.Size,
         GCSPath:      gcsPath,
+        ContentHash:  contentHash,
+        Version:      versionNumber,
+        Versions:     []models.DocumentVersion{version},
         Product:      req.Product,
         SubProduct:   req.SubProduct,
         Category:     req.Category,
         Status:       "uploaded",
-        UploadedBy:   c.GetString("user_id"),
-        UploadedAt:   time.Now(),
-        UpdatedAt:    time.Now(),
+        UploadedBy:   version.UploadedBy,
+        UploadedAt:   version.UploadedAt,
+        UpdatedAt:    version.UploadedAt,
+    }
+
+    if original != nil {
+        doc.GCSPath = original.GCSPath
+        doc.Versions[0].GCSPath = original.GCSPath
+        doc.DuplicateOf = original.ID
+        if err := h.parserWorker.AddDuplicate(doc, original); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metadata", "details": err.Error()})
+            return
+        }
+        saved = true
+        c.JSON(http.StatusOK, gin.H{
+            "message":   "File already uploaded, linked to the existing document",
+            "duplicate": true,
+            "document":  doc,
+        })
+        return
     }
 
     if err := h.couchbaseService.SaveDocument(doc); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metadata", "details": err.Error()})
         return
     }
+    saved = true
 
-    h.parserWorker.AddJob(doc)
+    if err := h.parserWorker.AddJob(doc); err != nil {
+        log.Printf("Failed to enqueue parse job for %s: %v", doc.ID, err)
+    }
 
     c.JSON(http.StatusOK, gin.H{
         "message": "File uploaded successfully",
@@ -102,6 +254,34 @@ func (h *UploadHandler) Upload(c *gin.Context) {
     })
 }
 
+// uploadVersion records an uploaded file as the next version of doc and
+// queues it for parsing.
+func (h *UploadHandler) uploadVersion(c *gin.Context, doc *models.Document, version models.DocumentVersion) {
+    // Added to the stored document, which another upload may have changed
+    doc, err := h.couchbaseService.UpdateDocument(doc.ID, func(doc *models.Document) {
+        services.AddDocumentVersion(doc, version)
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metadata", "details": err.Error()})
+        return
+    }
+
+    if err := h.parserWorker.AddVersion(doc); err != nil {
+        log.Printf("Failed to enqueue parse job for %s: %v", doc.ID, err)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "New version uploaded successfully",
+        "document": doc,
+    })
+}
+
+// on_duplicate values of an upload whose content is already stored.
+const (
+    onDuplicateReturn = "return"
+    onDuplicateLink   = "link"
+)
+
 // Sanitize filename to be GCS-safe
 func sanitizeFilename(filename string) string {
     // Replace spaces with underscore
@@ -1,8 +1,10 @@
 package main
 
 import (
+    "flag"
     "log"
     "os"
+    "time"
 
     "github.com/gin-gonic/gin"
     "knowledge-base-backend/config"
@@ -13,6 +15,9 @@ import (
 )
 
 func main() {
+    rebuildSearchIndex := flag.Bool("rebuild-search-index", false, "rebuild the search index from Couchbase and exit")
+    flag.Parse()
+
     cfg := config.LoadConfig()
     middleware.SetJWTSecret(cfg.JWTSecret)
 
@@ -40,6 +45,13 @@ func main() {
         "knowledge_based",
         "master_document",
         "document",
+        cfg.CouchbaseJobCollection,
+        cfg.CouchbaseBundleCollection,
+        cfg.CouchbaseChunkCollection,
+        cfg.CouchbaseQueryCollection,
+        cfg.CouchbaseSynonymCollection,
+        cfg.CouchbaseIssueCollection,
+        cfg.CouchbaseVersionCollection,
     )
     if err != nil {
         log.Fatalf("Failed to connect to Couchbase: %v", err)
@@ -47,16 +59,109 @@ func main() {
     defer couchbaseService.Close()
     log.Println("✅ Couchbase connected successfully!")
 
+    if cfg.SearchBackend == services.SearchBackendCouchbase && cfg.CouchbaseSearchIndex != "" {
+        if err := couchbaseService.EnsureSearchIndex(cfg.CouchbaseSearchIndex); err != nil {
+            log.Printf("Warning: full-text search unavailable, using substring search: %v", err)
+        }
+    }
+
+    searchBackend, err := services.NewSearchBackend(cfg.SearchBackend, cfg.SearchIndexPath, couchbaseService)
+    if err != nil {
+        log.Fatalf("Failed to initialize search backend: %v", err)
+    }
+    defer searchBackend.Close()
+    log.Printf("Using %s search backend", searchBackend.Name())
+
+    if *rebuildSearchIndex {
+        count, err := searchBackend.Rebuild()
+        if err != nil {
+            log.Fatalf("Failed to rebuild search index: %v", err)
+        }
+        log.Printf("Rebuilt search index with %d documents", count)
+        return
+    }
+
+    // A new embedded index starts empty; fill it while serving
+    if bleveSearch, ok := searchBackend.(*services.BleveSearch); ok && bleveSearch.Created() {
+        go func() {
+            count, err := bleveSearch.Rebuild()
+            if err != nil {
+                log.Printf("Failed to build search index: %v", err)
+                return
+            }
+            log.Printf("Built search index with %d documents", count)
+        }()
+    }
+
+    suggester := services.NewSuggester(couchbaseService)
+    go func() {
+        count, err := suggester.Load()
+        if err != nil {
+            log.Printf("Failed to load search suggestions: %v", err)
+            return
+        }
+        log.Printf("Loaded search suggestions from %d documents", count)
+    }()
+
+    corpus := services.NewKeywordCorpus(couchbaseService)
+    go func() {
+        count, err := corpus.Load()
+        if err != nil {
+            log.Printf("Failed to load keyword corpus: %v", err)
+            return
+        }
+        log.Printf("Loaded keyword corpus from %d documents", count)
+    }()
+
+    // Synonyms and known issues change rarely; reloading picks up edits
+    // made on other instances
+    synonyms := services.NewSynonymDictionary(couchbaseService)
+    if count, err := synonyms.Load(); err != nil {
+        log.Printf("Warning: search synonyms unavailable: %v", err)
+    } else {
+        log.Printf("Loaded %d search synonyms", count)
+    }
+    issues := services.NewIssueRegistry(couchbaseService)
+    if count, err := issues.Load(); err != nil {
+        log.Printf("Warning: known issues unavailable: %v", err)
+    } else {
+        log.Printf("Loaded %d known issues", count)
+    }
+    go func() {
+        for range time.Tick(time.Minute) {
+            if _, err := synonyms.Load(); err != nil {
+                log.Printf("Failed to reload search synonyms: %v", err)
+            }
+            if _, err := issues.Load(); err != nil {
+                log.Printf("Failed to reload known issues: %v", err)
+            }
+        }
+    }()
+
     parserWorker := worker.NewParserWorker(
         cfg.WorkerChannelSize,
+        cfg.ParseBacklogLimit,
         gcsService,
         couchbaseService,
+        searchBackend,
+        suggester,
+        corpus,
+        issues,
     )
-    parserWorker.Start(3)
+    parserWorker.Start(cfg.WorkerCount)
 
-    uploadHandler := handlers.NewUploadHandler(gcsService, couchbaseService, parserWorker)
-    searchHandler := handlers.NewSearchHandler(couchbaseService)
-    documentsHandler := handlers.NewDocumentsHandler(gcsService, couchbaseService)
+    uploadHandler := handlers.NewUploadHandler(gcsService, couchbaseService, parserWorker, cfg.UploadRetryAfter, services.ArchiveLimits{
+        MaxEntries:    cfg.BundleMaxEntries,
+        MaxTotalSize:  int64(cfg.BundleMaxSizeMB) << 20,
+        MaxDepth:      cfg.BundleMaxDepth,
+        MaxNestedSize: int64(cfg.BundleMaxNestedMB) << 20,
+    })
+    searchHandler := handlers.NewSearchHandler(searchBackend, suggester, synonyms)
+    documentsHandler := handlers.NewDocumentsHandler(gcsService, couchbaseService, parserWorker)
+    adminHandler := handlers.NewAdminHandler(couchbaseService, parserWorker)
+    statusHandler := handlers.NewStatusHandler(parserWorker)
+    synonymsHandler := handlers.NewSynonymsHandler(couchbaseService, synonyms)
+    issuesHandler := handlers.NewIssuesHandler(couchbaseService, issues)
 
     r := gin.Default()
     r.MaxMultipartMemory = 100 << 20
@@ -79,10 +184,43 @@ func main() {
     {
         api.POST("/upload", uploadHandler.Upload)
         api.GET("/search", searchHandler.Search)
+        api.GET("/search/suggest", searchHandler.Suggest)
         api.GET("/documents", documentsHandler.ListDocuments)
         api.GET("/documents/:id", documentsHandler.GetDocument)
         api.GET("/documents/:id/download", documentsHandler.DownloadDocument)
+        api.GET("/documents/:id/versions", documentsHandler.ListVersions)
+        api.POST("/documents/:id/versions/:version/restore", documentsHandler.RestoreVersion)
+        api.GET("/documents/:id/diff", documentsHandler.DiffVersions)
+        api.GET("/documents/:id/chunks", documentsHandler.ListChunks)
+        api.GET("/documents/:id/chunks/:ordinal", documentsHandler.GetChunk)
+        api.GET("/documents/:id/status/stream", statusHandler.StreamStatus)
+        api.POST("/documents/:id/reparse", documentsHandler.ReparseDocument)
         api.DELETE("/documents/:id", documentsHandler.DeleteDocument)
+        api.GET("/bundles/:id", documentsHandler.GetBundle)
+        api.GET("/issues", issuesHandler.ListIssues)
+        api.GET("/issues/match", issuesHandler.MatchIssues)
+        api.GET("/issues/:id", issuesHandler.GetIssue)
+        api.GET("/issues/:id/documents", issuesHandler.ListIssueDocuments)
+        api.GET("/queue", statusHandler.QueueOverview)
+    }
+
+    admin := api.Group("/admin")
+    if !isDev {
+        admin.Use(middleware.AdminMiddleware())
+    }
+    {
+        admin.GET("/parse-failures", adminHandler.ListParseFailures)
+        admin.POST("/parse-failures/:id/retry", adminHandler.RetryParseFailure)
+        admin.POST("/reparse", adminHandler.BulkReparse)
+        admin.GET("/reparse/:id", adminHandler.GetReparseRun)
+        admin.GET("/synonyms", synonymsHandler.ListSynonyms)
+        admin.POST("/synonyms", synonymsHandler.CreateSynonym)
+        admin.GET("/synonyms/:id", synonymsHandler.GetSynonym)
+        admin.PUT("/synonyms/:id", synonymsHandler.UpdateSynonym)
+        admin.DELETE("/synonyms/:id", synonymsHandler.DeleteSynonym)
+        admin.POST("/issues", issuesHandler.CreateIssue)
+        admin.PUT("/issues/:id", issuesHandler.UpdateIssue)
+        admin.DELETE("/issues/:id", issuesHandler.DeleteIssue)
     }
 
     log.Printf("Server starting on port %s...", cfg.ServerPort)
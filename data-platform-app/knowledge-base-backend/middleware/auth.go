@@ -19,6 +19,7 @@ func SetJWTSecret(secret string) {
 type Claims struct {
     UserID   string `json:"userId"`
     Username string `json:"username"`
+    Role     string `json:"role"`
     jwt.RegisteredClaims
 }
 
@@ -57,6 +58,7 @@ func AuthMiddleware() gin.HandlerFunc {
         if claims, ok := token.Claims.(*Claims); ok && token.Valid {
             c.Set("user_id", claims.UserID)
             c.Set("username", claims.Username)
+            c.Set("role", claims.Role)
         } else {
             c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
             c.Abort()
@@ -66,3 +68,15 @@ func AuthMiddleware() gin.HandlerFunc {
         c.Next()
     }
 }
+
+func AdminMiddleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        role, exists := c.Get("role")
+        if !exists || role != "admin" {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+            c.Abort()
+            return
+        }
+        c.Next()
+    }
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Bundle is an uploaded .zip or .tar.gz archive whose supported entries were
+// expanded into individual documents.
+type Bundle struct {
+    ID           string               `json:"id"`
+    FileName     string               `json:"file_name"`
+    OriginalName string               `json:"original_name"`
+    FileType     string               `json:"file_type"` // .zip, .tar.gz, .tgz
+    FileSize     int64                `json:"file_size"`
+    GCSPath      string               `json:"gcs_path"`
+    Version      int                  `json:"version"` // uploads of an archive with the same name
+    Product      string               `json:"product"`
+    SubProduct   string               `json:"sub_product"`
+    Category     string               `json:"category"`
+    DocumentIDs  []string             `json:"document_ids"`
+    Skipped      []BundleSkippedEntry `json:"skipped,omitempty"`
+    Duplicates   []BundleDuplicate    `json:"duplicates,omitempty"` // with on_duplicate=return
+    Status       string               `json:"status"` // expanded, partial
+    Error        string               `json:"error,omitempty"`
+    UploadedBy   string               `json:"uploaded_by"`
+    UploadedAt   time.Time            `json:"uploaded_at"`
+    UpdatedAt    time.Time            `json:"updated_at"`
+}
+
+// BundleSkippedEntry is an archive entry that did not become a document.
+type BundleSkippedEntry struct {
+    Path   string `json:"path"`
+    Reason string `json:"reason"`
+}
+
+// BundleDuplicate is an archive entry whose content was already uploaded as
+// another document, returned instead of storing it again.
+type BundleDuplicate struct {
+    Path       string `json:"path"`
+    DocumentID string `json:"document_id"`
+}
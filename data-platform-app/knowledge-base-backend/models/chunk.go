@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Chunk is a passage of a document's parsed text together with where it came
+// from, so search can point to a page, sheet, slide or section rather than
+// the whole file.
+type Chunk struct {
+    ID          string    `json:"id"` // <document_id>::<ordinal>
+    DocumentID  string    `json:"document_id"`
+    Ordinal     int       `json:"ordinal"` // position within the document, from 0
+    Text        string    `json:"text"`
+    Page        int       `json:"page,omitempty"`         // PDF page, from 1
+    Sheet       string    `json:"sheet,omitempty"`        // spreadsheet sheet name
+    Slide       int       `json:"slide,omitempty"`        // presentation slide, from 1
+    HeadingPath []string  `json:"heading_path,omitempty"` // enclosing headings, outermost first
+    CreatedAt   time.Time `json:"created_at"`
+}
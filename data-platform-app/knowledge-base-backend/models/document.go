@@ -9,28 +9,69 @@ type Document struct {
     FileType        string    `json:"file_type"`
     FileSize        int64     `json:"file_size"`
     GCSPath         string    `json:"gcs_path"`
+    ContentHash     string    `json:"content_hash,omitempty"` // hex SHA-256 of the file
+    DuplicateOf     string    `json:"duplicate_of,omitempty"` // document whose stored file this one shares
+    Version         int       `json:"version,omitempty"`  // current version; 0 for documents uploaded before versioning
+    Versions        []DocumentVersion `json:"versions,omitempty"` // every version, oldest first
     Product         string    `json:"product"`          // cloudera
     SubProduct      string    `json:"sub_product"`      // cdp
     Category        string    `json:"category"`         // services
     ParsedText      string    `json:"parsed_text"`
     Keywords        []string  `json:"keywords"`
+    KeywordScores   []KeywordScore `json:"keyword_scores,omitempty"` // Keywords with their TF-IDF scores
     ErrorMessages   []string  `json:"error_messages"`
-    Status          string    `json:"status"`           // uploaded, parsing, parsed, error
+    Errors          []ErrorRecord `json:"errors,omitempty"` // structured form of ErrorMessages
+    KnownIssues     []string  `json:"known_issues,omitempty"` // IDs of the known issues ErrorMessages match
+    Status          string    `json:"status"`           // uploaded, parsing, parsed, failed
+    ParseError      string    `json:"parse_error,omitempty"`
+    ParserVersion   int       `json:"parser_version"`   // services.ParserVersion that produced ParsedText
+    ChunkCount      int       `json:"chunk_count"`      // passages stored in the chunk collection
+    BundleID        string    `json:"bundle_id,omitempty"`   // archive the document was expanded from
+    BundlePath      string    `json:"bundle_path,omitempty"` // path of the entry inside that archive
     ParsedAt        *time.Time `json:"parsed_at,omitempty"`
     UploadedBy      string    `json:"uploaded_by"`
     UploadedAt      time.Time `json:"uploaded_at"`
     UpdatedAt       time.Time `json:"updated_at"`
 }
 
-type UploadRequest struct {
-    Product    string `form:"product" binding:"required"`
-    SubProduct string `form:"sub_product" binding:"required"`
-    Category   string `form:"category" binding:"required"`
+// DocumentVersion is one uploaded revision of a document's file. Every
+// version keeps its own object in GCS; a restored version shares the object
+// of the version it restores.
+type DocumentVersion struct {
+    Version      int       `json:"version"` // from 1
+    GCSPath      string    `json:"gcs_path"`
+    FileSize     int64     `json:"file_size"`
+    ContentHash  string    `json:"content_hash,omitempty"`
+    OriginalName string    `json:"original_name"`
+    RestoredFrom int       `json:"restored_from,omitempty"` // version this one restored
+    UploadedBy   string    `json:"uploaded_by"`
+    UploadedAt   time.Time `json:"uploaded_at"`
+}
+
+// KeywordScore is a keyword of a document with its TF-IDF score.
+type KeywordScore struct {
+    Keyword string  `json:"keyword"`
+    Score   float64 `json:"score"`
 }
 
-type SearchResponse struct {
-    Documents []Document `json:"documents"`
-    Total     int        `json:"total"`
+// ErrorRecord is an error found in a document's text: a log record at
+// warning level or above, a stack trace or traceback, or an HTTP error
+// status. Fields the source did not give are empty.
+type ErrorRecord struct {
+    ExceptionClass string `json:"exception_class,omitempty"`
+    Message        string `json:"message,omitempty"`
+    ErrorCode      string `json:"error_code,omitempty"`  // e.g. ORA-00942, HTTP 503
+    LogLevel       string `json:"log_level,omitempty"`   // WARN, ERROR or FATAL
+    Component      string `json:"component,omitempty"`   // logger or module
+    FirstFrame     string `json:"first_frame,omitempty"` // where the exception was thrown
+    Count          int    `json:"count"`                 // occurrences in the document
+}
+
+type UploadRequest struct {
+    Product     string `form:"product" binding:"required"`
+    SubProduct  string `form:"sub_product" binding:"required"`
+    Category    string `form:"category" binding:"required"`
+    OnDuplicate string `form:"on_duplicate"` // return (default) or link, for content uploaded before
 }
 
 type FolderItem struct {
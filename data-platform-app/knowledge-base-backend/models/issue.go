@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// KnownIssue is a recurring error and how to resolve it. Documents whose
+// error messages contain the signature are linked to it when they are
+// parsed, so every log showing the error leads to the fix.
+type KnownIssue struct {
+    ID          string    `json:"id"`
+    Title       string    `json:"title"`
+    Signature   string    `json:"signature"` // normalized error message, see services.NormalizeErrorSignature
+    Description string    `json:"description"`
+    Products    []string  `json:"products"`   // empty affects every product
+    Resolution  []string  `json:"resolution"` // steps, in order
+    CreatedBy   string    `json:"created_by"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// KnownIssueRequest creates or replaces a known issue. Signature may be
+// pasted as it appears in a log; it is normalized before it is stored.
+type KnownIssueRequest struct {
+    Title       string   `json:"title" binding:"required"`
+    Signature   string   `json:"signature" binding:"required"`
+    Description string   `json:"description"`
+    Products    []string `json:"products"`
+    Resolution  []string `json:"resolution"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// ParseJob is the persisted queue entry for a document waiting to be parsed.
+// It is keyed by the document ID, so a document has at most one pending job.
+type ParseJob struct {
+    ID             string         `json:"id"`
+    DocumentID     string         `json:"document_id"`
+    Status         string         `json:"status"`                     // queued, leased, failed
+    Priority       int            `json:"priority"`                   // higher is claimed first
+    LeaseOwner     string         `json:"lease_owner,omitempty"`      // worker holding the lease
+    LeaseExpiresAt *time.Time     `json:"lease_expires_at,omitempty"` // claimable again after this
+    HeartbeatAt    *time.Time     `json:"heartbeat_at,omitempty"`
+    Attempts       int            `json:"attempts"`
+    LastError      string         `json:"last_error,omitempty"`
+    NextRetryAt    *time.Time     `json:"next_retry_at,omitempty"` // not claimable before this
+    Stage          string         `json:"stage,omitempty"`         // pipeline stage of the current attempt
+    Progress       *StageProgress `json:"progress,omitempty"`
+    CreatedAt      time.Time      `json:"created_at"`
+    UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// ParseFailure is a dead-lettered document together with its failed job.
+type ParseFailure struct {
+    Document *Document `json:"document"`
+    Job      *ParseJob `json:"job,omitempty"`
+}
+
+// StageProgress counts units of work within a pipeline stage, e.g. pages of
+// a PDF or sheets of a workbook.
+type StageProgress struct {
+    Current int    `json:"current"`
+    Total   int    `json:"total"`
+    Unit    string `json:"unit"` // page, sheet
+}
+
+// ParseProgress describes where a document is in the parse pipeline.
+type ParseProgress struct {
+    DocumentID    string         `json:"document_id"`
+    Status        string         `json:"status"` // document status
+    Stage         string         `json:"stage"`  // queued, downloading, parsing, extracting_keywords, chunking, saving, done, failed
+    Progress      *StageProgress `json:"progress,omitempty"`
+    QueuePosition int            `json:"queue_position,omitempty"` // 1-based, while queued
+    Attempts      int            `json:"attempts,omitempty"`
+    NextRetryAt   *time.Time     `json:"next_retry_at,omitempty"`
+    Error         string         `json:"error,omitempty"`
+    UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// Final reports whether the document has left the pipeline for good.
+func (p *ParseProgress) Final() bool {
+    return p.Stage == "done" || p.Stage == "failed"
+}
+
+// QueueStats summarizes the parse queue across all instances.
+type QueueStats struct {
+    Queued     int        `json:"queued"`      // ready to be claimed
+    Retrying   int        `json:"retrying"`    // waiting for a backoff to pass
+    InProgress int        `json:"in_progress"` // leased by a worker
+    Failed     int        `json:"failed"`      // dead-lettered
+    Active     []ParseJob `json:"active"`      // leased jobs with their stage
+}
+
+// ReparseRequest selects documents for a bulk reparse. Empty fields match
+// everything.
+type ReparseRequest struct {
+    PathPrefix    string `json:"path_prefix"`     // product[/sub_product[/category]]
+    Status        string `json:"status"`          // only documents in this status
+    BelowVersion  int    `json:"below_version"`   // only documents parsed by an older parser
+    RatePerMinute int    `json:"rate_per_minute"` // enqueue throttle
+}
+
+// ReparseRun tracks a bulk reparse feeding the queue in the background.
+type ReparseRun struct {
+    ID         string         `json:"id"`
+    Filter     ReparseRequest `json:"filter"`
+    Matched    int            `json:"matched"`
+    Enqueued   int            `json:"enqueued"`
+    Status     string         `json:"status"` // running, completed, failed
+    Error      string         `json:"error,omitempty"`
+    StartedAt  time.Time      `json:"started_at"`
+    FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+// SearchHit is a document matched by a search with its relevance score and
+// where the query matched it.
+type SearchHit struct {
+    Document
+    Score   float64     `json:"score"`
+    Matches []TextMatch `json:"-"`
+}
+
+// TextMatch is a span of a document field that matched a search term. Index
+// is the element for array fields such as keywords.
+type TextMatch struct {
+    Field string
+    Index int
+    Start int // byte offsets into the field value
+    End   int
+}
+
+// SearchResult is the compact form of a hit returned by the search API. The
+// parsed text is only included on request.
+type SearchResult struct {
+    ID                   string    `json:"id"`
+    FileName             string    `json:"file_name"`
+    OriginalName         string    `json:"original_name"`
+    FileType             string    `json:"file_type"`
+    FileSize             int64     `json:"file_size"`
+    Path                 string    `json:"path"` // location in the document tree
+    Product              string    `json:"product"`
+    SubProduct           string    `json:"sub_product"`
+    Category             string    `json:"category"`
+    Status               string    `json:"status"`
+    UploadedAt           time.Time `json:"uploaded_at"`
+    Score                float64   `json:"score"`
+    Snippets             []Snippet `json:"snippets"`
+    MatchedKeywords      []string  `json:"matched_keywords"`
+    MatchedErrorMessages []string  `json:"matched_error_messages"`
+    ParsedText           string    `json:"parsed_text,omitempty"`
+}
+
+// Snippet is an excerpt of the parsed text around one or more matches.
+// Highlighted is the HTML-escaped excerpt with matches wrapped in <mark>;
+// Marks locates the same matches in Text.
+type Snippet struct {
+    Text        string `json:"text"`
+    Highlighted string `json:"highlighted"`
+    Marks       []Mark `json:"marks"`
+}
+
+// Mark is a match within a snippet, in characters from the start of its Text.
+type Mark struct {
+    Start int `json:"start"`
+    End   int `json:"end"`
+}
+
+// FacetCount is how many search results have a value of a facet field.
+type FacetCount struct {
+    Value string `json:"value"`
+    Count int    `json:"count"`
+}
+
+// SearchResponse is a page of search results. SuggestedQuery is a respelling
+// of a query that found few or no documents; when Corrected is set the
+// results are for it rather than for the query as typed.
+type SearchResponse struct {
+    Documents      []SearchResult          `json:"documents"`
+    Total          int                     `json:"total"`
+    Facets         map[string][]FacetCount `json:"facets"`
+    NextCursor     string                  `json:"next_cursor,omitempty"`
+    SuggestedQuery string                  `json:"suggested_query,omitempty"`
+    Corrected      bool                    `json:"corrected"`
+}
+
+// Suggestion is a completion offered while a search query is typed. Kind is
+// where it came from: a file name, keyword, error message or past query.
+type Suggestion struct {
+    Text  string `json:"text"`
+    Kind  string `json:"kind"`
+    Count int    `json:"count"` // documents containing it, or times searched
+}
+
+// QueryStat counts how often a query that found documents was searched,
+// within the product, sub-product and category it was filtered to.
+type QueryStat struct {
+    ID             string    `json:"id"`
+    Query          string    `json:"query"`
+    Product        string    `json:"product,omitempty"`
+    SubProduct     string    `json:"sub_product,omitempty"`
+    Category       string    `json:"category,omitempty"`
+    Count          int       `json:"count"`
+    LastSearchedAt time.Time `json:"last_searched_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Synonym is a set of interchangeable search terms, such as an acronym, its
+// expansion and its Indonesian equivalent. A search for any of them also
+// finds the others. Product limits it to searches in that product, so an
+// acronym can mean different things in different products.
+type Synonym struct {
+    ID        string    `json:"id"`
+    Terms     []string  `json:"terms"`             // lower-case words or phrases
+    Product   string    `json:"product,omitempty"` // empty applies to every product
+    CreatedBy string    `json:"created_by"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SynonymRequest creates or replaces a synonym.
+type SynonymRequest struct {
+    Terms   []string `json:"terms" binding:"required"`
+    Product string   `json:"product"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// VersionText is what parsing one version of a document produced, kept so
+// versions can be compared after the document moved on to a newer one.
+type VersionText struct {
+    ID            string    `json:"id"` // <document_id>::v<version>
+    DocumentID    string    `json:"document_id"`
+    Version       int       `json:"version"`
+    ParsedText    string    `json:"parsed_text"`
+    Keywords      []string  `json:"keywords"`
+    ErrorMessages []string  `json:"error_messages"`
+    ParserVersion int       `json:"parser_version"`
+    ParsedAt      time.Time `json:"parsed_at"`
+}
+
+// VersionDiff is what changed in a document's parsed text between two of
+// its versions, line by line or paragraph by paragraph.
+type VersionDiff struct {
+    DocumentID      string     `json:"document_id"`
+    From            int        `json:"from"`
+    To              int        `json:"to"`
+    Unit            string     `json:"unit"`    // line or paragraph
+    Added           int        `json:"added"`   // lines or paragraphs only in To
+    Removed         int        `json:"removed"` // lines or paragraphs only in From
+    Hunks           []DiffHunk `json:"hunks,omitempty"`
+    Unified         string     `json:"unified,omitempty"` // instead of Hunks with format=unified
+    KeywordsAdded   []string   `json:"keywords_added"`
+    KeywordsRemoved []string   `json:"keywords_removed"`
+    ErrorsAdded     []string   `json:"errors_added"`
+    ErrorsRemoved   []string   `json:"errors_removed"`
+}
+
+// DiffHunk is a run of changes with the unchanged lines around them.
+// Starts count from 1, as in a unified diff.
+type DiffHunk struct {
+    FromStart int        `json:"from_start"`
+    FromCount int        `json:"from_count"`
+    ToStart   int        `json:"to_start"`
+    ToCount   int        `json:"to_count"`
+    Lines     []DiffLine `json:"lines"`
+}
+
+type DiffLine struct {
+    Op   string `json:"op"` // equal, delete, insert
+    Text string `json:"text"`
+}
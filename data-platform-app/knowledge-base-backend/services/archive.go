@@ -0,0 +1,179 @@
+package services
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "path"
+    "strings"
+)
+
+// ArchiveLimits bounds what an uploaded bundle may expand to. Sizes are
+// measured on the decompressed bytes actually read, not on archive headers,
+// which a zip bomb can fake.
+type ArchiveLimits struct {
+    MaxEntries    int   // files across all nesting levels
+    MaxTotalSize  int64 // decompressed bytes across all entries
+    MaxDepth      int   // 1 allows no nested archives
+    MaxNestedSize int64 // decompressed bytes of one nested archive, held in memory
+}
+
+// ArchiveLimitError reports an archive rejected for exceeding ArchiveLimits.
+type ArchiveLimitError struct {
+    Reason string
+}
+
+func (e *ArchiveLimitError) Error() string {
+    return "archive rejected: " + e.Reason
+}
+
+// ArchiveExt returns ".zip", ".tar.gz" or ".tgz" for supported archive file
+// names and "" otherwise.
+func ArchiveExt(fileName string) string {
+    name := strings.ToLower(fileName)
+    for _, ext := range []string{".zip", ".tar.gz", ".tgz"} {
+        if strings.HasSuffix(name, ext) {
+            return ext
+        }
+    }
+    return ""
+}
+
+// WalkArchive calls fn for every regular file in a .zip, .tar.gz or .tgz
+// archive, expanding nested archives in place. entryPath is the cleaned path
+// inside the archive, with nested archives as directories (e.g.
+// "logs.zip/app/server.log"). Reads from r count towards limits, and fn
+// fails with an *ArchiveLimitError once they are exceeded.
+func WalkArchive(r io.ReaderAt, size int64, fileName string, limits ArchiveLimits, fn func(entryPath string, r io.Reader) error) error {
+    w := &archiveWalker{limits: limits, fn: fn}
+    return w.walk(r, size, fileName, "", 1)
+}
+
+type archiveWalker struct {
+    limits  ArchiveLimits
+    entries int
+    total   int64
+    fn      func(entryPath string, r io.Reader) error
+}
+
+func (w *archiveWalker) walk(r io.ReaderAt, size int64, fileName, prefix string, depth int) error {
+    if depth > w.limits.MaxDepth {
+        return &ArchiveLimitError{Reason: fmt.Sprintf("archives nested more than %d deep", w.limits.MaxDepth)}
+    }
+
+    switch ArchiveExt(fileName) {
+    case ".zip":
+        return w.walkZip(r, size, prefix, depth)
+    case ".tar.gz", ".tgz":
+        return w.walkTarGz(io.NewSectionReader(r, 0, size), prefix, depth)
+    }
+    return fmt.Errorf("unsupported archive type: %s", fileName)
+}
+
+func (w *archiveWalker) walkZip(r io.ReaderAt, size int64, prefix string, depth int) error {
+    zipReader, err := zip.NewReader(r, size)
+    if err != nil {
+        return fmt.Errorf("failed to read zip: %v", err)
+    }
+
+    for _, file := range zipReader.File {
+        if file.FileInfo().IsDir() {
+            continue
+        }
+
+        rc, err := file.Open()
+        if err != nil {
+            return fmt.Errorf("failed to open %s: %v", file.Name, err)
+        }
+        err = w.entry(file.Name, &limitedArchiveReader{r: rc, w: w}, prefix, depth)
+        rc.Close()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (w *archiveWalker) walkTarGz(r io.Reader, prefix string, depth int) error {
+    gz, err := gzip.NewReader(r)
+    if err != nil {
+        return fmt.Errorf("failed to read gzip: %v", err)
+    }
+    defer gz.Close()
+
+    // Count everything gunzipped, including entries that are skipped over
+    tarReader := tar.NewReader(&limitedArchiveReader{r: gz, w: w})
+    for {
+        header, err := tarReader.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return archiveReadError(err)
+        }
+        if header.Typeflag != tar.TypeReg {
+            continue
+        }
+        if err := w.entry(header.Name, tarReader, prefix, depth); err != nil {
+            return err
+        }
+    }
+}
+
+// entry recurses into nested archives and hands other files to fn. r must
+// already be a limitedArchiveReader or read from one.
+func (w *archiveWalker) entry(name string, r io.Reader, prefix string, depth int) error {
+    name = strings.TrimPrefix(path.Clean("/"+name), "/")
+    base := path.Base(name)
+    if name == "" || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, "._") || base == ".DS_Store" {
+        return nil
+    }
+
+    w.entries++
+    if w.entries > w.limits.MaxEntries {
+        return &ArchiveLimitError{Reason: fmt.Sprintf("more than %d entries", w.limits.MaxEntries)}
+    }
+
+    entryPath := path.Join(prefix, name)
+
+    if ArchiveExt(name) != "" {
+        data, err := io.ReadAll(io.LimitReader(r, w.limits.MaxNestedSize+1))
+        if err != nil {
+            return archiveReadError(err)
+        }
+        if int64(len(data)) > w.limits.MaxNestedSize {
+            return &ArchiveLimitError{Reason: fmt.Sprintf("nested archive %s larger than %d bytes", entryPath, w.limits.MaxNestedSize)}
+        }
+        return w.walk(bytes.NewReader(data), int64(len(data)), name, entryPath, depth+1)
+    }
+
+    return w.fn(entryPath, r)
+}
+
+// archiveReadError keeps limit errors recognizable through wrapping.
+func archiveReadError(err error) error {
+    var limitErr *ArchiveLimitError
+    if errors.As(err, &limitErr) {
+        return limitErr
+    }
+    return fmt.Errorf("failed to read archive: %v", err)
+}
+
+// limitedArchiveReader charges every byte read against the walker's total.
+type limitedArchiveReader struct {
+    r io.Reader
+    w *archiveWalker
+}
+
+func (l *limitedArchiveReader) Read(p []byte) (int, error) {
+    n, err := l.r.Read(p)
+    l.w.total += int64(n)
+    if l.w.total > l.w.limits.MaxTotalSize {
+        return n, &ArchiveLimitError{Reason: fmt.Sprintf("more than %d bytes uncompressed", l.w.limits.MaxTotalSize)}
+    }
+    return n, err
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "io"
+    "math/rand"
+    "slices"
+    "strings"
+    "testing"
+)
+
+type archiveFile struct {
+    name string
+    data []byte
+}
+
+func buildZip(t *testing.T, files ...archiveFile) []byte {
+    t.Helper()
+    var buf bytes.Buffer
+    zw := zip.NewWriter(&buf)
+    for _, file := range files {
+        fw, err := zw.Create(file.name)
+        if err != nil {
+            t.Fatalf("failed to create zip entry: %v", err)
+        }
+        fw.Write(file.data)
+    }
+    if err := zw.Close(); err != nil {
+        t.Fatalf("failed to close zip: %v", err)
+    }
+    return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, files ...archiveFile) []byte {
+    t.Helper()
+    var buf bytes.Buffer
+    gz := gzip.NewWriter(&buf)
+    tw := tar.NewWriter(gz)
+    for _, file := range files {
+        header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), Typeflag: tar.TypeReg}
+        if err := tw.WriteHeader(header); err != nil {
+            t.Fatalf("failed to write tar header: %v", err)
+        }
+        tw.Write(file.data)
+    }
+    if err := tw.Close(); err != nil {
+        t.Fatalf("failed to close tar: %v", err)
+    }
+    gz.Close()
+    return buf.Bytes()
+}
+
+func TestWalkArchive(t *testing.T) {
+    limits := ArchiveLimits{MaxEntries: 10, MaxTotalSize: 1 << 20, MaxDepth: 2, MaxNestedSize: 64 << 10}
+    text := []byte("2025-01-01 ERROR something failed\n")
+
+    nested := buildZip(t, archiveFile{"inner.log", text})
+    twiceNested := buildZip(t, archiveFile{"inner.zip", nested})
+    // Zeros compress about a thousandfold, as in a zip bomb
+    bomb := buildZip(t, archiveFile{"zeros.log", make([]byte, 2<<20)})
+    // Random bytes do not compress, so the nested archive itself is large
+    noise := make([]byte, 128<<10)
+    rand.New(rand.NewSource(1)).Read(noise)
+    bigNested := buildZip(t, archiveFile{"logs.zip", buildZip(t, archiveFile{"noise.log", noise})})
+
+    var many []archiveFile
+    for i := 0; i < 11; i++ {
+        many = append(many, archiveFile{strings.Repeat("x", i+1) + ".log", text})
+    }
+
+    tests := []struct {
+        name      string
+        fileName  string
+        data      []byte
+        wantPaths []string
+        wantLimit string
+        wantErr   bool
+    }{
+        {
+            name:     "zip",
+            fileName: "bundle.zip",
+            data: buildZip(t,
+                archiveFile{"app/server.log", text},
+                archiveFile{"../../etc/passwd", text},
+                archiveFile{"__MACOSX/app/._server.log", text},
+                archiveFile{"app/.DS_Store", text},
+            ),
+            wantPaths: []string{"app/server.log", "etc/passwd"},
+        },
+        {
+            name:      "tar.gz",
+            fileName:  "bundle.tar.gz",
+            data:      buildTarGz(t, archiveFile{"./conf/site.xml", text}, archiveFile{"readme.md", text}),
+            wantPaths: []string{"conf/site.xml", "readme.md"},
+        },
+        {
+            name:      "nested archive",
+            fileName:  "bundle.tgz",
+            data:      buildTarGz(t, archiveFile{"logs.zip", nested}),
+            wantPaths: []string{"logs.zip/inner.log"},
+        },
+        {
+            name:      "nested too deep",
+            fileName:  "bundle.zip",
+            data:      buildZip(t, archiveFile{"outer.zip", twiceNested}),
+            wantLimit: "nested more than 2 deep",
+        },
+        {
+            name:      "too many entries",
+            fileName:  "bundle.zip",
+            data:      buildZip(t, many...),
+            wantLimit: "more than 10 entries",
+        },
+        {
+            name:      "decompresses past the total size",
+            fileName:  "bundle.zip",
+            data:      bomb,
+            wantLimit: "bytes uncompressed",
+        },
+        {
+            name:      "nested archive past its size",
+            fileName:  "bundle.zip",
+            data:      bigNested,
+            wantLimit: "nested archive logs.zip larger than",
+        },
+        {
+            name:     "not an archive",
+            fileName: "bundle.zip",
+            data:     []byte("not a zip file"),
+            wantErr:  true,
+        },
+        {
+            name:     "truncated gzip",
+            fileName: "bundle.tar.gz",
+            data:     buildTarGz(t, archiveFile{"a.log", text})[:20],
+            wantErr:  true,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var paths []string
+            err := WalkArchive(bytes.NewReader(tt.data), int64(len(tt.data)), tt.fileName, limits, func(entryPath string, r io.Reader) error {
+                paths = append(paths, entryPath)
+                _, err := io.Copy(io.Discard, r)
+                return err
+            })
+
+            var limitErr *ArchiveLimitError
+            switch {
+            case tt.wantLimit != "":
+                if !errors.As(err, &limitErr) || !strings.Contains(limitErr.Reason, tt.wantLimit) {
+                    t.Fatalf("expected limit error %q, got %v", tt.wantLimit, err)
+                }
+            case tt.wantErr:
+                if err == nil || errors.As(err, &limitErr) {
+                    t.Fatalf("expected a read error, got %v", err)
+                }
+            default:
+                if err != nil {
+                    t.Fatalf("unexpected error: %v", err)
+                }
+                if !slices.Equal(paths, tt.wantPaths) {
+                    t.Errorf("got paths %v, want %v", paths, tt.wantPaths)
+                }
+            }
+        })
+    }
+}
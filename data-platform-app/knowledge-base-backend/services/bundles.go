@@ -0,0 +1,110 @@
+package services
+
+import (
+    "fmt"
+
+    "github.com/couchbase/gocb/v2"
+    "knowledge-base-backend/models"
+)
+
+func (s *CouchbaseService) SaveBundle(bundle *models.Bundle) error {
+    _, err := s.bundleCollection.Upsert(bundle.ID, bundle, nil)
+    if err != nil {
+        return fmt.Errorf("failed to save bundle: %v", err)
+    }
+    return nil
+}
+
+func (s *CouchbaseService) GetBundle(id string) (*models.Bundle, error) {
+    result, err := s.bundleCollection.Get(id, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get bundle: %v", err)
+    }
+
+    var bundle models.Bundle
+    if err := result.Content(&bundle); err != nil {
+        return nil, fmt.Errorf("failed to decode bundle: %v", err)
+    }
+    return &bundle, nil
+}
+
+// ListBundleDocuments returns the documents expanded from a bundle, ordered
+// by their path inside the archive.
+func (s *CouchbaseService) ListBundleDocuments(bundleID string) ([]models.Document, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT d.* FROM %s d
+        WHERE d.bundle_id = $1
+        ORDER BY d.bundle_path
+    `, s.keyspace(s.collectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{bundleID},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    var documents []models.Document
+    for results.Next() {
+        var doc models.Document
+        if err := results.Row(&doc); err != nil {
+            continue
+        }
+        documents = append(documents, doc)
+    }
+
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return documents, nil
+}
+
+// FindBundleByName returns the latest bundle uploaded with the given archive
+// file name in a folder, or nil when there is none.
+func (s *CouchbaseService) FindBundleByName(product, subProduct, category, fileName string) (*models.Bundle, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT b.* FROM %s b
+        WHERE b.product = $1 AND b.sub_product = $2 AND b.category = $3 AND b.file_name = $4
+        ORDER BY IFMISSINGORNULL(b.version, 1) DESC, b.uploaded_at DESC LIMIT 1
+    `, s.keyspace(s.bundleCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{product, subProduct, category, fileName},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    var bundle *models.Bundle
+    for results.Next() {
+        var b models.Bundle
+        if err := results.Row(&b); err != nil {
+            continue
+        }
+        bundle = &b
+    }
+
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return bundle, nil
+}
+
+// FindBundleEntry returns the document expanded from the entry at
+// entryPath of any earlier upload of an archive with the given file name in
+// a folder, or nil when there is none. It is the bundle counterpart of
+// FindDocumentByName: uploading the archive again versions its entries.
+func (s *CouchbaseService) FindBundleEntry(product, subProduct, category, archiveName, entryPath string) (*models.Document, error) {
+    return s.findDocument(
+        "SELECT d.* FROM "+s.keyspace(s.collectionName)+` d
+        WHERE d.product = $1 AND d.sub_product = $2 AND d.category = $3 AND d.bundle_path = $5
+            AND d.bundle_id IN (
+                SELECT RAW META(b).id FROM `+s.keyspace(s.bundleCollectionName)+` b
+                WHERE b.product = $1 AND b.sub_product = $2 AND b.category = $3 AND b.file_name = $4
+            )
+        ORDER BY d.uploaded_at LIMIT 1`,
+        []interface{}{product, subProduct, category, archiveName, entryPath},
+    )
+}
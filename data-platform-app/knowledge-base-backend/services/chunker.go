@@ -0,0 +1,151 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "unicode"
+    "unicode/utf8"
+
+    "knowledge-base-backend/models"
+)
+
+// maxChunkChars bounds the size of a chunk. Sections longer than this are
+// split at line breaks, or at spaces for very long lines.
+const maxChunkChars = 2000
+
+// Section is a run of parsed text from one place in the source file. At most
+// one of Page, Sheet and Slide is set; HeadingPath holds the enclosing
+// headings for formats that have them.
+type Section struct {
+    Text        string
+    Page        int
+    Sheet       string
+    Slide       int
+    HeadingPath []string
+}
+
+func joinSections(sections []Section) string {
+    var text strings.Builder
+    for _, section := range sections {
+        text.WriteString(section.Text)
+    }
+    return text.String()
+}
+
+// headingSections collects text into sections that start at each heading.
+type headingSections struct {
+    list []Section
+    text strings.Builder
+    path []string
+}
+
+func (h *headingSections) WriteString(s string) {
+    h.text.WriteString(s)
+}
+
+// startSection closes the current section and opens one under a heading of
+// the given level (1 being the top).
+func (h *headingSections) startSection(level int, title string) {
+    h.flush()
+    if level-1 < len(h.path) {
+        h.path = h.path[:level-1]
+    }
+    h.path = append(h.path, title)
+}
+
+func (h *headingSections) flush() {
+    if h.text.Len() == 0 {
+        return
+    }
+    h.list = append(h.list, Section{
+        Text:        h.text.String(),
+        HeadingPath: append([]string(nil), h.path...),
+    })
+    h.text.Reset()
+}
+
+func (h *headingSections) sections() []Section {
+    h.flush()
+    return h.list
+}
+
+// ChunkSections splits parsed sections into chunks of at most maxChunkChars,
+// numbered in document order. Chunks never span sections, so each keeps the
+// location of the section it came from.
+func ChunkSections(documentID string, sections []Section) []models.Chunk {
+    var chunks []models.Chunk
+    now := time.Now()
+
+    for _, section := range sections {
+        for _, text := range splitChunkText(section.Text) {
+            chunks = append(chunks, models.Chunk{
+                ID:          ChunkID(documentID, len(chunks)),
+                DocumentID:  documentID,
+                Ordinal:     len(chunks),
+                Text:        text,
+                Page:        section.Page,
+                Sheet:       section.Sheet,
+                Slide:       section.Slide,
+                HeadingPath: section.HeadingPath,
+                CreatedAt:   now,
+            })
+        }
+    }
+
+    return chunks
+}
+
+// ChunkID is the key of a document's chunk in the chunk collection.
+func ChunkID(documentID string, ordinal int) string {
+    return fmt.Sprintf("%s::%d", documentID, ordinal)
+}
+
+// splitChunkText packs whole lines into pieces of at most maxChunkChars,
+// dropping pieces that are only whitespace.
+func splitChunkText(text string) []string {
+    var pieces []string
+    var current strings.Builder
+
+    emit := func() {
+        if piece := strings.TrimSpace(current.String()); piece != "" {
+            pieces = append(pieces, piece)
+        }
+        current.Reset()
+    }
+
+    for _, line := range strings.SplitAfter(text, "\n") {
+        for len(line) > maxChunkChars {
+            emit()
+            cut := splitPoint(line, maxChunkChars)
+            current.WriteString(line[:cut])
+            emit()
+            line = line[cut:]
+        }
+        if current.Len()+len(line) > maxChunkChars {
+            emit()
+        }
+        current.WriteString(line)
+    }
+    emit()
+
+    return pieces
+}
+
+// splitPoint returns a byte offset no greater than limit at which s can be
+// cut, preferring the last space and never splitting a UTF-8 sequence.
+func splitPoint(s string, limit int) int {
+    cut := limit
+    for cut > 0 && !utf8.RuneStart(s[cut]) {
+        cut--
+    }
+    for i := cut; i > limit/2; i-- {
+        if r, _ := utf8.DecodeRuneInString(s[i:]); unicode.IsSpace(r) {
+            return i
+        }
+    }
+    if cut == 0 {
+        return limit
+    }
+    return cut
+}
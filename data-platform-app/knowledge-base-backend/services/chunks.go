@@ -0,0 +1,97 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/couchbase/gocb/v2"
+    "knowledge-base-backend/models"
+)
+
+// ReplaceDocumentChunks stores the chunks of a freshly parsed document and
+// removes any left over from a previous, longer parse.
+func (s *CouchbaseService) ReplaceDocumentChunks(documentID string, chunks []models.Chunk) error {
+    for i := range chunks {
+        if _, err := s.chunkCollection.Upsert(chunks[i].ID, &chunks[i], nil); err != nil {
+            return fmt.Errorf("failed to save chunk %s: %v", chunks[i].ID, err)
+        }
+    }
+
+    return s.deleteChunksFrom(documentID, len(chunks))
+}
+
+// DeleteDocumentChunks removes all chunks of a document.
+func (s *CouchbaseService) DeleteDocumentChunks(documentID string) error {
+    return s.deleteChunksFrom(documentID, 0)
+}
+
+func (s *CouchbaseService) deleteChunksFrom(documentID string, ordinal int) error {
+    n1qlQuery := fmt.Sprintf(`
+        DELETE FROM %s c
+        WHERE c.document_id = $1 AND c.ordinal >= $2
+    `, s.keyspace(s.chunkCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{documentID, ordinal},
+    })
+    if err != nil {
+        return fmt.Errorf("failed to delete chunks: %v", err)
+    }
+    return results.Close()
+}
+
+// ListDocumentChunks returns a document's chunks in order. A non-empty query
+// keeps only chunks containing it, ignoring case.
+func (s *CouchbaseService) ListDocumentChunks(documentID, query string) ([]models.Chunk, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT c.* FROM %s c
+        WHERE c.document_id = $1
+    `, s.keyspace(s.chunkCollectionName))
+    params := []interface{}{documentID}
+
+    if query != "" {
+        n1qlQuery += " AND CONTAINS(LOWER(c.text), $2)"
+        params = append(params, strings.ToLower(query))
+    }
+    n1qlQuery += " ORDER BY c.ordinal"
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: params,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    chunks := []models.Chunk{}
+    for results.Next() {
+        var chunk models.Chunk
+        if err := results.Row(&chunk); err != nil {
+            continue
+        }
+        chunks = append(chunks, chunk)
+    }
+
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return chunks, nil
+}
+
+// GetChunk fetches a single chunk by document and ordinal.
+func (s *CouchbaseService) GetChunk(documentID string, ordinal int) (*models.Chunk, error) {
+    result, err := s.chunkCollection.Get(ChunkID(documentID, ordinal), nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return nil, fmt.Errorf("chunk not found")
+        }
+        return nil, fmt.Errorf("failed to get chunk: %v", err)
+    }
+
+    var chunk models.Chunk
+    if err := result.Content(&chunk); err != nil {
+        return nil, fmt.Errorf("failed to decode chunk: %v", err)
+    }
+    return &chunk, nil
+}
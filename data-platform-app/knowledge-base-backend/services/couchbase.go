@@ -1,7 +1,10 @@
 package services
 
 import (
+    "encoding/json"
+    "errors"
     "fmt"
+    "strings"
     "time"
 
     "github.com/couchbase/gocb/v2"
@@ -9,16 +12,31 @@ import (
 )
 
 type CouchbaseService struct {
-    cluster        *gocb.Cluster
-    collection     *gocb.Collection
-    bucketName     string
-    scopeName      string
-    collectionName string
+    cluster               *gocb.Cluster
+    collection            *gocb.Collection
+    jobCollection         *gocb.Collection
+    bundleCollection      *gocb.Collection
+    chunkCollection       *gocb.Collection
+    queryCollection       *gocb.Collection
+    synonymCollection     *gocb.Collection
+    issueCollection       *gocb.Collection
+    versionCollection     *gocb.Collection
+    bucketName            string
+    scopeName             string
+    collectionName        string
+    jobCollectionName     string
+    bundleCollectionName  string
+    chunkCollectionName   string
+    queryCollectionName   string
+    synonymCollectionName string
+    issueCollectionName   string
+    versionCollectionName string
+    searchIndexName       string // set by EnsureSearchIndex
 }
 
 func NewCouchbaseService(
     connStr, username, password,
-    bucketName, scopeName, collectionName string,
+    bucketName, scopeName, collectionName, jobCollectionName, bundleCollectionName, chunkCollectionName, queryCollectionName, synonymCollectionName, issueCollectionName, versionCollectionName string,
 ) (*CouchbaseService, error) {
 
     options := gocb.ClusterOptions{
@@ -44,17 +62,37 @@ func NewCouchbaseService(
         return nil, fmt.Errorf("bucket not ready: %v", err)
     }
 
-    collection := bucket.Scope(scopeName).Collection(collectionName)
+    scope := bucket.Scope(scopeName)
 
     return &CouchbaseService{
-        cluster:        cluster,
-        collection:     collection,
-        bucketName:     bucketName,
-        scopeName:      scopeName,
-        collectionName: collectionName,
+        cluster:               cluster,
+        collection:            scope.Collection(collectionName),
+        jobCollection:         scope.Collection(jobCollectionName),
+        bundleCollection:      scope.Collection(bundleCollectionName),
+        chunkCollection:       scope.Collection(chunkCollectionName),
+        queryCollection:       scope.Collection(queryCollectionName),
+        synonymCollection:     scope.Collection(synonymCollectionName),
+        issueCollection:       scope.Collection(issueCollectionName),
+        versionCollection:     scope.Collection(versionCollectionName),
+        bucketName:            bucketName,
+        scopeName:             scopeName,
+        collectionName:        collectionName,
+        jobCollectionName:     jobCollectionName,
+        bundleCollectionName:  bundleCollectionName,
+        chunkCollectionName:   chunkCollectionName,
+        queryCollectionName:   queryCollectionName,
+        synonymCollectionName: synonymCollectionName,
+        issueCollectionName:   issueCollectionName,
+        versionCollectionName: versionCollectionName,
     }, nil
 }
 
+// keyspace returns the fully qualified, escaped N1QL keyspace for a collection
+// in this service's scope.
+func (s *CouchbaseService) keyspace(collectionName string) string {
+    return "`" + s.bucketName + "`.`" + s.scopeName + "`.`" + collectionName + "`"
+}
+
 func (s *CouchbaseService) SaveDocument(doc *models.Document) error {
     _, err := s.collection.Upsert(doc.ID, doc, nil)
     if err != nil {
@@ -63,9 +101,15 @@ func (s *CouchbaseService) SaveDocument(doc *models.Document) error {
     return nil
 }
 
+// ErrDocumentNotFound is returned for a document ID that does not exist.
+var ErrDocumentNotFound = errors.New("document not found")
+
 func (s *CouchbaseService) GetDocument(id string) (*models.Document, error) {
     result, err := s.collection.Get(id, nil)
     if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return nil, ErrDocumentNotFound
+        }
         return nil, fmt.Errorf("failed to get document: %v", err)
     }
 
@@ -78,84 +122,336 @@ func (s *CouchbaseService) GetDocument(id string) (*models.Document, error) {
     return &doc, nil
 }
 
-func (s *CouchbaseService) SearchDocuments(query string, product, subProduct, category string) ([]models.Document, error) {
-    n1qlQuery := fmt.Sprintf(`
-        SELECT d.* FROM %s.%s.%s d
-        WHERE (
-            LOWER(d.file_name) LIKE $1
-            OR LOWER(d.original_name) LIKE $1
-            OR LOWER(d.parsed_text) LIKE $1
-            OR ANY keyword IN d.keywords SATISFIES LOWER(keyword) LIKE $1 END
-            OR ANY error IN d.error_messages SATISFIES LOWER(error) LIKE $1 END
-        )
-    `, "`"+s.bucketName+"`", "`"+s.scopeName+"`", "`"+s.collectionName+"`")
+// maxUpdateAttempts bounds how often UpdateDocument retries when other
+// writers keep changing the document.
+const maxUpdateAttempts = 10
+
+// UpdateDocument applies update to the stored document and saves it with
+// compare-and-swap: when another writer saved the document in between, it
+// is read again and update applied to the new content.
+func (s *CouchbaseService) UpdateDocument(id string, update func(doc *models.Document)) (*models.Document, error) {
+    for attempt := 1; ; attempt++ {
+        result, err := s.collection.Get(id, nil)
+        if err != nil {
+            return nil, fmt.Errorf("failed to get document: %v", err)
+        }
 
-    params := []interface{}{
-        fmt.Sprintf("%%%s%%", query),
+        var doc models.Document
+        if err := result.Content(&doc); err != nil {
+            return nil, fmt.Errorf("failed to decode document: %v", err)
+        }
+
+        update(&doc)
+        _, err = s.collection.Replace(id, &doc, &gocb.ReplaceOptions{Cas: result.Cas()})
+        if errors.Is(err, gocb.ErrCasMismatch) && attempt < maxUpdateAttempts {
+            continue
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to save document: %v", err)
+        }
+        return &doc, nil
     }
+}
 
-    if product != "" {
-        n1qlQuery += " AND d.product = $" + fmt.Sprintf("%d", len(params)+1)
-        params = append(params, product)
+// searchDocumentsLike is the substring search used when full-text search is
+// not available. It scans every document and cannot rank results. Facets are
+// counted over everything that matched, selected ones without their own
+// selection as in the full-text backends.
+func (s *CouchbaseService) searchDocumentsLike(query QueryNode, filter SearchFilter, page Page) (*SearchResults, error) {
+    where, params := likeWhere(query, filter)
+
+    documents, err := s.queryDocuments("SELECT d.* FROM "+s.keyspace(s.collectionName)+" d"+where+page.n1qlOrder()+page.n1qlLimit(), params)
+    if err != nil {
+        return nil, err
     }
-    if subProduct != "" {
-        n1qlQuery += " AND d.sub_product = $" + fmt.Sprintf("%d", len(params)+1)
-        params = append(params, subProduct)
+    total, err := s.countDocuments(where, params)
+    if err != nil {
+        return nil, err
     }
-    if category != "" {
-        n1qlQuery += " AND d.category = $" + fmt.Sprintf("%d", len(params)+1)
-        params = append(params, category)
+    facets, err := s.likeFacets(where, params)
+    if err != nil {
+        return nil, err
     }
 
-    n1qlQuery += " ORDER BY d.uploaded_at DESC LIMIT 100"
+    // Count each selected facet as if only its own values were unrestricted
+    for _, field := range filter.selectedFields() {
+        fieldWhere, fieldParams := likeWhere(query, filter.without(field))
+        counts, err := s.likeFacets(fieldWhere, fieldParams, field)
+        if err != nil {
+            return nil, err
+        }
+        facets[field] = counts[field]
+    }
 
-    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
-        PositionalParameters: params,
-    })
-    if err != nil {
-        return nil, fmt.Errorf("failed to execute query: %v", err)
+    hits := make([]models.SearchHit, len(documents))
+    for i := range documents {
+        hits[i] = models.SearchHit{Document: documents[i], Matches: substringMatches(&documents[i], query)}
     }
+    return &SearchResults{Hits: hits, Total: total, Facets: facets}, nil
+}
 
-    var documents []models.Document
-    for results.Next() {
-        var doc models.Document
-        err := results.Row(&doc)
+// likeWhere builds the WHERE clause of the substring search and its
+// parameters.
+func likeWhere(query QueryNode, filter SearchFilter) (string, []interface{}) {
+    var params []interface{}
+    where := " WHERE " + likeCondition(query, &params)
+
+    for _, field := range facetFields {
+        if values := filter.Terms[field]; len(values) > 0 {
+            where += fmt.Sprintf(" AND d.%s IN $%d", field, len(params)+1)
+            params = append(params, values)
+        }
+    }
+    if !filter.UploadedFrom.IsZero() {
+        where += " AND STR_TO_MILLIS(d.uploaded_at) >= $" + fmt.Sprintf("%d", len(params)+1)
+        params = append(params, filter.UploadedFrom.UnixMilli())
+    }
+    if !filter.UploadedTo.IsZero() {
+        where += " AND STR_TO_MILLIS(d.uploaded_at) <= $" + fmt.Sprintf("%d", len(params)+1)
+        params = append(params, filter.UploadedTo.UnixMilli())
+    }
+    if filter.MinSize != nil {
+        where += " AND d.file_size >= $" + fmt.Sprintf("%d", len(params)+1)
+        params = append(params, *filter.MinSize)
+    }
+    if filter.MaxSize != nil {
+        where += " AND d.file_size <= $" + fmt.Sprintf("%d", len(params)+1)
+        params = append(params, *filter.MaxSize)
+    }
+    return where, params
+}
+
+// likeFacets counts the facet values of the documents matching a WHERE
+// clause, of every facet or only of the names given.
+func (s *CouchbaseService) likeFacets(where string, params []interface{}, names ...string) (map[string][]models.FacetCount, error) {
+    months := facetMonthRanges(time.Now())
+    expressions := make(map[string]string)
+    for _, field := range facetFields {
+        expressions[field] = "d." + field
+    }
+    expressions[UploadMonthFacet] = "SUBSTR(MILLIS_TO_UTC(STR_TO_MILLIS(d.uploaded_at)), 0, 7)"
+    if len(names) > 0 {
+        selected := make(map[string]string, len(names))
+        for _, name := range names {
+            selected[name] = expressions[name]
+        }
+        expressions = selected
+    }
+
+    facets := make(map[string][]models.FacetCount)
+    for name, expression := range expressions {
+        n1qlQuery := fmt.Sprintf("SELECT %s AS `value`, COUNT(*) AS `count` FROM %s d%s GROUP BY %s",
+            expression, s.keyspace(s.collectionName), where, expression)
+        results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+            PositionalParameters: params,
+        })
         if err != nil {
-            continue
+            return nil, fmt.Errorf("failed to count facet %s: %v", name, err)
+        }
+
+        counts := make(map[string]int)
+        for results.Next() {
+            var row struct {
+                Value string `json:"value"`
+                Count int    `json:"count"`
+            }
+            if err := results.Row(&row); err != nil || row.Value == "" {
+                continue
+            }
+            counts[row.Value] = row.Count
+        }
+        if err := results.Err(); err != nil {
+            return nil, fmt.Errorf("facet iteration error: %v", err)
+        }
+
+        if name == UploadMonthFacet {
+            facets[name] = monthCounts(counts, months)
+        } else {
+            facets[name] = termCounts(counts)
         }
-        documents = append(documents, doc)
     }
+    return facets, nil
+}
 
-    if err := results.Err(); err != nil {
-        return nil, fmt.Errorf("query iteration error: %v", err)
+// likeCondition compiles a parsed query into a N1QL condition for the
+// substring search, appending its parameters to params. Text terms match
+// case-insensitively anywhere in a field.
+func likeCondition(node QueryNode, params *[]interface{}) string {
+    param := func(value interface{}) string {
+        *params = append(*params, value)
+        return fmt.Sprintf("$%d", len(*params))
     }
 
-    return documents, nil
+    switch n := node.(type) {
+    case *AndNode:
+        must, mustNot, _ := splitAndClauses(n)
+        for _, clause := range mustNot {
+            must = append(must, &NotNode{Clause: clause})
+        }
+        return likeConditions(must, " AND ", params)
+    case *OrNode:
+        return likeConditions(n.Clauses, " OR ", params)
+    case *NotNode:
+        return "NOT " + likeCondition(n.Clause, params)
+    case *DateRangeNode:
+        var conditions []string
+        if !n.From.IsZero() {
+            conditions = append(conditions, fmt.Sprintf("STR_TO_MILLIS(d.%s) >= %s", n.Field, param(n.From.UnixMilli())))
+        }
+        if !n.To.IsZero() {
+            conditions = append(conditions, fmt.Sprintf("STR_TO_MILLIS(d.%s) < %s", n.Field, param(n.To.UnixMilli())))
+        }
+        return "(" + strings.Join(conditions, " AND ") + ")"
+    case *TermNode:
+        if IsFacetField(n.Field) {
+            if n.Wildcard {
+                return fmt.Sprintf("d.%s LIKE %s", n.Field, param(likePattern(n.Text, false)))
+            }
+            return fmt.Sprintf("d.%s = %s", n.Field, param(n.Text))
+        }
+
+        pattern := param(likePattern(strings.ToLower(n.Text), true))
+        switch n.Field {
+        case "keywords", "error_messages":
+            return fmt.Sprintf("ANY v IN d.%s SATISFIES LOWER(v) LIKE %s END", n.Field, pattern)
+        }
+        if strings.HasPrefix(n.Field, "errors.") {
+            // A field of the error records, e.g. errors.exception_class
+            return fmt.Sprintf("ANY e IN d.errors SATISFIES LOWER(e.%s) LIKE %s END", strings.TrimPrefix(n.Field, "errors."), pattern)
+        }
+        return fmt.Sprintf(`(
+            LOWER(d.file_name) LIKE %[1]s
+            OR LOWER(d.original_name) LIKE %[1]s
+            OR LOWER(d.parsed_text) LIKE %[1]s
+            OR ANY keyword IN d.keywords SATISFIES LOWER(keyword) LIKE %[1]s END
+            OR ANY error IN d.error_messages SATISFIES LOWER(error) LIKE %[1]s END
+            OR ANY e IN d.errors SATISFIES LOWER(e.exception_class) LIKE %[1]s END
+        )`, pattern)
+    }
+    return "FALSE"
 }
 
-func (s *CouchbaseService) ListDocumentsByPath(product, subProduct, category string) ([]models.Document, error) {
-    n1qlQuery := fmt.Sprintf(`
-        SELECT d.* FROM %s.%s.%s d
-        WHERE 1=1
-    `, "`"+s.bucketName+"`", "`"+s.scopeName+"`", "`"+s.collectionName+"`")
+func likeConditions(clauses []QueryNode, op string, params *[]interface{}) string {
+    conditions := make([]string, len(clauses))
+    for i, clause := range clauses {
+        conditions[i] = likeCondition(clause, params)
+    }
+    return "(" + strings.Join(conditions, op) + ")"
+}
+
+// likePattern escapes text for LIKE, turning the query wildcards * and ? into
+// % and _. Substring patterns match anywhere in the value.
+func likePattern(text string, substring bool) string {
+    var pattern strings.Builder
+    if substring {
+        pattern.WriteString("%")
+    }
+    for _, r := range text {
+        switch r {
+        case '%', '_', '\\':
+            pattern.WriteRune('\\')
+            pattern.WriteRune(r)
+        case '*':
+            pattern.WriteRune('%')
+        case '?':
+            pattern.WriteRune('_')
+        default:
+            pattern.WriteRune(r)
+        }
+    }
+    if substring {
+        pattern.WriteString("%")
+    }
+    return pattern.String()
+}
 
+// ListDocumentsByPath returns one page of the documents in a folder and how
+// many the folder holds in total.
+func (s *CouchbaseService) ListDocumentsByPath(product, subProduct, category string, page Page) ([]models.Document, int, error) {
+    where := " WHERE 1=1"
     var params []interface{}
-    
+
     if product != "" {
-        n1qlQuery += " AND d.product = $" + fmt.Sprintf("%d", len(params)+1)
+        where += " AND d.product = $" + fmt.Sprintf("%d", len(params)+1)
         params = append(params, product)
     }
     if subProduct != "" {
-        n1qlQuery += " AND d.sub_product = $" + fmt.Sprintf("%d", len(params)+1)
+        where += " AND d.sub_product = $" + fmt.Sprintf("%d", len(params)+1)
         params = append(params, subProduct)
     }
     if category != "" {
-        n1qlQuery += " AND d.category = $" + fmt.Sprintf("%d", len(params)+1)
+        where += " AND d.category = $" + fmt.Sprintf("%d", len(params)+1)
         params = append(params, category)
     }
 
-    n1qlQuery += " ORDER BY d.uploaded_at DESC"
+    documents, err := s.queryDocuments("SELECT d.* FROM "+s.keyspace(s.collectionName)+" d"+where+page.n1qlOrder()+page.n1qlLimit(), params)
+    if err != nil {
+        return nil, 0, err
+    }
+    total, err := s.countDocuments(where, params)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    return documents, total, nil
+}
+
+// FindDocumentByHash returns the earliest uploaded document with the given
+// content hash, or nil when there is none.
+func (s *CouchbaseService) FindDocumentByHash(contentHash string) (*models.Document, error) {
+    return s.findDocument(
+        "SELECT d.* FROM "+s.keyspace(s.collectionName)+" d WHERE d.content_hash = $1 ORDER BY d.uploaded_at LIMIT 1",
+        []interface{}{contentHash},
+    )
+}
+
+// FindDocumentByName returns the document uploaded directly, not from an
+// archive, with the given file name in a folder, or nil when there is none.
+func (s *CouchbaseService) FindDocumentByName(product, subProduct, category, fileName string) (*models.Document, error) {
+    return s.findDocument(
+        "SELECT d.* FROM "+s.keyspace(s.collectionName)+` d
+        WHERE d.product = $1 AND d.sub_product = $2 AND d.category = $3 AND d.file_name = $4
+            AND IFMISSINGORNULL(d.bundle_id, "") = ""
+        ORDER BY d.uploaded_at LIMIT 1`,
+        []interface{}{product, subProduct, category, fileName},
+    )
+}
+
+// GCSPathInUse reports whether a document other than exceptID stores any of
+// its versions at a GCS path; linked duplicates share their original's.
+func (s *CouchbaseService) GCSPathInUse(gcsPath, exceptID string) (bool, error) {
+    count, err := s.countDocuments(
+        " WHERE META(d).id != $2 AND (d.gcs_path = $1 OR ANY v IN d.versions SATISFIES v.gcs_path = $1 END)",
+        []interface{}{gcsPath, exceptID},
+    )
+    return count > 0, err
+}
+
+// findDocument runs a N1QL query selecting at most one whole document, or
+// nil when none matches. Uploads use it to find what an earlier upload
+// stored, so it waits for the index to include recent writes; otherwise two
+// uploads seconds apart both miss each other.
+func (s *CouchbaseService) findDocument(n1qlQuery string, params []interface{}) (*models.Document, error) {
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: params,
+        ScanConsistency:      gocb.QueryScanConsistencyRequestPlus,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    var doc models.Document
+    if err := results.One(&doc); err != nil {
+        if errors.Is(err, gocb.ErrNoResult) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to read document: %v", err)
+    }
+    return &doc, nil
+}
 
+// queryDocuments runs a N1QL query selecting whole documents.
+func (s *CouchbaseService) queryDocuments(n1qlQuery string, params []interface{}) ([]models.Document, error) {
     results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
         PositionalParameters: params,
     })
@@ -163,7 +459,7 @@ func (s *CouchbaseService) ListDocumentsByPath(product, subProduct, category str
         return nil, fmt.Errorf("failed to execute query: %v", err)
     }
 
-    var documents []models.Document
+    documents := []models.Document{}
     for results.Next() {
         var doc models.Document
         err := results.Row(&doc)
@@ -180,6 +476,72 @@ func (s *CouchbaseService) ListDocumentsByPath(product, subProduct, category str
     return documents, nil
 }
 
+// countDocuments counts the documents, aliased d, matching a WHERE clause.
+func (s *CouchbaseService) countDocuments(where string, params []interface{}) (int, error) {
+    results, err := s.cluster.Query("SELECT RAW COUNT(*) FROM "+s.keyspace(s.collectionName)+" d"+where, &gocb.QueryOptions{
+        PositionalParameters: params,
+    })
+    if err != nil {
+        return 0, fmt.Errorf("failed to count documents: %v", err)
+    }
+
+    var count int
+    if err := results.One(&count); err != nil {
+        return 0, fmt.Errorf("failed to read document count: %v", err)
+    }
+    return count, nil
+}
+
+// ForEachDocument calls fn for every document, paging through the
+// collection by key so large collections are never loaded at once.
+func (s *CouchbaseService) ForEachDocument(fn func(doc *models.Document) error) error {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT META(d).id AS meta_id, d AS doc FROM %s d
+        WHERE META(d).id > $1
+        ORDER BY META(d).id
+        LIMIT 500
+    `, s.keyspace(s.collectionName))
+
+    lastID := ""
+    for {
+        results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+            PositionalParameters: []interface{}{lastID},
+        })
+        if err != nil {
+            return fmt.Errorf("failed to execute query: %v", err)
+        }
+
+        count := 0
+        for results.Next() {
+            var row struct {
+                MetaID string          `json:"meta_id"`
+                Doc    json.RawMessage `json:"doc"`
+            }
+            if err := results.Row(&row); err != nil {
+                continue
+            }
+            count++
+            lastID = row.MetaID
+
+            var doc models.Document
+            if err := json.Unmarshal(row.Doc, &doc); err != nil {
+                continue
+            }
+            if err := fn(&doc); err != nil {
+                results.Close()
+                return err
+            }
+        }
+        if err := results.Err(); err != nil {
+            return fmt.Errorf("query iteration error: %v", err)
+        }
+
+        if count < 500 {
+            return nil
+        }
+    }
+}
+
 // Add this method to CouchbaseService
 
 func (s *CouchbaseService) DeleteDocument(id string) error {
@@ -0,0 +1,49 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+func TestLikeWhereWithoutFacet(t *testing.T) {
+    query, err := ParseQuery("kerberos")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    filter := SearchFilter{Terms: map[string][]string{
+        "product":   {"cdp"},
+        "file_type": {".pdf", ".docx"},
+    }}
+
+    tests := []struct {
+        name        string
+        filter      SearchFilter
+        contains    []string
+        notContains []string
+    }{
+        {"whole filter", filter, []string{"d.product IN", "d.file_type IN"}, nil},
+        {"without product", filter.without("product"), []string{"d.file_type IN"}, []string{"d.product IN"}},
+        {"without file type", filter.without("file_type"), []string{"d.product IN"}, []string{"d.file_type IN"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            where, params := likeWhere(query, tt.filter)
+            for _, want := range tt.contains {
+                if !strings.Contains(where, want) {
+                    t.Errorf("missing %q in %s", want, where)
+                }
+            }
+            for _, unwanted := range tt.notContains {
+                if strings.Contains(where, unwanted) {
+                    t.Errorf("unexpected %q in %s", unwanted, where)
+                }
+            }
+            last := fmt.Sprintf("$%d", len(params))
+            if !strings.Contains(where, last) || strings.Contains(where, fmt.Sprintf("$%d", len(params)+1)) {
+                t.Errorf("placeholders do not match %d parameters in %s", len(params), where)
+            }
+        })
+    }
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+
+    "knowledge-base-backend/models"
+)
+
+// Units a version diff compares.
+const (
+    DiffUnitLine      = "line"
+    DiffUnitParagraph = "paragraph"
+)
+
+const (
+    // diffContext is how many unchanged lines or paragraphs surround the
+    // changes of a hunk.
+    diffContext = 3
+    // maxDiffEdits bounds the work of a diff. Past it, the differing middle
+    // of the texts is reported as removed and added as a whole.
+    maxDiffEdits = 2000
+)
+
+const (
+    opEqual  = "equal"
+    opDelete = "delete"
+    opInsert = "insert"
+)
+
+var paragraphBreak = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// diffEdit is one step of turning a into b. A and B are the positions in a
+// and b before the step.
+type diffEdit struct {
+    Op   string
+    A, B int
+}
+
+// IsDiffUnit reports whether unit is a unit versions can be compared by.
+func IsDiffUnit(unit string) bool {
+    return unit == DiffUnitLine || unit == DiffUnitParagraph
+}
+
+// DiffVersions compares the parsed text of two versions of a document by
+// line or by paragraph and summarizes the keywords and error messages one
+// has and the other does not. unified renders the hunks as unified diff
+// text instead.
+func DiffVersions(fileName string, from, to *models.VersionText, unit string, unified bool) *models.VersionDiff {
+    a := splitDiffUnits(from.ParsedText, unit)
+    b := splitDiffUnits(to.ParsedText, unit)
+    edits := diffUnits(a, b)
+
+    diff := &models.VersionDiff{
+        DocumentID:      to.DocumentID,
+        From:            from.Version,
+        To:              to.Version,
+        Unit:            unit,
+        KeywordsAdded:   missingFrom(to.Keywords, from.Keywords),
+        KeywordsRemoved: missingFrom(from.Keywords, to.Keywords),
+        ErrorsAdded:     missingFrom(to.ErrorMessages, from.ErrorMessages),
+        ErrorsRemoved:   missingFrom(from.ErrorMessages, to.ErrorMessages),
+    }
+    for _, edit := range edits {
+        switch edit.Op {
+        case opInsert:
+            diff.Added++
+        case opDelete:
+            diff.Removed++
+        }
+    }
+
+    hunks := diffHunks(edits, a, b)
+    if unified {
+        diff.Unified = unifiedDiff(fmt.Sprintf("%s (version %d)", fileName, from.Version), fmt.Sprintf("%s (version %d)", fileName, to.Version), hunks)
+    } else {
+        diff.Hunks = hunks
+    }
+    return diff
+}
+
+// splitDiffUnits splits text into lines, or into paragraphs separated by
+// blank lines.
+func splitDiffUnits(text, unit string) []string {
+    text = strings.ReplaceAll(text, "\r\n", "\n")
+    if strings.TrimSpace(text) == "" {
+        return nil
+    }
+    if unit == DiffUnitParagraph {
+        return paragraphBreak.Split(strings.TrimSpace(text), -1)
+    }
+    return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffUnits finds a shortest edit script turning a into b with Myers'
+// algorithm, after setting aside the unchanged start and end.
+func diffUnits(a, b []string) []diffEdit {
+    prefix := 0
+    for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+        prefix++
+    }
+    suffix := 0
+    for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+        suffix++
+    }
+
+    var edits []diffEdit
+    for i := 0; i < prefix; i++ {
+        edits = append(edits, diffEdit{Op: opEqual, A: i, B: i})
+    }
+    for _, edit := range myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+        edit.A += prefix
+        edit.B += prefix
+        edits = append(edits, edit)
+    }
+    for i := 0; i < suffix; i++ {
+        edits = append(edits, diffEdit{Op: opEqual, A: len(a) - suffix + i, B: len(b) - suffix + i})
+    }
+    return edits
+}
+
+func myersDiff(a, b []string) []diffEdit {
+    n, m := len(a), len(b)
+    maxD := min(n+m, maxDiffEdits)
+
+    // v[k+maxD] is the furthest x reached on diagonal k = x-y; trace keeps
+    // v as it was before each round, for walking back from the end
+    v := make([]int, 2*maxD+2)
+    var trace [][]int
+    for d := 0; d <= maxD; d++ {
+        trace = append(trace, append([]int(nil), v[maxD-d:maxD+d+1]...))
+        for k := -d; k <= d; k += 2 {
+            var x int
+            if k == -d || (k != d && v[maxD+k-1] < v[maxD+k+1]) {
+                x = v[maxD+k+1]
+            } else {
+                x = v[maxD+k-1] + 1
+            }
+            y := x - k
+            for x < n && y < m && a[x] == b[y] {
+                x++
+                y++
+            }
+            v[maxD+k] = x
+            if x >= n && y >= m {
+                return backtrackDiff(trace, n, m)
+            }
+        }
+    }
+
+    // Too different to be worth aligning
+    edits := make([]diffEdit, 0, n+m)
+    for i := 0; i < n; i++ {
+        edits = append(edits, diffEdit{Op: opDelete, A: i, B: 0})
+    }
+    for j := 0; j < m; j++ {
+        edits = append(edits, diffEdit{Op: opInsert, A: n, B: j})
+    }
+    return edits
+}
+
+func backtrackDiff(trace [][]int, n, m int) []diffEdit {
+    var edits []diffEdit
+    x, y := n, m
+    for d := len(trace) - 1; d > 0; d-- {
+        v := trace[d] // diagonals -d..d before round d
+        k := x - y
+        prevK := k - 1
+        if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+            prevK = k + 1
+        }
+        prevX := v[prevK+d]
+        prevY := prevX - prevK
+
+        for x > prevX && y > prevY {
+            x--
+            y--
+            edits = append(edits, diffEdit{Op: opEqual, A: x, B: y})
+        }
+        if x == prevX {
+            y--
+            edits = append(edits, diffEdit{Op: opInsert, A: x, B: y})
+        } else {
+            x--
+            edits = append(edits, diffEdit{Op: opDelete, A: x, B: y})
+        }
+    }
+    for x > 0 && y > 0 {
+        x--
+        y--
+        edits = append(edits, diffEdit{Op: opEqual, A: x, B: y})
+    }
+
+    for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+        edits[i], edits[j] = edits[j], edits[i]
+    }
+    return edits
+}
+
+// diffHunks groups the changes of an edit script with diffContext unchanged
+// units around them, merging changes that close together.
+func diffHunks(edits []diffEdit, a, b []string) []models.DiffHunk {
+    hunks := []models.DiffHunk{}
+    for i := 0; i < len(edits); {
+        if edits[i].Op == opEqual {
+            i++
+            continue
+        }
+
+        start := max(i-diffContext, 0)
+        end := i + 1
+        for j := i + 1; j < len(edits); j++ {
+            if edits[j].Op != opEqual {
+                end = j + 1
+            } else if j-end >= 2*diffContext {
+                break
+            }
+        }
+        stop := min(end+diffContext, len(edits))
+
+        hunk := models.DiffHunk{FromStart: edits[start].A + 1, ToStart: edits[start].B + 1}
+        for _, edit := range edits[start:stop] {
+            switch edit.Op {
+            case opEqual:
+                hunk.FromCount++
+                hunk.ToCount++
+                hunk.Lines = append(hunk.Lines, models.DiffLine{Op: opEqual, Text: a[edit.A]})
+            case opDelete:
+                hunk.FromCount++
+                hunk.Lines = append(hunk.Lines, models.DiffLine{Op: opDelete, Text: a[edit.A]})
+            case opInsert:
+                hunk.ToCount++
+                hunk.Lines = append(hunk.Lines, models.DiffLine{Op: opInsert, Text: b[edit.B]})
+            }
+        }
+        // An empty side starts at the line it follows, as in unified diffs
+        if hunk.FromCount == 0 {
+            hunk.FromStart--
+        }
+        if hunk.ToCount == 0 {
+            hunk.ToStart--
+        }
+        hunks = append(hunks, hunk)
+        i = stop
+    }
+    return hunks
+}
+
+// unifiedDiff renders hunks as unified diff text. Every line of a
+// multi-line paragraph carries its paragraph's marker.
+func unifiedDiff(fromName, toName string, hunks []models.DiffHunk) string {
+    if len(hunks) == 0 {
+        return ""
+    }
+
+    var out strings.Builder
+    fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+    markers := map[string]string{opEqual: " ", opDelete: "-", opInsert: "+"}
+    for _, hunk := range hunks {
+        fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", hunk.FromStart, hunk.FromCount, hunk.ToStart, hunk.ToCount)
+        for _, line := range hunk.Lines {
+            for _, text := range strings.Split(line.Text, "\n") {
+                out.WriteString(markers[line.Op] + text + "\n")
+            }
+        }
+    }
+    return out.String()
+}
+
+// missingFrom returns the values of a that b lacks, in order.
+func missingFrom(a, b []string) []string {
+    present := make(map[string]bool, len(b))
+    for _, value := range b {
+        present[value] = true
+    }
+    missing := []string{}
+    for _, value := range a {
+        if !present[value] {
+            missing = append(missing, value)
+            present[value] = true
+        }
+    }
+    return missing
+}
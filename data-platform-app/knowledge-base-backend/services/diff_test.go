@@ -0,0 +1,235 @@
+package services
+
+import (
+    "fmt"
+    "math/rand"
+    "slices"
+    "strings"
+    "testing"
+
+    "knowledge-base-backend/models"
+)
+
+// describeEdits renders an edit script as e.g. "=a -b +c".
+func describeEdits(edits []diffEdit, a, b []string) string {
+    parts := make([]string, len(edits))
+    for i, edit := range edits {
+        switch edit.Op {
+        case opEqual:
+            parts[i] = "=" + a[edit.A]
+        case opDelete:
+            parts[i] = "-" + a[edit.A]
+        case opInsert:
+            parts[i] = "+" + b[edit.B]
+        }
+    }
+    return strings.Join(parts, " ")
+}
+
+// numberedLines returns the lines "1" to "n".
+func numberedLines(n int) []string {
+    lines := make([]string, n)
+    for i := range lines {
+        lines[i] = fmt.Sprint(i + 1)
+    }
+    return lines
+}
+
+func TestDiffUnits(t *testing.T) {
+    tests := []struct {
+        a, b string
+        want string
+    }{
+        {"", "", ""},
+        {"a b c", "a b c", "=a =b =c"},
+        {"", "a b", "+a +b"},
+        {"a b", "", "-a -b"},
+        {"a b c", "a x c", "=a -b +x =c"},
+        {"a b c d", "a c d", "=a -b =c =d"},
+        {"a b c", "x a b c", "+x =a =b =c"},
+        {"a b c a b b a", "c b a b a c", "-a -b =c +b =a =b -b =a +c"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+            a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+            if got := describeEdits(diffUnits(a, b), a, b); got != tt.want {
+                t.Errorf("got %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+// lcsLength is the textbook dynamic program, to check that diffUnits
+// finds a shortest edit script.
+func lcsLength(a, b []string) int {
+    table := make([][]int, len(a)+1)
+    for i := range table {
+        table[i] = make([]int, len(b)+1)
+    }
+    for i := len(a) - 1; i >= 0; i-- {
+        for j := len(b) - 1; j >= 0; j-- {
+            if a[i] == b[j] {
+                table[i][j] = table[i+1][j+1] + 1
+            } else {
+                table[i][j] = max(table[i+1][j], table[i][j+1])
+            }
+        }
+    }
+    return table[0][0]
+}
+
+func TestDiffUnitsRandom(t *testing.T) {
+    random := rand.New(rand.NewSource(1))
+    randomLines := func() []string {
+        lines := make([]string, random.Intn(30))
+        for i := range lines {
+            lines[i] = string(rune('a' + random.Intn(4)))
+        }
+        return lines
+    }
+
+    for i := 0; i < 500; i++ {
+        a, b := randomLines(), randomLines()
+        edits := diffUnits(a, b)
+
+        var fromA, fromB []string
+        changes := 0
+        for _, edit := range edits {
+            switch edit.Op {
+            case opEqual:
+                if a[edit.A] != b[edit.B] {
+                    t.Fatalf("%v -> %v: equal edit pairs %q with %q", a, b, a[edit.A], b[edit.B])
+                }
+                fromA = append(fromA, a[edit.A])
+                fromB = append(fromB, b[edit.B])
+            case opDelete:
+                fromA = append(fromA, a[edit.A])
+                changes++
+            case opInsert:
+                fromB = append(fromB, b[edit.B])
+                changes++
+            }
+        }
+        if !slices.Equal(fromA, a) || !slices.Equal(fromB, b) {
+            t.Fatalf("%v -> %v: edits do not rebuild both sides: %s", a, b, describeEdits(edits, a, b))
+        }
+        if want := len(a) + len(b) - 2*lcsLength(a, b); changes != want {
+            t.Fatalf("%v -> %v: %d changes, shortest is %d", a, b, changes, want)
+        }
+    }
+}
+
+func TestDiffUnitsTooDifferent(t *testing.T) {
+    // Past maxDiffEdits the middle is replaced as a whole
+    a, b := make([]string, maxDiffEdits), make([]string, maxDiffEdits)
+    for i := range a {
+        a[i] = fmt.Sprintf("a%d", i)
+        b[i] = fmt.Sprintf("b%d", i)
+    }
+    a = append([]string{"same"}, a...)
+    b = append([]string{"same"}, b...)
+
+    edits := diffUnits(a, b)
+    if len(edits) != 1+2*maxDiffEdits || edits[0].Op != opEqual {
+        t.Fatalf("got %d edits starting with %s", len(edits), edits[0].Op)
+    }
+    for i, edit := range edits[1:] {
+        want := opDelete
+        if i >= maxDiffEdits {
+            want = opInsert
+        }
+        if edit.Op != want {
+            t.Fatalf("edit %d is %s, want %s", i+1, edit.Op, want)
+        }
+    }
+}
+
+func TestDiffHunks(t *testing.T) {
+    replace := func(lines []string, at ...int) []string {
+        changed := slices.Clone(lines)
+        for _, i := range at {
+            changed[i-1] = "x" + changed[i-1]
+        }
+        return changed
+    }
+    lines := numberedLines(30)
+
+    tests := []struct {
+        name string
+        b    []string
+        want []string // @@ headers
+    }{
+        {"unchanged", lines, nil},
+        {"one change", replace(lines, 10), []string{"-7,7 +7,7"}},
+        {"at the start", replace(lines, 1), []string{"-1,4 +1,4"}},
+        {"at the end", replace(lines, 30), []string{"-27,4 +27,4"}},
+        {"six lines apart merge", replace(lines, 10, 17), []string{"-7,14 +7,14"}},
+        {"seven lines apart split", replace(lines, 10, 18), []string{"-7,7 +7,7", "-15,7 +15,7"}},
+        {"insertion", slices.Insert(slices.Clone(lines), 10, "new"), []string{"-8,6 +8,7"}},
+        {"deletion", slices.Delete(slices.Clone(lines), 9, 10), []string{"-7,7 +7,6"}},
+        {"everything removed", nil, []string{"-1,30 +0,0"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            hunks := diffHunks(diffUnits(lines, tt.b), lines, tt.b)
+            var got []string
+            for _, hunk := range hunks {
+                got = append(got, fmt.Sprintf("-%d,%d +%d,%d", hunk.FromStart, hunk.FromCount, hunk.ToStart, hunk.ToCount))
+            }
+            if !slices.Equal(got, tt.want) {
+                t.Errorf("got hunks %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestDiffVersions(t *testing.T) {
+    from := &models.VersionText{
+        DocumentID:    "doc",
+        Version:       1,
+        ParsedText:    "Install the agent.\nRestart it.\n\nCheck the logs.\n",
+        Keywords:      []string{"agent", "logs"},
+        ErrorMessages: []string{"connection refused"},
+    }
+    to := &models.VersionText{
+        DocumentID:    "doc",
+        Version:       2,
+        ParsedText:    "Install the agent.\nRestart the service.\n\nCheck the logs.\n",
+        Keywords:      []string{"agent", "service"},
+        ErrorMessages: []string{"connection refused", "timeout"},
+    }
+
+    t.Run("lines", func(t *testing.T) {
+        diff := DiffVersions("guide.pdf", from, to, DiffUnitLine, false)
+        if diff.Added != 1 || diff.Removed != 1 || len(diff.Hunks) != 1 {
+            t.Fatalf("got +%d -%d in %d hunks", diff.Added, diff.Removed, len(diff.Hunks))
+        }
+        if !slices.Equal(diff.KeywordsAdded, []string{"service"}) || !slices.Equal(diff.KeywordsRemoved, []string{"logs"}) {
+            t.Errorf("keywords +%v -%v", diff.KeywordsAdded, diff.KeywordsRemoved)
+        }
+        if !slices.Equal(diff.ErrorsAdded, []string{"timeout"}) || len(diff.ErrorsRemoved) != 0 {
+            t.Errorf("errors +%v -%v", diff.ErrorsAdded, diff.ErrorsRemoved)
+        }
+    })
+
+    t.Run("paragraphs", func(t *testing.T) {
+        diff := DiffVersions("guide.pdf", from, to, DiffUnitParagraph, false)
+        if diff.Added != 1 || diff.Removed != 1 {
+            t.Fatalf("got +%d -%d", diff.Added, diff.Removed)
+        }
+        if got := diff.Hunks[0].Lines[0]; got.Op != opDelete || got.Text != "Install the agent.\nRestart it." {
+            t.Errorf("first line %+v", got)
+        }
+    })
+
+    t.Run("unified", func(t *testing.T) {
+        diff := DiffVersions("guide.pdf", from, to, DiffUnitLine, true)
+        want := "--- guide.pdf (version 1)\n+++ guide.pdf (version 2)\n" +
+            "@@ -1,4 +1,4 @@\n Install the agent.\n-Restart it.\n+Restart the service.\n \n Check the logs.\n"
+        if diff.Unified != want || diff.Hunks != nil {
+            t.Errorf("got\n%s\nwant\n%s", diff.Unified, want)
+        }
+    })
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+    "sort"
+    "time"
+
+    "knowledge-base-backend/models"
+)
+
+// facetFields are the keyword fields search results are counted by. They
+// hold exact values rather than analyzed text, and filters on them accept
+// several values, any of which may match.
+var facetFields = []string{"product", "sub_product", "category", "file_type", "status", "uploaded_by"}
+
+const (
+    // UploadMonthFacet counts results per calendar month of upload.
+    UploadMonthFacet = "uploaded_month"
+    // facetSize caps the values returned per facet.
+    facetSize = 50
+    // facetMonths is how many months back the upload month facet reaches.
+    facetMonths = 24
+)
+
+// IsFacetField reports whether results can be filtered and counted by field.
+func IsFacetField(field string) bool {
+    for _, name := range facetFields {
+        if name == field {
+            return true
+        }
+    }
+    return false
+}
+
+// without returns a copy of the filter that accepts any value of field. A
+// multi-select facet is counted this way, so picking one value still shows
+// how many results the others would add.
+func (f SearchFilter) without(field string) SearchFilter {
+    terms := make(map[string][]string, len(f.Terms))
+    for name, values := range f.Terms {
+        if name != field {
+            terms[name] = values
+        }
+    }
+    f.Terms = terms
+    return f
+}
+
+// selectedFields returns the facet fields the filter restricts.
+func (f SearchFilter) selectedFields() []string {
+    var fields []string
+    for _, field := range facetFields {
+        if len(f.Terms[field]) > 0 {
+            fields = append(fields, field)
+        }
+    }
+    return fields
+}
+
+type monthRange struct {
+    name       string // 2006-01
+    start, end time.Time
+}
+
+// facetMonthRanges returns the upload month buckets, newest first.
+func facetMonthRanges(now time.Time) []monthRange {
+    now = now.UTC()
+    month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+    months := make([]monthRange, facetMonths)
+    for i := range months {
+        months[i] = monthRange{
+            name:  month.Format("2006-01"),
+            start: month,
+            end:   month.AddDate(0, 1, 0),
+        }
+        month = month.AddDate(0, -1, 0)
+    }
+    return months
+}
+
+// monthCounts orders upload month counts newest first, leaving out empty
+// months.
+func monthCounts(counts map[string]int, months []monthRange) []models.FacetCount {
+    facet := []models.FacetCount{}
+    for _, month := range months {
+        if counts[month.name] > 0 {
+            facet = append(facet, models.FacetCount{Value: month.name, Count: counts[month.name]})
+        }
+    }
+    return facet
+}
+
+// termCounts orders value counts by count, then value, keeping the top
+// facetSize.
+func termCounts(counts map[string]int) []models.FacetCount {
+    facet := make([]models.FacetCount, 0, len(counts))
+    for value, count := range counts {
+        facet = append(facet, models.FacetCount{Value: value, Count: count})
+    }
+    sort.Slice(facet, func(i, j int) bool {
+        if facet[i].Count != facet[j].Count {
+            return facet[i].Count > facet[j].Count
+        }
+        return facet[i].Value < facet[j].Value
+    })
+    if len(facet) > facetSize {
+        facet = facet[:facetSize]
+    }
+    return facet
+}
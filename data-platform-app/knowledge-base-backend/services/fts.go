@@ -0,0 +1,462 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/couchbase/gocb/v2"
+    "github.com/couchbase/gocb/v2/search"
+    "knowledge-base-backend/models"
+)
+
+// searchIndexVersion is part of the FTS index name. Bump it whenever the
+// mapping below changes so the new mapping is built as a fresh index.
+const searchIndexVersion = 4
+
+// EnsureSearchIndex creates the versioned FTS index for the document
+// collection if it does not exist yet, drops indexes left by older mapping
+// versions and switches SearchDocuments to full-text search. Without it, or
+// when it fails, search falls back to substring matching.
+func (s *CouchbaseService) EnsureSearchIndex(baseName string) error {
+    manager := s.scope().SearchIndexes()
+    name := fmt.Sprintf("%s_v%d", baseName, searchIndexVersion)
+
+    if _, err := manager.GetIndex(name, nil); err != nil {
+        if !errors.Is(err, gocb.ErrIndexNotFound) {
+            return fmt.Errorf("failed to get search index: %v", err)
+        }
+        if err := manager.UpsertIndex(s.searchIndexDefinition(name), nil); err != nil {
+            return fmt.Errorf("failed to create search index: %v", err)
+        }
+        log.Printf("Created search index %s", name)
+    }
+
+    indexes, err := manager.GetAllIndexes(nil)
+    if err == nil {
+        for _, index := range indexes {
+            if strings.HasPrefix(index.Name, baseName+"_v") && index.Name != name {
+                if err := manager.DropIndex(index.Name, nil); err != nil {
+                    log.Printf("Failed to drop old search index %s: %v", index.Name, err)
+                } else {
+                    log.Printf("Dropped old search index %s", index.Name)
+                }
+            }
+        }
+    }
+
+    s.searchIndexName = name
+    return nil
+}
+
+func (s *CouchbaseService) scope() *gocb.Scope {
+    return s.cluster.Bucket(s.bucketName).Scope(s.scopeName)
+}
+
+// searchIndexDefinition maps the searchable document fields. Names are split
+// on punctuation so "kafka_broker.log" matches "kafka", prose fields use the
+// English analyzer for stemming and the facet fields are exact keywords for
+// filtering and counting.
+func (s *CouchbaseService) searchIndexDefinition(name string) gocb.SearchIndex {
+    textField := func(field, analyzer string) map[string]interface{} {
+        return map[string]interface{}{
+            "enabled": true,
+            "dynamic": false,
+            "fields": []interface{}{map[string]interface{}{
+                "name":                 field,
+                "type":                 "text",
+                "analyzer":             analyzer,
+                "index":                true,
+                "include_term_vectors": true,
+                "include_in_all":       false,
+            }},
+        }
+    }
+    // file_name is also indexed whole and lowercased for sorting
+    fileNameField := textField("file_name", "file_name")
+    fileNameField["fields"] = append(fileNameField["fields"].([]interface{}), map[string]interface{}{
+        "name":           "file_name_sort",
+        "type":           "text",
+        "analyzer":       "sort_key",
+        "index":          true,
+        "docvalues":      true,
+        "include_in_all": false,
+    })
+    typedField := func(field, fieldType string) map[string]interface{} {
+        return map[string]interface{}{
+            "enabled": true,
+            "dynamic": false,
+            "fields": []interface{}{map[string]interface{}{
+                "name":      field,
+                "type":      fieldType,
+                "analyzer":  "keyword",
+                "index":     true,
+                "docvalues": true,
+            }},
+        }
+    }
+
+    return gocb.SearchIndex{
+        Name:       name,
+        Type:       "fulltext-index",
+        SourceType: "gocbcore",
+        SourceName: s.bucketName,
+        Params: map[string]interface{}{
+            "doc_config": map[string]interface{}{
+                "mode":       "scope.collection.type_field",
+                "type_field": "type",
+            },
+            "mapping": map[string]interface{}{
+                "default_analyzer": "standard",
+                "default_mapping": map[string]interface{}{
+                    "enabled": false,
+                    "dynamic": false,
+                },
+                "index_dynamic": false,
+                "store_dynamic": false,
+                "analysis": map[string]interface{}{
+                    "analyzers": map[string]interface{}{
+                        "file_name": map[string]interface{}{
+                            "type":          "custom",
+                            "tokenizer":     "file_name",
+                            "token_filters": []string{"to_lower"},
+                        },
+                        "sort_key": map[string]interface{}{
+                            "type":          "custom",
+                            "tokenizer":     "single",
+                            "token_filters": []string{"to_lower"},
+                        },
+                    },
+                    "tokenizers": map[string]interface{}{
+                        "file_name": map[string]interface{}{
+                            "type":   "regexp",
+                            "regexp": `[\p{L}\p{N}]+`,
+                        },
+                    },
+                },
+                "types": map[string]interface{}{
+                    s.scopeName + "." + s.collectionName: map[string]interface{}{
+                        "enabled": true,
+                        "dynamic": false,
+                        "properties": map[string]interface{}{
+                            "file_name":      fileNameField,
+                            "original_name":  textField("original_name", "file_name"),
+                            "keywords":       textField("keywords", "en"),
+                            "error_messages": textField("error_messages", "en"),
+                            "parsed_text":    textField("parsed_text", "en"),
+                            "errors": map[string]interface{}{
+                                "enabled": true,
+                                "dynamic": false,
+                                "properties": map[string]interface{}{
+                                    "exception_class": textField("exception_class", "file_name"),
+                                    "message":         textField("message", "en"),
+                                    "error_code":      textField("error_code", "sort_key"),
+                                    "log_level":       textField("log_level", "sort_key"),
+                                    "component":       textField("component", "file_name"),
+                                    "first_frame":     textField("first_frame", "file_name"),
+                                },
+                            },
+                            "product":     typedField("product", "text"),
+                            "sub_product": typedField("sub_product", "text"),
+                            "category":    typedField("category", "text"),
+                            "file_type":   typedField("file_type", "text"),
+                            "status":      typedField("status", "text"),
+                            "uploaded_by": typedField("uploaded_by", "text"),
+                            "file_size":   typedField("file_size", "number"),
+                            "uploaded_at": typedField("uploaded_at", "datetime"),
+                        },
+                    },
+                },
+            },
+            "store": map[string]interface{}{
+                "indexType": "scorch",
+            },
+        },
+    }
+}
+
+// SearchDocuments returns a page of the documents matching query, using the
+// FTS index when EnsureSearchIndex succeeded. If full-text search is
+// unavailable it falls back to substring matching, where every hit scores 0.
+func (s *CouchbaseService) SearchDocuments(query QueryNode, filter SearchFilter, page Page) (*SearchResults, error) {
+    if s.searchIndexName != "" {
+        results, err := s.searchDocumentsFTS(query, filter, page)
+        if err == nil {
+            return results, nil
+        }
+        log.Printf("Full-text search failed, falling back to substring search: %v", err)
+    }
+
+    return s.searchDocumentsLike(query, filter, page)
+}
+
+// ftsQuery builds the FTS query for a parsed query and filter. Queries are
+// built fresh for every request since they are mutable.
+func ftsQuery(node QueryNode, filter SearchFilter) search.Query {
+    conjunction := search.NewConjunctionQuery(ftsCompile(node))
+
+    for _, field := range facetFields {
+        values := filter.Terms[field]
+        if len(values) == 0 {
+            continue
+        }
+        anyValue := search.NewDisjunctionQuery()
+        for _, value := range values {
+            anyValue.Or(search.NewTermQuery(value).Field(field))
+        }
+        conjunction.And(anyValue)
+    }
+    if !filter.UploadedFrom.IsZero() || !filter.UploadedTo.IsZero() {
+        uploaded := search.NewDateRangeQuery().Field("uploaded_at")
+        if !filter.UploadedFrom.IsZero() {
+            uploaded.Start(filter.UploadedFrom.Format(time.RFC3339Nano), true)
+        }
+        if !filter.UploadedTo.IsZero() {
+            uploaded.End(filter.UploadedTo.Format(time.RFC3339Nano), true)
+        }
+        conjunction.And(uploaded)
+    }
+    if filter.MinSize != nil || filter.MaxSize != nil {
+        size := ftsNumericRange{Field: "file_size", InclusiveMin: true, InclusiveMax: true}
+        if filter.MinSize != nil {
+            value := float64(*filter.MinSize)
+            size.Min = &value
+        }
+        if filter.MaxSize != nil {
+            value := float64(*filter.MaxSize)
+            size.Max = &value
+        }
+        conjunction.And(size)
+    }
+
+    return conjunction
+}
+
+// ftsNumericRange is a numeric range query with float64 bounds. gocb's
+// NumericRangeQuery takes float32, which cannot hold file sizes above 16 MiB
+// exactly, so a bound would round to a neighbouring size.
+type ftsNumericRange struct {
+    Field        string   `json:"field"`
+    Min          *float64 `json:"min,omitempty"`
+    InclusiveMin bool     `json:"inclusive_min"`
+    Max          *float64 `json:"max,omitempty"`
+    InclusiveMax bool     `json:"inclusive_max"`
+}
+
+// ftsCompile translates a parsed query node. Full-text terms match any of
+// the searchFields with their boosts.
+func ftsCompile(node QueryNode) search.Query {
+    switch n := node.(type) {
+    case *AndNode:
+        must, mustNot, words := splitAndClauses(n)
+        query := search.NewBooleanQuery()
+        if len(must) == 0 {
+            query.Must(search.NewMatchAllQuery())
+        }
+        for _, clause := range must {
+            query.Must(ftsCompile(clause))
+        }
+        var excluded []search.Query
+        for _, clause := range mustNot {
+            excluded = append(excluded, ftsCompile(clause))
+        }
+        query.MustNot(excluded...)
+        if len(words) > 1 {
+            // Reward passages containing the words as a phrase
+            query.Should(search.NewMatchPhraseQuery(strings.Join(words, " ")).Field("parsed_text").Boost(2))
+        }
+        return query
+    case *OrNode:
+        query := search.NewDisjunctionQuery()
+        for _, clause := range n.Clauses {
+            query.Or(ftsCompile(clause))
+        }
+        return query
+    case *NotNode:
+        return search.NewBooleanQuery().Must(search.NewMatchAllQuery()).MustNot(ftsCompile(n.Clause))
+    case *DateRangeNode:
+        query := search.NewDateRangeQuery().Field(n.Field)
+        if !n.From.IsZero() {
+            query.Start(n.From.Format(time.RFC3339Nano), true)
+        }
+        if !n.To.IsZero() {
+            query.End(n.To.Format(time.RFC3339Nano), false)
+        }
+        return query
+    case *TermNode:
+        if n.Field != "" {
+            return ftsTerm(n, n.Field, 1)
+        }
+        fields := search.NewDisjunctionQuery()
+        for _, field := range searchFields {
+            fields.Or(ftsTerm(n, field.name, float32(field.boost)))
+        }
+        return fields
+    }
+    return search.NewMatchNoneQuery()
+}
+
+func ftsTerm(n *TermNode, field string, boost float32) search.Query {
+    switch {
+    case n.Wildcard && IsFacetField(field):
+        return search.NewWildcardQuery(n.Text).Field(field).Boost(boost)
+    case n.Wildcard:
+        return search.NewWildcardQuery(strings.ToLower(n.Text)).Field(field).Boost(boost)
+    case IsFacetField(field):
+        return search.NewTermQuery(n.Text).Field(field).Boost(boost)
+    case n.Phrase:
+        return search.NewMatchPhraseQuery(n.Text).Field(field).Boost(boost)
+    }
+    return search.NewMatchQuery(n.Text).Field(field).Boost(boost)
+}
+
+func (s *CouchbaseService) searchDocumentsFTS(query QueryNode, filter SearchFilter, page Page) (*SearchResults, error) {
+    months := facetMonthRanges(time.Now())
+    facets := map[string]search.Facet{}
+    for _, field := range facetFields {
+        facets[field] = search.NewTermFacet(field, facetSize)
+    }
+    monthFacet := search.NewDateFacet("uploaded_at", uint64(len(months)))
+    for _, month := range months {
+        monthFacet.AddRange(month.name, month.start.Format(time.RFC3339), month.end.Format(time.RFC3339))
+    }
+    facets[UploadMonthFacet] = monthFacet
+
+    result, err := s.scope().Search(s.searchIndexName, gocb.SearchRequest{SearchQuery: ftsQuery(query, filter)}, &gocb.SearchOptions{
+        Limit:            uint32(page.Limit),
+        Skip:             uint32(page.Offset),
+        IncludeLocations: true,
+        Facets:           facets,
+        Sort:             ftsSort(page),
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute search: %v", err)
+    }
+
+    type scoredID struct {
+        id      string
+        score   float64
+        matches []models.TextMatch
+    }
+    var ids []scoredID
+    for result.Next() {
+        row := result.Row()
+        var matches []models.TextMatch
+        for field, terms := range row.Locations {
+            for _, locations := range terms {
+                for _, location := range locations {
+                    index := 0
+                    if len(location.ArrayPositions) > 0 {
+                        index = int(location.ArrayPositions[0])
+                    }
+                    matches = append(matches, models.TextMatch{
+                        Field: field,
+                        Index: index,
+                        Start: int(location.Start),
+                        End:   int(location.End),
+                    })
+                }
+            }
+        }
+        ids = append(ids, scoredID{id: row.ID, score: row.Score, matches: matches})
+    }
+    if err := result.Err(); err != nil {
+        return nil, fmt.Errorf("search iteration error: %v", err)
+    }
+
+    metaData, err := result.MetaData()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read search metadata: %v", err)
+    }
+    facetResults, err := result.Facets()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read search facets: %v", err)
+    }
+    results := &SearchResults{
+        Hits:   make([]models.SearchHit, 0, len(ids)),
+        Total:  int(metaData.Metrics.TotalRows),
+        Facets: map[string][]models.FacetCount{},
+    }
+    for name, facet := range facetResults {
+        results.Facets[name] = ftsFacetCounts(name, facet, months)
+    }
+
+    // Count each selected facet as if only its own values were unrestricted
+    for _, field := range filter.selectedFields() {
+        facet, err := s.ftsFacet(ftsQuery(query, filter.without(field)), field, search.NewTermFacet(field, facetSize))
+        if err != nil {
+            return nil, err
+        }
+        results.Facets[field] = ftsFacetCounts(field, facet, months)
+    }
+
+    for _, hit := range ids {
+        // The index can briefly lag behind deletes
+        doc, err := s.GetDocument(hit.id)
+        if err != nil {
+            continue
+        }
+        results.Hits = append(results.Hits, models.SearchHit{Document: *doc, Score: hit.score, Matches: hit.matches})
+    }
+
+    return results, nil
+}
+
+// ftsSort orders hits for a page. Relevance ties go to the newest upload,
+// and the document key breaks any remaining tie so pages never overlap.
+func ftsSort(page Page) []search.Sort {
+    var sort []search.Sort
+    switch page.Sort {
+    case SortRelevance:
+        sort = append(sort,
+            search.NewSearchSortScore().Descending(page.Descending),
+            search.NewSearchSortField("uploaded_at").Descending(true))
+    case SortFileName:
+        sort = append(sort, search.NewSearchSortField("file_name_sort").Descending(page.Descending))
+    default:
+        sort = append(sort, search.NewSearchSortField(page.Sort).Descending(page.Descending))
+    }
+    return append(sort, search.NewSearchSortID().Descending(page.Descending))
+}
+
+// ftsFacet runs query for a single facet without fetching any hits.
+func (s *CouchbaseService) ftsFacet(query search.Query, name string, facet search.Facet) (gocb.SearchFacetResult, error) {
+    result, err := s.scope().Search(s.searchIndexName, gocb.SearchRequest{SearchQuery: query}, &gocb.SearchOptions{
+        Facets: map[string]search.Facet{name: facet},
+        Raw:    map[string]interface{}{"size": 0},
+    })
+    if err != nil {
+        return gocb.SearchFacetResult{}, fmt.Errorf("failed to execute facet search: %v", err)
+    }
+    for result.Next() {
+    }
+    if err := result.Err(); err != nil {
+        return gocb.SearchFacetResult{}, fmt.Errorf("facet search iteration error: %v", err)
+    }
+
+    facets, err := result.Facets()
+    if err != nil {
+        return gocb.SearchFacetResult{}, fmt.Errorf("failed to read search facets: %v", err)
+    }
+    return facets[name], nil
+}
+
+func ftsFacetCounts(name string, facet gocb.SearchFacetResult, months []monthRange) []models.FacetCount {
+    if name == UploadMonthFacet {
+        counts := make(map[string]int)
+        for _, month := range facet.DateRanges {
+            counts[month.Name] = month.Count
+        }
+        return monthCounts(counts, months)
+    }
+
+    counts := make([]models.FacetCount, 0, len(facet.Terms))
+    for _, term := range facet.Terms {
+        if term.Term != "" {
+            counts = append(counts, models.FacetCount{Value: term.Term, Count: term.Count})
+        }
+    }
+    return counts
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+func TestFTSQuerySizeRange(t *testing.T) {
+    query, err := ParseQuery("kerberos")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    tests := []struct {
+        name string
+        min  int64
+        max  int64
+        want []string
+    }{
+        {"small sizes", 1024, 4096, []string{`"min":1024`, `"max":4096`}},
+        // float32 would round both bounds to 16777216
+        {"beyond float32 precision", 16777217, 16777219, []string{`"min":16777217`, `"max":16777219`}},
+        {"large files", 5368709121, 5368709123, []string{`"min":5368709121`, `"max":5368709123`}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            filter := SearchFilter{MinSize: &tt.min, MaxSize: &tt.max}
+            data, err := json.Marshal(ftsQuery(query, filter))
+            if err != nil {
+                t.Fatalf("failed to marshal query: %v", err)
+            }
+            for _, want := range tt.want {
+                if !strings.Contains(string(data), want) {
+                    t.Errorf("missing %s in %s", want, data)
+                }
+            }
+        })
+    }
+}
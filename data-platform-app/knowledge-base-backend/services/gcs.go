@@ -2,9 +2,10 @@ package services
 
 import (
     "context"
+    "crypto/sha256"
+    "encoding/hex"
     "fmt"
     "io"
-    "mime/multipart"
     "path/filepath"
     "strings"
 
@@ -43,23 +44,36 @@ func NewGCSService(projectID, bucketName, credentialsPath string) (*GCSService,
     }, nil
 }
 
-func (s *GCSService) UploadFile(ctx context.Context, file multipart.File, fileName, gcsPath string) error {
+// UploadFile streams file to gcsPath and returns the hex SHA-256 of the
+// content it stored.
+func (s *GCSService) UploadFile(ctx context.Context, file io.Reader, fileName, gcsPath string) (string, error) {
     bucket := s.client.Bucket(s.bucketName)
     obj := bucket.Object(gcsPath)
     
     writer := obj.NewWriter(ctx)
     writer.ContentType = getContentType(fileName)
     
-    if _, err := io.Copy(writer, file); err != nil {
+    hash := sha256.New()
+    if _, err := io.Copy(io.MultiWriter(writer, hash), file); err != nil {
         writer.Close()
-        return fmt.Errorf("failed to copy file: %v", err)
+        return "", fmt.Errorf("failed to copy file: %v", err)
     }
     
     if err := writer.Close(); err != nil {
-        return fmt.Errorf("failed to close writer: %v", err)
+        return "", fmt.Errorf("failed to close writer: %v", err)
     }
     
-    return nil
+    return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ContentHash returns the hex SHA-256 of r's content, the hash UploadFile
+// returns for it.
+func ContentHash(r io.Reader) (string, error) {
+    hash := sha256.New()
+    if _, err := io.Copy(hash, r); err != nil {
+        return "", fmt.Errorf("failed to hash file: %v", err)
+    }
+    return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func (s *GCSService) DownloadFile(ctx context.Context, gcsPath string) ([]byte, error) {
@@ -134,14 +148,34 @@ func getContentType(fileName string) string {
         return "application/pdf"
     case ".docx":
         return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+    case ".doc":
+        return "application/msword"
     case ".xlsx":
         return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+    case ".xls":
+        return "application/vnd.ms-excel"
     case ".csv":
         return "text/csv"
-    case ".ppt", ".pptx":
+    case ".pptx":
         return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+    case ".ppt":
+        return "application/vnd.ms-powerpoint"
     case ".txt":
         return "text/plain"
+    case ".zip":
+        return "application/zip"
+    case ".gz", ".tgz":
+        return "application/gzip"
+    case ".log":
+        return "text/plain"
+    case ".md", ".markdown":
+        return "text/markdown"
+    case ".html", ".htm":
+        return "text/html"
+    case ".json":
+        return "application/json"
+    case ".yaml", ".yml":
+        return "application/yaml"
     default:
         return "application/octet-stream"
     }
@@ -0,0 +1,274 @@
+package services
+
+import (
+    "html"
+    "regexp"
+    "sort"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "knowledge-base-backend/models"
+)
+
+const (
+    // snippetContext is roughly how much text a snippet shows on each side
+    // of a match, in bytes.
+    snippetContext = 80
+    // maxSnippets caps the snippets returned per document.
+    maxSnippets = 3
+)
+
+// NewSearchResult converts a hit into the compact result returned by the
+// search API, with snippets of the parsed text around each match and the
+// keywords and error messages that matched.
+func NewSearchResult(hit models.SearchHit, includeText bool) models.SearchResult {
+    doc := hit.Document
+    result := models.SearchResult{
+        ID:                   doc.ID,
+        FileName:             doc.FileName,
+        OriginalName:         doc.OriginalName,
+        FileType:             doc.FileType,
+        FileSize:             doc.FileSize,
+        Path:                 strings.TrimPrefix(doc.GCSPath, "knowledge_based/"),
+        Product:              doc.Product,
+        SubProduct:           doc.SubProduct,
+        Category:             doc.Category,
+        Status:               doc.Status,
+        UploadedAt:           doc.UploadedAt,
+        Score:                hit.Score,
+        Snippets:             buildSnippets(doc.ParsedText, fieldMatches(hit.Matches, "parsed_text")),
+        MatchedKeywords:      matchedElements(doc.Keywords, fieldMatches(hit.Matches, "keywords")),
+        MatchedErrorMessages: matchedElements(doc.ErrorMessages, fieldMatches(hit.Matches, "error_messages")),
+    }
+    if includeText {
+        result.ParsedText = doc.ParsedText
+    }
+    return result
+}
+
+// fieldMatches returns the matches in one field ordered by position, without
+// overlaps.
+func fieldMatches(matches []models.TextMatch, field string) []models.TextMatch {
+    var found []models.TextMatch
+    for _, match := range matches {
+        if match.Field == field && match.Start < match.End {
+            found = append(found, match)
+        }
+    }
+    sort.Slice(found, func(i, j int) bool {
+        if found[i].Index != found[j].Index {
+            return found[i].Index < found[j].Index
+        }
+        return found[i].Start < found[j].Start
+    })
+
+    var merged []models.TextMatch
+    for _, match := range found {
+        last := len(merged) - 1
+        if last >= 0 && merged[last].Index == match.Index && match.Start <= merged[last].End {
+            if match.End > merged[last].End {
+                merged[last].End = match.End
+            }
+            continue
+        }
+        merged = append(merged, match)
+    }
+    return merged
+}
+
+// matchedElements returns the elements of an array field that had a match,
+// in field order.
+func matchedElements(values []string, matches []models.TextMatch) []string {
+    matched := []string{}
+    for i, match := range matches {
+        if match.Index < 0 || match.Index >= len(values) {
+            continue
+        }
+        if i > 0 && matches[i-1].Index == match.Index {
+            continue
+        }
+        matched = append(matched, values[match.Index])
+    }
+    return matched
+}
+
+// buildSnippets cuts excerpts of text around the matches. Matches close
+// enough to share an excerpt are marked in the same snippet.
+func buildSnippets(text string, matches []models.TextMatch) []models.Snippet {
+    snippets := []models.Snippet{}
+    for i := 0; i < len(matches) && len(snippets) < maxSnippets; {
+        first := matches[i]
+        if !matchInText(text, first) {
+            i++
+            continue
+        }
+
+        start := snippetStart(text, first.Start)
+        end := snippetEnd(text, first.End)
+        var marks []models.TextMatch
+        for ; i < len(matches) && matches[i].End <= end; i++ {
+            if matches[i].Start >= start && matchInText(text, matches[i]) {
+                marks = append(marks, matches[i])
+            }
+        }
+
+        var snippet snippetBuilder
+        pos := start
+        for _, mark := range marks {
+            snippet.write(text[pos:mark.Start], false)
+            snippet.write(text[mark.Start:mark.End], true)
+            pos = mark.End
+        }
+        snippet.write(text[pos:end], false)
+        snippets = append(snippets, snippet.snippet())
+    }
+    return snippets
+}
+
+// matchInText reports whether a match lies within text with both ends on
+// rune boundaries. Offsets from an index built before the text changed may
+// not.
+func matchInText(text string, match models.TextMatch) bool {
+    if match.Start < 0 || match.End > len(text) || match.Start >= match.End {
+        return false
+    }
+    return utf8.RuneStart(text[match.Start]) && (match.End == len(text) || utf8.RuneStart(text[match.End]))
+}
+
+// snippetStart moves back from a match to where its snippet begins, at a word
+// boundary when there is one in reach.
+func snippetStart(text string, matchStart int) int {
+    if matchStart <= snippetContext {
+        return 0
+    }
+    start := matchStart - snippetContext
+    for start < matchStart && !utf8.RuneStart(text[start]) {
+        start++
+    }
+    if space := strings.IndexFunc(text[start:matchStart], unicode.IsSpace); space >= 0 {
+        start += space
+    }
+    return start
+}
+
+// snippetEnd moves forward from a match to where its snippet ends, at a word
+// boundary when there is one in reach.
+func snippetEnd(text string, matchEnd int) int {
+    if len(text)-matchEnd <= snippetContext {
+        return len(text)
+    }
+    end := matchEnd + snippetContext
+    for end > matchEnd && !utf8.RuneStart(text[end]) {
+        end--
+    }
+    if space := strings.LastIndexFunc(text[matchEnd:end], unicode.IsSpace); space >= 0 {
+        end = matchEnd + space
+    }
+    return end
+}
+
+// snippetBuilder writes a snippet's plain and highlighted text side by side,
+// collapsing runs of whitespace such as line breaks into single spaces.
+type snippetBuilder struct {
+    text        strings.Builder
+    highlighted strings.Builder
+    runes       int
+    space       bool
+    marks       []models.Mark
+}
+
+func (b *snippetBuilder) write(s string, marked bool) {
+    var piece strings.Builder
+    start := b.runes
+    for _, r := range s {
+        if unicode.IsSpace(r) {
+            if b.space || b.runes == 0 {
+                continue
+            }
+            r = ' '
+        }
+        b.space = r == ' '
+        piece.WriteRune(r)
+        b.runes++
+    }
+    if piece.Len() == 0 {
+        return
+    }
+
+    b.text.WriteString(piece.String())
+    escaped := html.EscapeString(piece.String())
+    if marked {
+        b.highlighted.WriteString("<mark>" + escaped + "</mark>")
+        b.marks = append(b.marks, models.Mark{Start: start, End: b.runes})
+    } else {
+        b.highlighted.WriteString(escaped)
+    }
+}
+
+func (b *snippetBuilder) snippet() models.Snippet {
+    text := b.text.String()
+    highlighted := b.highlighted.String()
+    if strings.HasSuffix(text, " ") && strings.HasSuffix(highlighted, " ") {
+        text = text[:len(text)-1]
+        highlighted = highlighted[:len(highlighted)-1]
+    }
+    marks := b.marks
+    if marks == nil {
+        marks = []models.Mark{}
+    }
+    return models.Snippet{Text: text, Highlighted: highlighted, Marks: marks}
+}
+
+// substringMatches locates the terms of a query in the searchable fields
+// the way the substring search matches them, ignoring case.
+func substringMatches(doc *models.Document, query QueryNode) []models.TextMatch {
+    var matches []models.TextMatch
+    for _, term := range positiveTerms(query) {
+        if IsFacetField(term.Field) {
+            continue
+        }
+        pattern, err := regexp.Compile("(?i)" + wildcardPattern(term.Text))
+        if err != nil {
+            continue
+        }
+
+        find := func(field string, index int, value string) {
+            if term.Field != "" && term.Field != field {
+                return
+            }
+            for _, loc := range pattern.FindAllStringIndex(value, -1) {
+                if loc[0] < loc[1] {
+                    matches = append(matches, models.TextMatch{Field: field, Index: index, Start: loc[0], End: loc[1]})
+                }
+            }
+        }
+        find("file_name", 0, doc.FileName)
+        find("original_name", 0, doc.OriginalName)
+        find("parsed_text", 0, doc.ParsedText)
+        for i, keyword := range doc.Keywords {
+            find("keywords", i, keyword)
+        }
+        for i, message := range doc.ErrorMessages {
+            find("error_messages", i, message)
+        }
+    }
+    return matches
+}
+
+// wildcardPattern turns a term into a regular expression where * and ?
+// match within a word.
+func wildcardPattern(text string) string {
+    var pattern strings.Builder
+    for _, r := range text {
+        switch r {
+        case '*':
+            pattern.WriteString(`\S*`)
+        case '?':
+            pattern.WriteString(`\S`)
+        default:
+            pattern.WriteString(regexp.QuoteMeta(string(r)))
+        }
+    }
+    return pattern.String()
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+    "strings"
+    "testing"
+
+    "knowledge-base-backend/models"
+)
+
+// matchOf returns the match of the first occurrence of sub in text.
+func matchOf(text, sub string) models.TextMatch {
+    start := strings.Index(text, sub)
+    return models.TextMatch{Field: "parsed_text", Start: start, End: start + len(sub)}
+}
+
+func TestBuildSnippets(t *testing.T) {
+    multibyte := "Fehler: Verbindung über Größe fehlgeschlagen"
+    spaced := "first line\n\n   second\tline  "
+    long := "alpha " + strings.Repeat("filler ", 40) + "omega"
+    escaped := "use <b>bold</b> & more"
+
+    tests := []struct {
+        name    string
+        text    string
+        matches []models.TextMatch
+        want    []models.Snippet
+    }{
+        {
+            name:    "multibyte match",
+            text:    multibyte,
+            matches: []models.TextMatch{matchOf(multibyte, "Größe")},
+            want: []models.Snippet{{
+                Text:        multibyte,
+                Highlighted: "Fehler: Verbindung über <mark>Größe</mark> fehlgeschlagen",
+                Marks:       []models.Mark{{Start: 24, End: 29}},
+            }},
+        },
+        {
+            name:    "whitespace collapsed",
+            text:    spaced,
+            matches: []models.TextMatch{matchOf(spaced, "second")},
+            want: []models.Snippet{{
+                Text:        "first line second line",
+                Highlighted: "first line <mark>second</mark> line",
+                Marks:       []models.Mark{{Start: 11, End: 17}},
+            }},
+        },
+        {
+            name:    "matches at both ends of the text",
+            text:    long,
+            matches: []models.TextMatch{matchOf(long, "alpha"), matchOf(long, "omega")},
+            want: []models.Snippet{
+                {
+                    Text:        "alpha" + strings.Repeat(" filler", 11),
+                    Highlighted: "<mark>alpha</mark>" + strings.Repeat(" filler", 11),
+                    Marks:       []models.Mark{{Start: 0, End: 5}},
+                },
+                {
+                    Text:        strings.Repeat("filler ", 11) + "omega",
+                    Highlighted: strings.Repeat("filler ", 11) + "<mark>omega</mark>",
+                    Marks:       []models.Mark{{Start: 77, End: 82}},
+                },
+            },
+        },
+        {
+            name:    "html escaped",
+            text:    escaped,
+            matches: []models.TextMatch{matchOf(escaped, "bold")},
+            want: []models.Snippet{{
+                Text:        escaped,
+                Highlighted: "use &lt;b&gt;<mark>bold</mark>&lt;/b&gt; &amp; more",
+                Marks:       []models.Mark{{Start: 7, End: 11}},
+            }},
+        },
+        {
+            name: "offsets past the text",
+            text: multibyte,
+            matches: []models.TextMatch{
+                {Field: "parsed_text", Start: -1, End: 3},
+                {Field: "parsed_text", Start: len(multibyte) - 2, End: len(multibyte) + 5},
+            },
+            want: []models.Snippet{},
+        },
+        {
+            name: "offsets inside a rune",
+            text: multibyte,
+            matches: []models.TextMatch{
+                {Field: "parsed_text", Start: strings.Index(multibyte, "ü") + 1, End: strings.Index(multibyte, " Größe")},
+                matchOf(multibyte, "Verbindung"),
+                {Field: "parsed_text", Start: strings.Index(multibyte, "Größe"), End: strings.Index(multibyte, "ö") + 1},
+                matchOf(multibyte, "fehlgeschlagen"),
+            },
+            want: []models.Snippet{{
+                Text:        multibyte,
+                Highlighted: "Fehler: <mark>Verbindung</mark> über Größe <mark>fehlgeschlagen</mark>",
+                Marks:       []models.Mark{{Start: 8, End: 18}, {Start: 30, End: 44}},
+            }},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := buildSnippets(tt.text, tt.matches)
+            if len(got) != len(tt.want) {
+                t.Fatalf("got %d snippets %+v, want %d", len(got), got, len(tt.want))
+            }
+            for i := range got {
+                if got[i].Text != tt.want[i].Text || got[i].Highlighted != tt.want[i].Highlighted {
+                    t.Errorf("snippet %d:\ngot  %q / %q\nwant %q / %q", i, got[i].Text, got[i].Highlighted, tt.want[i].Text, tt.want[i].Highlighted)
+                }
+                if len(got[i].Marks) != len(tt.want[i].Marks) {
+                    t.Fatalf("snippet %d: marks %v, want %v", i, got[i].Marks, tt.want[i].Marks)
+                }
+                for j, mark := range got[i].Marks {
+                    if mark != tt.want[i].Marks[j] {
+                        t.Errorf("snippet %d: marks %v, want %v", i, got[i].Marks, tt.want[i].Marks)
+                    }
+                    // Marks count runes of the snippet text
+                    runes := []rune(got[i].Text)
+                    if mark.End > len(runes) {
+                        t.Errorf("snippet %d: mark %v past %d runes", i, mark, len(runes))
+                    }
+                }
+            }
+        })
+    }
+}
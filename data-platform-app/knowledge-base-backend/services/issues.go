@@ -0,0 +1,276 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "slices"
+    "strings"
+    "sync"
+
+    "github.com/couchbase/gocb/v2"
+    "knowledge-base-backend/models"
+)
+
+const (
+    // minSignatureLength keeps a signature from matching nearly every error.
+    minSignatureLength = 10
+    // maxSignatureLength bounds a signature; it is matched against every
+    // error message of every parsed document.
+    maxSignatureLength = 500
+)
+
+// ErrKnownIssueNotFound is returned for a known issue ID that does not exist.
+var ErrKnownIssueNotFound = errors.New("known issue not found")
+
+// The parts of an error message that differ between occurrences of the same
+// error, in the order they are replaced.
+var signatureReplacements = []struct {
+    pattern     *regexp.Regexp
+    replacement string
+}{
+    {regexp.MustCompile(`\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<id>"},
+    {regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}(?:[t ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:z|[+-]\d{2}:?\d{2})?)?\b|\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b`), "<time>"},
+    {regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "<ip>"},
+    // Hadoop-style identifiers: blk_1073741825_1001, application_1700000000000_0001
+    {regexp.MustCompile(`\b([a-z]+)_\d[\d_]*\b`), "${1}_<n>"},
+    // Long numbers, but not error codes such as ORA-00942 or versions
+    {regexp.MustCompile(`(^|[^\w.-])\d{4,}\b`), "${1}<n>"},
+    {regexp.MustCompile(`\b0x[0-9a-f]+\b|\b[0-9a-f]{8,}\b`), "<hex>"},
+}
+
+// NormalizeErrorSignature lower-cases an error message, replaces the IDs,
+// timestamps, addresses and long numbers that differ between occurrences of
+// the same error with placeholders, and collapses its whitespace.
+func NormalizeErrorSignature(text string) string {
+    text = strings.ToLower(text)
+    for _, r := range signatureReplacements {
+        text = r.pattern.ReplaceAllString(text, r.replacement)
+    }
+    return strings.Join(strings.Fields(text), " ")
+}
+
+// NormalizeKnownIssue checks a known issue request and normalizes it in
+// place: the signature with NormalizeErrorSignature, and the products and
+// resolution steps by dropping blank entries.
+func NormalizeKnownIssue(req *models.KnownIssueRequest) error {
+    req.Title = strings.TrimSpace(req.Title)
+    if req.Title == "" {
+        return fmt.Errorf("title is required")
+    }
+    req.Signature = NormalizeErrorSignature(req.Signature)
+    if len(req.Signature) < minSignatureLength {
+        return fmt.Errorf("signature must be at least %d characters once normalized", minSignatureLength)
+    }
+    if len(req.Signature) > maxSignatureLength {
+        return fmt.Errorf("signature must be at most %d characters", maxSignatureLength)
+    }
+    req.Products = nonBlank(req.Products)
+    req.Resolution = nonBlank(req.Resolution)
+    return nil
+}
+
+func nonBlank(values []string) []string {
+    kept := []string{}
+    for _, value := range values {
+        if value = strings.TrimSpace(value); value != "" {
+            kept = append(kept, value)
+        }
+    }
+    return kept
+}
+
+func (s *CouchbaseService) SaveKnownIssue(issue *models.KnownIssue) error {
+    _, err := s.issueCollection.Upsert(issue.ID, issue, nil)
+    if err != nil {
+        return fmt.Errorf("failed to save known issue: %v", err)
+    }
+    return nil
+}
+
+func (s *CouchbaseService) GetKnownIssue(id string) (*models.KnownIssue, error) {
+    result, err := s.issueCollection.Get(id, nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return nil, ErrKnownIssueNotFound
+        }
+        return nil, fmt.Errorf("failed to get known issue: %v", err)
+    }
+
+    var issue models.KnownIssue
+    if err := result.Content(&issue); err != nil {
+        return nil, fmt.Errorf("failed to decode known issue: %v", err)
+    }
+    return &issue, nil
+}
+
+func (s *CouchbaseService) DeleteKnownIssue(id string) error {
+    _, err := s.issueCollection.Remove(id, nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return ErrKnownIssueNotFound
+        }
+        return fmt.Errorf("failed to delete known issue: %v", err)
+    }
+    return nil
+}
+
+// ListKnownIssues returns every known issue ordered by title. It waits for
+// the index to catch up, so a registry reloaded right after an edit matches
+// against it.
+func (s *CouchbaseService) ListKnownIssues() ([]models.KnownIssue, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT i.* FROM %s i
+        ORDER BY LOWER(i.title), i.id
+    `, s.keyspace(s.issueCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    issues := []models.KnownIssue{}
+    for results.Next() {
+        var issue models.KnownIssue
+        if err := results.Row(&issue); err != nil {
+            continue
+        }
+        issues = append(issues, issue)
+    }
+
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return issues, nil
+}
+
+// ListIssueDocuments returns one page of the documents linked to a known
+// issue and how many are linked in total.
+func (s *CouchbaseService) ListIssueDocuments(issueID string, page Page) ([]models.Document, int, error) {
+    where := " WHERE ANY i IN d.known_issues SATISFIES i = $1 END"
+    params := []interface{}{issueID}
+
+    documents, err := s.queryDocuments("SELECT d.* FROM "+s.keyspace(s.collectionName)+" d"+where+page.n1qlOrder()+page.n1qlLimit(), params)
+    if err != nil {
+        return nil, 0, err
+    }
+    total, err := s.countDocuments(where, params)
+    if err != nil {
+        return nil, 0, err
+    }
+    return documents, total, nil
+}
+
+// SetDocumentKnownIssues replaces the known issues linked to a document
+// without rewriting the rest of it.
+func (s *CouchbaseService) SetDocumentKnownIssues(documentID string, issueIDs []string) error {
+    if issueIDs == nil {
+        issueIDs = []string{}
+    }
+    _, err := s.collection.MutateIn(documentID, []gocb.MutateInSpec{
+        gocb.UpsertSpec("known_issues", issueIDs, nil),
+    }, nil)
+    if err != nil {
+        return fmt.Errorf("failed to link known issues: %v", err)
+    }
+    return nil
+}
+
+// IssueRegistry matches error messages against the known issues stored in
+// Couchbase. Signatures are compared after normalization, so an issue
+// recorded from one occurrence of an error matches the others.
+type IssueRegistry struct {
+    couchbase *CouchbaseService
+
+    mu     sync.RWMutex
+    issues []models.KnownIssue
+}
+
+func NewIssueRegistry(couchbase *CouchbaseService) *IssueRegistry {
+    return &IssueRegistry{couchbase: couchbase}
+}
+
+// Load replaces the registry with the known issues currently stored.
+func (r *IssueRegistry) Load() (int, error) {
+    issues, err := r.couchbase.ListKnownIssues()
+    if err != nil {
+        return 0, err
+    }
+
+    r.mu.Lock()
+    r.issues = issues
+    r.mu.Unlock()
+    return len(issues), nil
+}
+
+// Match returns the known issues whose signature occurs in text, such as a
+// pasted log line or stack trace. A product limits them to issues affecting
+// it.
+func (r *IssueRegistry) Match(text, product string) []models.KnownIssue {
+    text = NormalizeErrorSignature(text)
+
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    matches := []models.KnownIssue{}
+    for _, issue := range r.issues {
+        if affects(issue, product) && strings.Contains(text, issue.Signature) {
+            matches = append(matches, issue)
+        }
+    }
+    return matches
+}
+
+// Link returns the IDs of the known issues affecting a document's product
+// whose signature occurs in one of its error messages.
+func (r *IssueRegistry) Link(doc *models.Document) []string {
+    messages := make([]string, len(doc.ErrorMessages))
+    for i, message := range doc.ErrorMessages {
+        messages[i] = NormalizeErrorSignature(message)
+    }
+
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var ids []string
+    for _, issue := range r.issues {
+        if !affects(issue, doc.Product) {
+            continue
+        }
+        for _, message := range messages {
+            if strings.Contains(message, issue.Signature) {
+                ids = append(ids, issue.ID)
+                break
+            }
+        }
+    }
+    return ids
+}
+
+// Relink brings the known issues linked to every stored document up to date
+// with the registry, after an issue was added, changed or removed. It
+// returns how many documents changed.
+func (r *IssueRegistry) Relink() (int, error) {
+    changed := 0
+    err := r.couchbase.ForEachDocument(func(doc *models.Document) error {
+        ids := r.Link(doc)
+        if slices.Equal(ids, doc.KnownIssues) {
+            return nil
+        }
+        if err := r.couchbase.SetDocumentKnownIssues(doc.ID, ids); err != nil {
+            return err
+        }
+        changed++
+        return nil
+    })
+    return changed, err
+}
+
+// affects reports whether an issue affects product; issues without products
+// affect all of them, and so does an empty product.
+func affects(issue models.KnownIssue, product string) bool {
+    return product == "" || len(issue.Products) == 0 || containsFold(issue.Products, product)
+}
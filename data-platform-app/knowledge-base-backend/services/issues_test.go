@@ -0,0 +1,98 @@
+package services
+
+import (
+    "slices"
+    "strings"
+    "testing"
+
+    "knowledge-base-backend/models"
+)
+
+func TestNormalizeErrorSignature(t *testing.T) {
+    tests := []struct {
+        name  string
+        input string
+        want  string
+    }{
+        {"case and whitespace", "  Connection   REFUSED\n\tretrying ", "connection refused retrying"},
+        {"uuid", "Query 3f2b9c1e-8d4a-4b6e-9f0a-1c2d3e4f5a6b failed", "query <id> failed"},
+        {"timestamp", "2025-03-14 10:22:01,123 Lease expired", "<time> lease expired"},
+        {"iso timestamp", "at 2025-03-14T10:22:01.5Z retry", "at <time> retry"},
+        {"clock time", "heartbeat lost at 10:22:01", "heartbeat lost at <time>"},
+        {"ip and port", "Failed to connect to 10.0.12.7:8020", "failed to connect to <ip>"},
+        {"hadoop block", "Could not obtain blk_1073741825_1001 from any node", "could not obtain blk_<n> from any node"},
+        {"yarn application", "application_1700000000000_0042 failed 2 times", "application_<n> failed 2 times"},
+        {"long number", "Container killed after 123456 ms", "container killed after <n> ms"},
+        {"error code kept", "ORA-00942: table or view does not exist", "ora-00942: table or view does not exist"},
+        {"short number kept", "exit code 137", "exit code 137"},
+        {"version kept", "requires Java 1.8.0_292 or later", "requires java 1.8.0_292 or later"},
+        {"hex", "segfault at 0x7f3a2b1c in libhdfs", "segfault at <hex> in libhdfs"},
+        {"hash", "checksum deadbeefcafe1234 mismatch", "checksum <hex> mismatch"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := NormalizeErrorSignature(tt.input); got != tt.want {
+                t.Errorf("NormalizeErrorSignature(%q) = %q, want %q", tt.input, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNormalizeKnownIssue(t *testing.T) {
+    tests := []struct {
+        name    string
+        req     models.KnownIssueRequest
+        wantErr string
+    }{
+        {"valid", models.KnownIssueRequest{Title: " Lease expired ", Signature: "Lease expired for 10.0.0.1:8020"}, ""},
+        {"blank title", models.KnownIssueRequest{Title: " ", Signature: "lease expired for client"}, "title is required"},
+        {"short signature", models.KnownIssueRequest{Title: "t", Signature: "  ERROR   "}, "at least"},
+        {"signature of placeholders only", models.KnownIssueRequest{Title: "t", Signature: "12345678"}, "at least"},
+        {"long signature", models.KnownIssueRequest{Title: "t", Signature: strings.Repeat("word ", 101)}, "at most"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := NormalizeKnownIssue(&tt.req)
+            if tt.wantErr == "" {
+                if err != nil {
+                    t.Fatalf("unexpected error: %v", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+            }
+        })
+    }
+}
+
+func TestIssueRegistryLink(t *testing.T) {
+    r := NewIssueRegistry(nil)
+    r.issues = []models.KnownIssue{
+        {ID: "lease", Signature: NormalizeErrorSignature("Lease expired for 10.0.0.1:8020")},
+        {ID: "impala-oom", Signature: "memory limit exceeded", Products: []string{"Impala"}},
+    }
+
+    tests := []struct {
+        name     string
+        product  string
+        messages []string
+        want     []string
+    }{
+        {"other occurrence", "hdfs", []string{"2025-01-02 03:04:05 ERROR Lease expired for 192.168.1.20:9000 (retry 3)"}, []string{"lease"}},
+        {"product matches", "impala", []string{"Query aborted: Memory limit exceeded"}, []string{"impala-oom"}},
+        {"other product", "hive", []string{"Query aborted: Memory limit exceeded"}, nil},
+        {"no match", "hdfs", []string{"connection refused"}, nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            doc := &models.Document{Product: tt.product, ErrorMessages: tt.messages}
+            if got := r.Link(doc); !slices.Equal(got, tt.want) {
+                t.Errorf("got %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
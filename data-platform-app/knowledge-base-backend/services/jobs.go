@@ -0,0 +1,552 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/couchbase/gocb/v2"
+    "knowledge-base-backend/models"
+)
+
+// ErrLeaseLost is returned when a worker tries to touch a job whose lease has
+// been taken over by another worker.
+var ErrLeaseLost = errors.New("parse job lease lost")
+
+// enqueueTimeout keeps a slow cluster from holding up the upload request that
+// enqueues the job. Documents whose job could not be written are picked up
+// by the abandoned-document sweep instead.
+const enqueueTimeout = 3 * time.Second
+
+// Job priorities; higher priorities are claimed first. Bulk reparses sit at
+// the bottom so they only use workers that new uploads leave idle.
+const (
+    PriorityUpload      = 10
+    PriorityReparse     = 5
+    PriorityBulkReparse = 0
+)
+
+// EnqueueParseJob persists a queued parse job for a document. Enqueueing a
+// document that already has a pending job is a no-op.
+func (s *CouchbaseService) EnqueueParseJob(documentID string, priority int) error {
+    _, err := s.insertParseJob(documentID, priority)
+    return err
+}
+
+// insertParseJob reports whether a new job was created.
+func (s *CouchbaseService) insertParseJob(documentID string, priority int) (bool, error) {
+    now := time.Now().UTC()
+    job := &models.ParseJob{
+        ID:         documentID,
+        DocumentID: documentID,
+        Status:     "queued",
+        Priority:   priority,
+        CreatedAt:  now,
+        UpdatedAt:  now,
+    }
+
+    _, err := s.jobCollection.Insert(job.ID, job, &gocb.InsertOptions{Timeout: enqueueTimeout})
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentExists) {
+            return false, nil
+        }
+        return false, fmt.Errorf("failed to enqueue parse job: %v", err)
+    }
+    return true, nil
+}
+
+// ClaimParseJob atomically leases the most urgent claimable job to owner,
+// oldest first within a priority. A job is
+// claimable when it is queued and due for a retry, or when its previous lease
+// has expired. Every claim counts as an attempt. It returns nil when there is
+// nothing to do.
+func (s *CouchbaseService) ClaimParseJob(owner string, lease time.Duration) (*models.ParseJob, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT RAW META(j).id FROM %s j
+        WHERE (j.status = "queued"
+              AND (j.next_retry_at IS NOT VALUED OR STR_TO_MILLIS(j.next_retry_at) <= $1))
+           OR (j.status = "leased" AND STR_TO_MILLIS(j.lease_expires_at) < $1)
+        ORDER BY j.priority DESC, j.created_at
+        LIMIT 10
+    `, s.keyspace(s.jobCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{time.Now().UnixMilli()},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to query parse jobs: %v", err)
+    }
+
+    var candidates []string
+    for results.Next() {
+        var id string
+        if err := results.Row(&id); err != nil {
+            continue
+        }
+        candidates = append(candidates, id)
+    }
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    for _, id := range candidates {
+        job, err := s.tryClaimParseJob(id, owner, lease)
+        if err != nil {
+            return nil, err
+        }
+        if job != nil {
+            return job, nil
+        }
+    }
+
+    return nil, nil
+}
+
+// tryClaimParseJob leases a single job with a CAS replace. It returns nil
+// without an error if another worker won the race or the job is gone.
+func (s *CouchbaseService) tryClaimParseJob(id, owner string, lease time.Duration) (*models.ParseJob, error) {
+    result, err := s.jobCollection.Get(id, nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to get parse job: %v", err)
+    }
+
+    var job models.ParseJob
+    if err := result.Content(&job); err != nil {
+        return nil, fmt.Errorf("failed to decode parse job: %v", err)
+    }
+
+    now := time.Now().UTC()
+    switch job.Status {
+    case "queued":
+        if job.NextRetryAt != nil && job.NextRetryAt.After(now) {
+            return nil, nil
+        }
+    case "leased":
+        if job.LeaseExpiresAt != nil && job.LeaseExpiresAt.After(now) {
+            return nil, nil
+        }
+    default:
+        return nil, nil
+    }
+
+    expires := now.Add(lease)
+    job.Attempts++
+    job.NextRetryAt = nil
+    job.Stage = ""
+    job.Progress = nil
+    job.Status = "leased"
+    job.LeaseOwner = owner
+    job.LeaseExpiresAt = &expires
+    job.HeartbeatAt = &now
+    job.UpdatedAt = now
+
+    _, err = s.jobCollection.Replace(id, &job, &gocb.ReplaceOptions{Cas: result.Cas()})
+    if err != nil {
+        if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentNotFound) {
+            return nil, nil
+        }
+        return nil, fmt.Errorf("failed to claim parse job: %v", err)
+    }
+
+    return &job, nil
+}
+
+// HeartbeatParseJob extends the lease held by owner. It returns ErrLeaseLost
+// if the job was removed or claimed by someone else in the meantime.
+func (s *CouchbaseService) HeartbeatParseJob(id, owner string, lease time.Duration) error {
+    return s.updateLeasedJob(id, owner, func(job *models.ParseJob, now time.Time) {
+        expires := now.Add(lease)
+        job.LeaseExpiresAt = &expires
+        job.HeartbeatAt = &now
+    })
+}
+
+// ReleaseParseJob gives up a leased job after a failed attempt. With a retry
+// time the job is queued again once that time has passed; without one it is
+// moved to the failed dead-letter state and left for an admin to retry.
+func (s *CouchbaseService) ReleaseParseJob(id, owner, lastError string, retryAt *time.Time) error {
+    return s.updateLeasedJob(id, owner, func(job *models.ParseJob, now time.Time) {
+        job.Status = "failed"
+        if retryAt != nil {
+            job.Status = "queued"
+        }
+        job.LastError = lastError
+        job.NextRetryAt = retryAt
+        job.LeaseOwner = ""
+        job.LeaseExpiresAt = nil
+        job.Stage = ""
+        job.Progress = nil
+    })
+}
+
+// SetParseJobStage records the pipeline stage of a leased job so that status
+// requests served by other instances can report it.
+func (s *CouchbaseService) SetParseJobStage(id, owner, stage string, progress *models.StageProgress) error {
+    return s.updateLeasedJob(id, owner, func(job *models.ParseJob, now time.Time) {
+        job.Stage = stage
+        job.Progress = progress
+    })
+}
+
+// updateLeasedJob applies mutate to a job with a CAS replace, provided owner
+// still holds its lease.
+func (s *CouchbaseService) updateLeasedJob(id, owner string, mutate func(job *models.ParseJob, now time.Time)) error {
+    result, err := s.jobCollection.Get(id, nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return ErrLeaseLost
+        }
+        return fmt.Errorf("failed to get parse job: %v", err)
+    }
+
+    var job models.ParseJob
+    if err := result.Content(&job); err != nil {
+        return fmt.Errorf("failed to decode parse job: %v", err)
+    }
+    if job.Status != "leased" || job.LeaseOwner != owner {
+        return ErrLeaseLost
+    }
+
+    now := time.Now().UTC()
+    mutate(&job, now)
+    job.UpdatedAt = now
+
+    _, err = s.jobCollection.Replace(id, &job, &gocb.ReplaceOptions{Cas: result.Cas()})
+    if err != nil {
+        if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentNotFound) {
+            return ErrLeaseLost
+        }
+        return fmt.Errorf("failed to update parse job: %v", err)
+    }
+    return nil
+}
+
+// CompleteParseJob removes a finished job, provided owner still holds it.
+func (s *CouchbaseService) CompleteParseJob(id, owner string) error {
+    result, err := s.jobCollection.Get(id, nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return ErrLeaseLost
+        }
+        return fmt.Errorf("failed to get parse job: %v", err)
+    }
+
+    var job models.ParseJob
+    if err := result.Content(&job); err != nil {
+        return fmt.Errorf("failed to decode parse job: %v", err)
+    }
+    if job.LeaseOwner != owner {
+        return ErrLeaseLost
+    }
+
+    _, err = s.jobCollection.Remove(id, &gocb.RemoveOptions{Cas: result.Cas()})
+    if err != nil {
+        if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentNotFound) {
+            return ErrLeaseLost
+        }
+        return fmt.Errorf("failed to complete parse job: %v", err)
+    }
+    return nil
+}
+
+// RequeueAbandonedDocuments makes sure every document that never finished
+// parsing has a pending job. Jobs whose lease expired are already claimable,
+// so only documents with no job at all need a new one.
+func (s *CouchbaseService) RequeueAbandonedDocuments() (int, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT RAW d.id FROM %s d
+        WHERE d.status IN ["uploaded", "parsing"]
+    `, s.keyspace(s.collectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, nil)
+    if err != nil {
+        return 0, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    var ids []string
+    for results.Next() {
+        var id string
+        if err := results.Row(&id); err != nil {
+            continue
+        }
+        ids = append(ids, id)
+    }
+    if err := results.Err(); err != nil {
+        return 0, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    requeued := 0
+    for _, id := range ids {
+        created, err := s.insertParseJob(id, PriorityUpload)
+        if err != nil {
+            return requeued, err
+        }
+        if created {
+            requeued++
+        }
+    }
+
+    return requeued, nil
+}
+
+// CountPendingParseJobs returns how many jobs are queued or being worked on,
+// including ones waiting for a retry.
+func (s *CouchbaseService) CountPendingParseJobs() (int, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT RAW COUNT(*) FROM %s j
+        WHERE j.status IN ["queued", "leased"]
+    `, s.keyspace(s.jobCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, nil)
+    if err != nil {
+        return 0, fmt.Errorf("failed to count parse jobs: %v", err)
+    }
+
+    var count int
+    if err := results.One(&count); err != nil {
+        return 0, fmt.Errorf("failed to read parse job count: %v", err)
+    }
+    return count, nil
+}
+
+// ParseQueuePosition returns the 1-based position of a queued job among the
+// jobs that are ready to be claimed, in claim order.
+func (s *CouchbaseService) ParseQueuePosition(job *models.ParseJob) (int, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT RAW COUNT(*) FROM %s j
+        WHERE j.status = "queued"
+          AND (j.next_retry_at IS NOT VALUED OR STR_TO_MILLIS(j.next_retry_at) <= $1)
+          AND (IFMISSINGORNULL(j.priority, 0) > $2
+               OR (IFMISSINGORNULL(j.priority, 0) = $2 AND STR_TO_MILLIS(j.created_at) < $3))
+    `, s.keyspace(s.jobCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{time.Now().UnixMilli(), job.Priority, job.CreatedAt.UnixMilli()},
+    })
+    if err != nil {
+        return 0, fmt.Errorf("failed to query queue position: %v", err)
+    }
+
+    var ahead int
+    if err := results.One(&ahead); err != nil {
+        return 0, fmt.Errorf("failed to read queue position: %v", err)
+    }
+    return ahead + 1, nil
+}
+
+// ParseQueueStats counts jobs per state and lists the ones being worked on.
+func (s *CouchbaseService) ParseQueueStats() (*models.QueueStats, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT
+            SUM(CASE WHEN j.status = "queued" AND (j.next_retry_at IS NOT VALUED
+                OR STR_TO_MILLIS(j.next_retry_at) <= $1) THEN 1 ELSE 0 END) AS queued,
+            SUM(CASE WHEN j.status = "queued" AND STR_TO_MILLIS(j.next_retry_at) > $1
+                THEN 1 ELSE 0 END) AS retrying,
+            SUM(CASE WHEN j.status = "leased" THEN 1 ELSE 0 END) AS in_progress,
+            SUM(CASE WHEN j.status = "failed" THEN 1 ELSE 0 END) AS failed
+        FROM %s j
+    `, s.keyspace(s.jobCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{time.Now().UnixMilli()},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to query queue stats: %v", err)
+    }
+
+    var stats models.QueueStats
+    if err := results.One(&stats); err != nil {
+        return nil, fmt.Errorf("failed to read queue stats: %v", err)
+    }
+
+    n1qlQuery = fmt.Sprintf(`
+        SELECT j.* FROM %s j
+        WHERE j.status = "leased"
+        ORDER BY j.created_at
+    `, s.keyspace(s.jobCollectionName))
+
+    results, err = s.cluster.Query(n1qlQuery, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query active jobs: %v", err)
+    }
+
+    stats.Active = []models.ParseJob{}
+    for results.Next() {
+        var job models.ParseJob
+        if err := results.Row(&job); err != nil {
+            continue
+        }
+        stats.Active = append(stats.Active, job)
+    }
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return &stats, nil
+}
+
+// GetParseJob returns the pending or dead-lettered job for a document.
+func (s *CouchbaseService) GetParseJob(documentID string) (*models.ParseJob, error) {
+    result, err := s.jobCollection.Get(documentID, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get parse job: %v", err)
+    }
+
+    var job models.ParseJob
+    if err := result.Content(&job); err != nil {
+        return nil, fmt.Errorf("failed to decode parse job: %v", err)
+    }
+    return &job, nil
+}
+
+// RetryParseJob replaces a document's job with a fresh queued one, resetting
+// its attempt count. It is used to revive dead-lettered documents.
+func (s *CouchbaseService) RetryParseJob(documentID string) error {
+    now := time.Now().UTC()
+    job := &models.ParseJob{
+        ID:         documentID,
+        DocumentID: documentID,
+        Status:     "queued",
+        Priority:   PriorityReparse,
+        CreatedAt:  now,
+        UpdatedAt:  now,
+    }
+
+    if _, err := s.jobCollection.Upsert(job.ID, job, nil); err != nil {
+        return fmt.Errorf("failed to requeue parse job: %v", err)
+    }
+    return nil
+}
+
+// ListParseFailures returns dead-lettered jobs with their documents, newest
+// first. A failed reparse leaves its document "parsed", so failures are
+// found through the job collection; documents marked "failed" or "error"
+// without a failed job, e.g. from before failures were dead-lettered, follow
+// them.
+func (s *CouchbaseService) ListParseFailures() ([]models.ParseFailure, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT j.* FROM %s j
+        WHERE j.status = "failed"
+        ORDER BY j.updated_at DESC
+    `, s.keyspace(s.jobCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    var jobs []models.ParseJob
+    for results.Next() {
+        var job models.ParseJob
+        if err := results.Row(&job); err != nil {
+            continue
+        }
+        jobs = append(jobs, job)
+    }
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    failures := make([]models.ParseFailure, 0, len(jobs))
+    listed := make(map[string]bool, len(jobs))
+    for i := range jobs {
+        doc, err := s.GetDocument(jobs[i].DocumentID)
+        if err != nil {
+            // Deleted while its job was being listed
+            continue
+        }
+        failures = append(failures, models.ParseFailure{Document: doc, Job: &jobs[i]})
+        listed[doc.ID] = true
+    }
+
+    n1qlQuery = fmt.Sprintf(`
+        SELECT d.* FROM %s d
+        WHERE d.status IN ["failed", "error"]
+        ORDER BY d.updated_at DESC
+    `, s.keyspace(s.collectionName))
+
+    results, err = s.cluster.Query(n1qlQuery, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    for results.Next() {
+        var doc models.Document
+        if err := results.Row(&doc); err != nil || listed[doc.ID] {
+            continue
+        }
+        failures = append(failures, models.ParseFailure{Document: &doc})
+    }
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return failures, nil
+}
+
+// DeleteParseJob drops any job for a deleted document.
+func (s *CouchbaseService) DeleteParseJob(documentID string) error {
+    _, err := s.jobCollection.Remove(documentID, nil)
+    if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+        return fmt.Errorf("failed to delete parse job: %v", err)
+    }
+    return nil
+}
+
+// ListDocumentIDsForReparse returns the IDs of documents matching a bulk
+// reparse filter, oldest first.
+func (s *CouchbaseService) ListDocumentIDsForReparse(filter *models.ReparseRequest) ([]string, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT RAW d.id FROM %s d
+        WHERE 1=1
+    `, s.keyspace(s.collectionName))
+
+    var params []interface{}
+
+    if filter.PathPrefix != "" {
+        parts := strings.Split(strings.Trim(filter.PathPrefix, "/"), "/")
+        fields := []string{"d.product", "d.sub_product", "d.category"}
+        for i, part := range parts {
+            if i >= len(fields) || part == "" {
+                break
+            }
+            n1qlQuery += " AND " + fields[i] + " = $" + fmt.Sprintf("%d", len(params)+1)
+            params = append(params, part)
+        }
+    }
+    if filter.Status != "" {
+        n1qlQuery += " AND d.status = $" + fmt.Sprintf("%d", len(params)+1)
+        params = append(params, filter.Status)
+    }
+    if filter.BelowVersion > 0 {
+        n1qlQuery += " AND IFMISSINGORNULL(d.parser_version, 0) < $" + fmt.Sprintf("%d", len(params)+1)
+        params = append(params, filter.BelowVersion)
+    }
+
+    n1qlQuery += " ORDER BY d.uploaded_at"
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: params,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    var ids []string
+    for results.Next() {
+        var id string
+        if err := results.Row(&id); err != nil {
+            continue
+        }
+        ids = append(ids, id)
+    }
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return ids, nil
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+    "math"
+    "sort"
+    "strings"
+    "sync"
+    "unicode"
+
+    "github.com/blevesearch/bleve/v2/analysis/lang/id"
+    "knowledge-base-backend/models"
+)
+
+const (
+    // maxKeywords is how many keywords a document keeps.
+    maxKeywords = 20
+    // maxPhraseWords is the longest phrase considered as a keyword.
+    maxPhraseWords = 3
+    // minKeywordCount is how often a term must occur to be a keyword.
+    minKeywordCount = 2
+    // minKeywordLength and maxKeywordLength bound single-word keywords; longer
+    // words are usually hashes or encoded data.
+    minKeywordLength = 3
+    maxKeywordLength = 30
+    // maxCorpusTerms caps the terms of one document counted towards document
+    // frequencies, keeping its most frequent ones.
+    maxCorpusTerms = 1000
+)
+
+// keywordStopwords are the English and Indonesian words never used as
+// keywords or inside keyword phrases.
+var keywordStopwords = func() map[string]bool {
+    words := parseStopwords(id.IndonesianStopWords)
+    for word := range queryStopwords {
+        words[word] = true
+    }
+    return words
+}()
+
+// KeywordCorpus counts in how many documents each candidate keyword occurs,
+// so keywords can be ranked by TF-IDF: terms frequent in one document but
+// rare across the corpus rank highest.
+type KeywordCorpus struct {
+    couchbase *CouchbaseService
+
+    mu        sync.RWMutex
+    frequency map[string]int      // documents containing each term
+    documents map[string][]string // terms each document counted
+}
+
+func NewKeywordCorpus(couchbase *CouchbaseService) *KeywordCorpus {
+    return &KeywordCorpus{
+        couchbase: couchbase,
+        frequency: make(map[string]int),
+        documents: make(map[string][]string),
+    }
+}
+
+// Load counts the terms of every stored document, returning how many it
+// read.
+func (k *KeywordCorpus) Load() (int, error) {
+    count := 0
+    err := k.couchbase.ForEachDocument(func(doc *models.Document) error {
+        k.Add(doc)
+        count++
+        return nil
+    })
+    return count, err
+}
+
+// Add counts the terms of a document's parsed text, replacing what it
+// counted before.
+func (k *KeywordCorpus) Add(doc *models.Document) {
+    terms := corpusTerms(countKeywordTerms(doc.ParsedText))
+
+    k.mu.Lock()
+    defer k.mu.Unlock()
+    k.removeLocked(doc.ID)
+    if len(terms) == 0 {
+        return
+    }
+    for _, term := range terms {
+        k.frequency[term]++
+    }
+    k.documents[doc.ID] = terms
+}
+
+// Remove stops counting a deleted document.
+func (k *KeywordCorpus) Remove(documentID string) {
+    k.mu.Lock()
+    defer k.mu.Unlock()
+    k.removeLocked(documentID)
+}
+
+func (k *KeywordCorpus) removeLocked(documentID string) {
+    for _, term := range k.documents[documentID] {
+        k.frequency[term]--
+        if k.frequency[term] <= 0 {
+            delete(k.frequency, term)
+        }
+    }
+    delete(k.documents, documentID)
+}
+
+// idf returns the smoothed inverse document frequency of each term. It is 1
+// for every term of an empty corpus, ranking by term frequency alone.
+func (k *KeywordCorpus) idf(terms map[string]int) map[string]float64 {
+    idf := make(map[string]float64, len(terms))
+    if k == nil {
+        for term := range terms {
+            idf[term] = 1
+        }
+        return idf
+    }
+
+    k.mu.RLock()
+    defer k.mu.RUnlock()
+    documents := float64(len(k.documents))
+    for term := range terms {
+        idf[term] = math.Log((1+documents)/(1+float64(k.frequency[term]))) + 1
+    }
+    return idf
+}
+
+// extractKeywords ranks the words and phrases of text by TF-IDF against the
+// corpus and returns the best, highest scoring first. A shorter term is left
+// out when a chosen phrase containing it accounts for most of its
+// occurrences, so "hive metastore" is not followed by "metastore".
+func extractKeywords(text string, corpus *KeywordCorpus) []models.KeywordScore {
+    counts := countKeywordTerms(text)
+    idf := corpus.idf(counts)
+
+    ranked := make([]models.KeywordScore, 0, len(counts))
+    for term, count := range counts {
+        if count < minKeywordCount {
+            continue
+        }
+        score := (1 + math.Log(float64(count))) * idf[term]
+        ranked = append(ranked, models.KeywordScore{Keyword: term, Score: math.Round(score*1000) / 1000})
+    }
+    sort.Slice(ranked, func(i, j int) bool {
+        if ranked[i].Score != ranked[j].Score {
+            return ranked[i].Score > ranked[j].Score
+        }
+        // Longer phrases first, so they can cover their words
+        wordsI, wordsJ := strings.Count(ranked[i].Keyword, " "), strings.Count(ranked[j].Keyword, " ")
+        if wordsI != wordsJ {
+            return wordsI > wordsJ
+        }
+        return ranked[i].Keyword < ranked[j].Keyword
+    })
+
+    keywords := []models.KeywordScore{}
+    for _, candidate := range ranked {
+        if len(keywords) == maxKeywords {
+            break
+        }
+        covered := false
+        for _, chosen := range keywords {
+            if containsPhrase(chosen.Keyword, candidate.Keyword) && 3*counts[chosen.Keyword] >= 2*counts[candidate.Keyword] {
+                covered = true
+                break
+            }
+        }
+        if !covered {
+            keywords = append(keywords, candidate)
+        }
+    }
+    return keywords
+}
+
+// countKeywordTerms counts the candidate keywords of text: single words and
+// phrases of up to maxPhraseWords words. Phrases do not span stopwords or
+// punctuation other than hyphens and underscores.
+func countKeywordTerms(text string) map[string]int {
+    counts := make(map[string]int)
+    var phrase []string
+
+    addWord := func(word string) {
+        if keywordStopwords[word] || !strings.ContainsFunc(word, unicode.IsLetter) || len(word) > maxKeywordLength {
+            phrase = phrase[:0]
+            return
+        }
+        if len([]rune(word)) >= minKeywordLength {
+            counts[word]++
+        }
+        phrase = append(phrase, word)
+        if len(phrase) > maxPhraseWords {
+            phrase = phrase[1:]
+        }
+        for n := 2; n <= len(phrase); n++ {
+            counts[strings.Join(phrase[len(phrase)-n:], " ")]++
+        }
+    }
+
+    var word strings.Builder
+    for _, r := range strings.ToLower(text) {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            word.WriteRune(r)
+            continue
+        }
+        if word.Len() > 0 {
+            addWord(word.String())
+            word.Reset()
+        }
+        if r != ' ' && r != '\t' && r != '-' && r != '_' {
+            phrase = phrase[:0]
+        }
+    }
+    if word.Len() > 0 {
+        addWord(word.String())
+    }
+    return counts
+}
+
+// corpusTerms returns the terms of a document counted towards document
+// frequencies: those that could be keywords, at most maxCorpusTerms of the
+// most frequent.
+func corpusTerms(counts map[string]int) []string {
+    terms := make([]string, 0, len(counts))
+    for term, count := range counts {
+        if count >= minKeywordCount {
+            terms = append(terms, term)
+        }
+    }
+    if len(terms) > maxCorpusTerms {
+        sort.Slice(terms, func(i, j int) bool {
+            if counts[terms[i]] != counts[terms[j]] {
+                return counts[terms[i]] > counts[terms[j]]
+            }
+            return terms[i] < terms[j]
+        })
+        terms = terms[:maxCorpusTerms]
+    }
+    return terms
+}
+
+// containsPhrase reports whether phrase contains term as whole words.
+func containsPhrase(phrase, term string) bool {
+    return phrase != term && strings.Contains(" "+phrase+" ", " "+term+" ")
+}
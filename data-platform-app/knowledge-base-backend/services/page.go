@@ -0,0 +1,47 @@
+package services
+
+import "fmt"
+
+// Sort orders for search results and document listings.
+const (
+    SortRelevance  = "relevance"
+    SortUploadedAt = "uploaded_at"
+    SortFileName   = "file_name"
+    SortFileSize   = "file_size"
+)
+
+// Page selects one page of sorted results.
+type Page struct {
+    Offset     int
+    Limit      int
+    Sort       string
+    Descending bool
+}
+
+// n1qlOrder returns the ORDER BY clause for documents aliased d. Without an
+// index there are no scores, so relevance falls back to upload time. The
+// document key breaks ties so pages never overlap.
+func (p Page) n1qlOrder() string {
+    direction := "ASC"
+    if p.Descending {
+        direction = "DESC"
+    }
+
+    var key string
+    switch p.Sort {
+    case SortFileName:
+        key = "LOWER(d.file_name)"
+    case SortFileSize:
+        key = "d.file_size"
+    case SortRelevance:
+        key, direction = "STR_TO_MILLIS(d.uploaded_at)", "DESC"
+    default:
+        key = "STR_TO_MILLIS(d.uploaded_at)"
+    }
+    return fmt.Sprintf(" ORDER BY %s %s, META(d).id %s", key, direction, direction)
+}
+
+// n1qlLimit returns the LIMIT and OFFSET clause for the page.
+func (p Page) n1qlLimit() string {
+    return fmt.Sprintf(" LIMIT %d OFFSET %d", p.Limit, p.Offset)
+}
@@ -8,28 +8,94 @@ import (
     "io"
     "path/filepath"
     "regexp"
+    "strconv"
     "strings"
 
     "github.com/ledongthuc/pdf"
     "github.com/xuri/excelize/v2"
+    "knowledge-base-backend/models"
 )
 
-type ParserService struct{}
+// ParserVersion identifies the extraction logic. Bump it whenever parsing,
+// keyword or error extraction changes so older documents can be reparsed.
+const ParserVersion = 7
+
+// supportedExtensions lists the file types ParseDocument understands.
+var supportedExtensions = map[string]bool{
+    ".pdf": true, ".docx": true, ".xlsx": true, ".pptx": true,
+    ".doc": true, ".xls": true, ".ppt": true,
+    ".csv": true, ".txt": true, ".log": true,
+    ".md": true, ".markdown": true, ".html": true, ".htm": true,
+    ".json": true, ".yaml": true, ".yml": true,
+}
+
+// IsSupportedFile reports whether ParseDocument can handle fileName.
+func IsSupportedFile(fileName string) bool {
+    return supportedExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+type ParserService struct {
+    corpus *KeywordCorpus // document frequencies keywords are ranked against
+}
+
+// ProgressFunc is told which stage parsing has reached. current and total
+// count units such as pages or sheets and are zero when a stage has no
+// meaningful progress.
+type ProgressFunc func(stage string, current, total int, unit string)
+
+// ParseResult is what ParseDocument extracts from a file. Text is the
+// concatenation of Sections.
+type ParseResult struct {
+    Text          string
+    Keywords      []models.KeywordScore
+    ErrorMessages []string
+    Errors        []models.ErrorRecord
+    Sections      []Section
+}
 
-func NewParserService() *ParserService {
-    return &ParserService{}
+func NewParserService(corpus *KeywordCorpus) *ParserService {
+    return &ParserService{corpus: corpus}
 }
 
-func (p *ParserService) ParseDocument(data []byte, fileName string) (text string, keywords []string, errors []string, err error) {
+func (p *ParserService) ParseDocument(data []byte, fileName string, progress ProgressFunc) (*ParseResult, error) {
     ext := strings.ToLower(filepath.Ext(fileName))
+    if progress == nil {
+        progress = func(string, int, int, string) {}
+    }
+
+    progress("parsing", 0, 0, "")
+
+    // Formats with pages, sheets, slides or headings return sections; the
+    // rest return plain text that forms a single section
+    var text string
+    var sections []Section
+    var err error
 
     switch ext {
     case ".pdf":
-        text, err = p.parsePDF(data)
+        sections, err = p.parsePDF(data, progress)
     case ".docx":
-        text, err = p.parseDOCX(data)
+        sections, err = p.parseDOCX(data)
     case ".xlsx":
-        text, err = p.parseXLSX(data)
+        sections, err = p.parseXLSX(data, progress)
+    case ".pptx":
+        sections, err = p.parsePPTX(data, progress)
+    case ".doc":
+        text, err = p.parseDOC(data)
+    case ".xls":
+        sections, err = p.parseXLS(data, progress)
+    case ".ppt":
+        sections, err = p.parsePPT(data, progress)
+    case ".html", ".htm":
+        sections, err = p.parseHTML(data)
+    case ".md", ".markdown":
+        sections = p.parseMarkdown(data)
+    case ".json":
+        text, err = p.parseJSON(data)
+    case ".yaml", ".yml":
+        text, err = p.parseYAML(data)
+    case ".log":
+        text = p.parseLog(data)
     case ".csv":
         text = string(data)
     case ".txt":
@@ -39,29 +105,42 @@ func (p *ParserService) ParseDocument(data []byte, fileName string) (text string
     }
 
     if err != nil {
-        return "", nil, nil, err
+        return nil, err
     }
 
-    // Extract keywords (simple word frequency)
-    keywords = p.extractKeywords(text)
-
-    // Extract error messages
-    errors = p.extractErrorMessages(text)
+    if sections != nil {
+        text = joinSections(sections)
+    } else {
+        sections = []Section{{Text: text}}
+    }
 
-    return text, keywords, errors, nil
+    progress("extracting_keywords", 0, 0, "")
+    errors := p.extractErrors(text)
+
+    return &ParseResult{
+        Text: text,
+        // Extract keywords ranked by TF-IDF
+        Keywords: extractKeywords(text, p.corpus),
+        // Extract structured errors and their messages
+        ErrorMessages: errorMessages(errors),
+        Errors:        errors,
+        Sections:      sections,
+    }, nil
 }
 
-func (p *ParserService) parsePDF(data []byte) (string, error) {
+func (p *ParserService) parsePDF(data []byte, progress ProgressFunc) ([]Section, error) {
     reader := bytes.NewReader(data)
     pdfReader, err := pdf.NewReader(reader, int64(len(data)))
     if err != nil {
-        return "", fmt.Errorf("failed to read PDF: %v", err)
+        return nil, fmt.Errorf("failed to read PDF: %v", err)
     }
 
-    var text strings.Builder
+    var sections []Section
     numPages := pdfReader.NumPage()
 
     for i := 1; i <= numPages; i++ {
+        progress("parsing", i, numPages, "page")
+
         page := pdfReader.Page(i)
         if page.V.IsNull() {
             continue
@@ -71,19 +150,18 @@ func (p *ParserService) parsePDF(data []byte) (string, error) {
         if err != nil {
             continue
         }
-        text.WriteString(pageText)
-        text.WriteString("\n")
+        sections = append(sections, Section{Text: pageText + "\n", Page: i})
     }
 
-    return text.String(), nil
+    return sections, nil
 }
 
 // FIXED: Parse DOCX using xml extraction
-func (p *ParserService) parseDOCX(data []byte) (string, error) {
+func (p *ParserService) parseDOCX(data []byte) ([]Section, error) {
     reader := bytes.NewReader(data)
     zipReader, err := zip.NewReader(reader, int64(len(data)))
     if err != nil {
-        return "", fmt.Errorf("failed to read DOCX as zip: %v", err)
+        return nil, fmt.Errorf("failed to read DOCX as zip: %v", err)
     }
 
     // Find document.xml
@@ -96,19 +174,19 @@ func (p *ParserService) parseDOCX(data []byte) (string, error) {
     }
 
     if documentXML == nil {
-        return "", fmt.Errorf("document.xml not found in DOCX")
+        return nil, fmt.Errorf("document.xml not found in DOCX")
     }
 
     // Read document.xml
     rc, err := documentXML.Open()
     if err != nil {
-        return "", fmt.Errorf("failed to open document.xml: %v", err)
+        return nil, fmt.Errorf("failed to open document.xml: %v", err)
     }
     defer rc.Close()
 
     xmlData, err := io.ReadAll(rc)
     if err != nil {
-        return "", fmt.Errorf("failed to read document.xml: %v", err)
+        return nil, fmt.Errorf("failed to read document.xml: %v", err)
     }
 
     // Parse XML to extract text
@@ -118,8 +196,16 @@ func (p *ParserService) parseDOCX(data []byte) (string, error) {
     type Run struct {
         Text []Text `xml:"t"`
     }
+    type Val struct {
+        Value string `xml:"val,attr"`
+    }
+    type ParagraphProperties struct {
+        Style        *Val `xml:"pStyle"`
+        OutlineLevel *Val `xml:"outlineLvl"`
+    }
     type Paragraph struct {
-        Runs []Run `xml:"r"`
+        Properties ParagraphProperties `xml:"pPr"`
+        Runs       []Run               `xml:"r"`
     }
     type Body struct {
         Paragraphs []Paragraph `xml:"p"`
@@ -130,111 +216,81 @@ func (p *ParserService) parseDOCX(data []byte) (string, error) {
 
     var doc Document
     if err := xml.Unmarshal(xmlData, &doc); err != nil {
-        return "", fmt.Errorf("failed to parse XML: %v", err)
+        return nil, fmt.Errorf("failed to parse XML: %v", err)
     }
 
-    // Extract text
-    var text strings.Builder
+    // Extract text, starting a new section at every heading
+    var text headingSections
     for _, para := range doc.Body.Paragraphs {
+        var line strings.Builder
         for _, run := range para.Runs {
             for _, t := range run.Text {
-                text.WriteString(t.Value)
+                line.WriteString(t.Value)
+            }
+        }
+
+        level := 0
+        if para.Properties.Style != nil {
+            level = docxHeadingLevel(para.Properties.Style.Value)
+        }
+        if level == 0 && para.Properties.OutlineLevel != nil {
+            if n, err := strconv.Atoi(para.Properties.OutlineLevel.Value); err == nil && n < 9 {
+                level = n + 1
             }
         }
+        if title := strings.TrimSpace(line.String()); level > 0 && title != "" {
+            text.startSection(level, title)
+        }
+
+        text.WriteString(line.String())
         text.WriteString("\n")
     }
 
-    return text.String(), nil
+    return text.sections(), nil
+}
+
+var docxHeadingStyle = regexp.MustCompile(`(?i)^heading\s*([1-9])$`)
+
+// docxHeadingLevel maps the built-in Title and Heading1-9 paragraph styles to
+// a heading level, returning 0 for other styles.
+func docxHeadingLevel(style string) int {
+    if strings.EqualFold(style, "Title") {
+        return 1
+    }
+    if m := docxHeadingStyle.FindStringSubmatch(style); m != nil {
+        return int(m[1][0] - '0')
+    }
+    return 0
 }
 
-func (p *ParserService) parseXLSX(data []byte) (string, error) {
+func (p *ParserService) parseXLSX(data []byte, progress ProgressFunc) ([]Section, error) {
     reader := bytes.NewReader(data)
     f, err := excelize.OpenReader(reader)
     if err != nil {
-        return "", fmt.Errorf("failed to read XLSX: %v", err)
+        return nil, fmt.Errorf("failed to read XLSX: %v", err)
     }
     defer f.Close()
 
-    var text strings.Builder
-    
-    for _, sheetName := range f.GetSheetList() {
+    var sections []Section
+
+    sheets := f.GetSheetList()
+    for i, sheetName := range sheets {
+        progress("parsing", i+1, len(sheets), "sheet")
+
         rows, err := f.GetRows(sheetName)
         if err != nil {
             continue
         }
 
+        var text strings.Builder
         text.WriteString(fmt.Sprintf("Sheet: %s\n", sheetName))
         for _, row := range rows {
             text.WriteString(strings.Join(row, "\t"))
             text.WriteString("\n")
         }
         text.WriteString("\n")
+        sections = append(sections, Section{Text: text.String(), Sheet: sheetName})
     }
 
-    return text.String(), nil
-}
-
-func (p *ParserService) extractKeywords(text string) []string {
-    // Simple keyword extraction: words that appear frequently
-    words := strings.Fields(strings.ToLower(text))
-    wordCount := make(map[string]int)
-
-    for _, word := range words {
-        // Remove punctuation
-        word = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(word, "")
-        if len(word) > 3 { // Only words longer than 3 chars
-            wordCount[word]++
-        }
-    }
-
-    // Get top keywords
-    var keywords []string
-    for word, count := range wordCount {
-        if count >= 3 { // Appears at least 3 times
-            keywords = append(keywords, word)
-        }
-    }
-
-    // Limit to top 20
-    if len(keywords) > 20 {
-        keywords = keywords[:20]
-    }
-
-    return keywords
-}
-
-func (p *ParserService) extractErrorMessages(text string) []string {
-    // Look for common error patterns
-    patterns := []string{
-        `(?i)error[:\s]+(.{10,100})`,
-        `(?i)exception[:\s]+(.{10,100})`,
-        `(?i)failed[:\s]+(.{10,100})`,
-        `(?i)critical[:\s]+(.{10,100})`,
-        `(?i)warning[:\s]+(.{10,100})`,
-    }
-
-    var errors []string
-    seen := make(map[string]bool)
-
-    for _, pattern := range patterns {
-        re := regexp.MustCompile(pattern)
-        matches := re.FindAllStringSubmatch(text, -1)
-        
-        for _, match := range matches {
-            if len(match) > 1 {
-                errorMsg := strings.TrimSpace(match[1])
-                if !seen[errorMsg] && len(errorMsg) > 10 {
-                    errors = append(errors, errorMsg)
-                    seen[errorMsg] = true
-                }
-            }
-        }
-    }
-
-    // Limit to top 10
-    if len(errors) > 10 {
-        errors = errors[:10]
-    }
-
-    return errors
+    return sections, nil
 }
@@ -0,0 +1,223 @@
+package services
+
+import (
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "knowledge-base-backend/models"
+)
+
+const (
+    // maxErrorRecords caps the distinct errors kept per document.
+    maxErrorRecords = 50
+    // maxErrorMessages caps the flat error messages kept per document.
+    maxErrorMessages = 20
+    // maxErrorMessageLength truncates long messages.
+    maxErrorMessageLength = 300
+)
+
+var (
+    // Log4j, logback and most Java and Go loggers: an optional timestamp and
+    // thread, the level, an optional thread, the logger and the message, e.g.
+    //   2024-03-01 10:00:00,123 ERROR [main] org.apache.hadoop.Foo: message
+    //   10:00:00.123 [main] ERROR o.a.h.Foo - message
+    logLinePattern = regexp.MustCompile(`^(?:.*?\s)?(?:\[[^\]]*\]\s+)?\[?(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|SEVERE|FATAL|CRITICAL)\]?\s+(?:\[[^\]]*\]\s+)?([A-Za-z_$][\w$-]*(?:\.[A-Za-z_$][\w$-]*)*)(?::\d+)?\s*[-:]\s+(.*)$`)
+    // Python's logging.basicConfig format: ERROR:module.name:message
+    pythonLogPattern = regexp.MustCompile(`^(CRITICAL|ERROR|WARNING):([\w.]+):(.*)$`)
+
+    javaExceptionPattern = regexp.MustCompile(`^\s*(?:Caused by:\s*|Exception in thread "[^"]*"\s+)?((?:[a-zA-Z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable|Fault))(?::\s*(.*))?$`)
+    javaFramePattern     = regexp.MustCompile(`^\s*at\s+([\w$.<>/-]+\([^)]*\))`)
+    javaMoreFramesLine   = regexp.MustCompile(`^\s*\.\.\. \d+ (?:more|common frames omitted)`)
+
+    pythonTracebackLine    = regexp.MustCompile(`^\s*Traceback \(most recent call last\):`)
+    pythonFramePattern     = regexp.MustCompile(`^\s*File "([^"]+)", line (\d+), in (\S+)`)
+    pythonExceptionPattern = regexp.MustCompile(`^([A-Za-z_][\w.]*(?:Error|Exception|Exit|Interrupt|Warning|Fault))(?::\s*(.*))?$`)
+
+    // "GET /path HTTP/1.1" 503 in access logs, or "HTTP 503", "status: 404"
+    // and "response code=500" in messages
+    httpAccessPattern = regexp.MustCompile(`"[A-Z]+ \S+ HTTP/[\d.]+" ([45]\d\d)\b`)
+    httpStatusPattern = regexp.MustCompile(`(?i)\b(?:HTTP(?:/[\d.]+)?|status(?: code)?|response code)[\s:=]+([45]\d\d)\b`)
+
+    errorCodePattern = regexp.MustCompile(`\b(ORA-\d{5}|SQLSTATE[ =:\[]*\w{5}|errno[ =:]+-?\d+|(?i:error[ _]code)[ =:]+[\w.-]+|(?i:exit (?:code|status))[ =:]+\d+)`)
+
+    // Anything else that reads like an error, as the extractor did before
+    // it understood log formats
+    genericErrorPattern = regexp.MustCompile(`(?i)\b(?:error|exception|failed|fatal|critical)\b:\s*(.{10,200})`)
+)
+
+// errorLevels are the log levels worth recording, normalized.
+var errorLevels = map[string]string{
+    "WARN":     "WARN",
+    "WARNING":  "WARN",
+    "ERROR":    "ERROR",
+    "SEVERE":   "ERROR",
+    "FATAL":    "FATAL",
+    "CRITICAL": "FATAL",
+}
+
+// extractErrors finds the errors in text: log records at warning level or
+// above, Java stack traces, Python tracebacks, HTTP error statuses and,
+// failing those, lines that read like errors. Repeated errors are counted
+// once in order of first appearance.
+func (p *ParserService) extractErrors(text string) []models.ErrorRecord {
+    lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+    records := newErrorRecords()
+
+    for i := 0; i < len(lines); i++ {
+        line := strings.TrimRight(lines[i], " \t")
+
+        if match := logLinePattern.FindStringSubmatch(line); match != nil {
+            if level, ok := errorLevels[match[1]]; ok {
+                record := models.ErrorRecord{LogLevel: level, Component: match[2], Message: match[3]}
+                // The stack trace of a logged exception follows the record
+                i = attachTrace(&record, lines, i+1) - 1
+                records.add(record)
+            }
+            continue
+        }
+        if match := pythonLogPattern.FindStringSubmatch(line); match != nil {
+            record := models.ErrorRecord{LogLevel: errorLevels[match[1]], Component: match[2], Message: match[3]}
+            i = attachTrace(&record, lines, i+1) - 1
+            records.add(record)
+            continue
+        }
+        if javaExceptionPattern.MatchString(line) || pythonTracebackLine.MatchString(line) {
+            var record models.ErrorRecord
+            i = attachTrace(&record, lines, i) - 1
+            records.add(record)
+            continue
+        }
+        if match := httpAccessPattern.FindStringSubmatch(line); match != nil {
+            records.add(httpErrorRecord(match[1]))
+            continue
+        }
+        if match := genericErrorPattern.FindStringSubmatch(line); match != nil {
+            records.add(models.ErrorRecord{Message: match[1]})
+        }
+    }
+    return records.list
+}
+
+// attachTrace reads a Java stack trace or Python traceback starting at line
+// start into record and returns the line after it. The exception only fills
+// in what the log record did not say; without a trace start is returned.
+func attachTrace(record *models.ErrorRecord, lines []string, start int) int {
+    if start >= len(lines) {
+        return start
+    }
+
+    if match := javaExceptionPattern.FindStringSubmatch(lines[start]); match != nil {
+        record.ExceptionClass = match[1]
+        if record.Message == "" {
+            record.Message = match[2]
+        }
+        i := start + 1
+        for ; i < len(lines); i++ {
+            if frame := javaFramePattern.FindStringSubmatch(lines[i]); frame != nil {
+                if record.FirstFrame == "" {
+                    record.FirstFrame = frame[1]
+                }
+            } else if !javaMoreFramesLine.MatchString(lines[i]) {
+                break
+            }
+        }
+        return i
+    }
+
+    if pythonTracebackLine.MatchString(lines[start]) {
+        i := start + 1
+        for ; i < len(lines); i++ {
+            line := lines[i]
+            if frame := pythonFramePattern.FindStringSubmatch(line); frame != nil {
+                // The innermost call, where the exception was raised, is last
+                record.FirstFrame = frame[1] + ":" + frame[2] + " in " + frame[3]
+                continue
+            }
+            if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+                continue // the source line of a frame
+            }
+            if match := pythonExceptionPattern.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+                record.ExceptionClass = match[1]
+                if record.Message == "" {
+                    record.Message = match[2]
+                }
+                return i + 1
+            }
+            break
+        }
+        return i
+    }
+
+    return start
+}
+
+func httpErrorRecord(status string) models.ErrorRecord {
+    code, _ := strconv.Atoi(status)
+    return models.ErrorRecord{ErrorCode: "HTTP " + status, Message: status + " " + http.StatusText(code)}
+}
+
+// errorRecords collects distinct errors, counting repeats.
+type errorRecords struct {
+    list  []models.ErrorRecord
+    index map[string]int
+}
+
+func newErrorRecords() *errorRecords {
+    return &errorRecords{index: make(map[string]int)}
+}
+
+func (r *errorRecords) add(record models.ErrorRecord) {
+    record.Message = strings.TrimSpace(record.Message)
+    if len(record.Message) > maxErrorMessageLength {
+        record.Message = strings.TrimSpace(record.Message[:splitPoint(record.Message, maxErrorMessageLength)])
+    }
+    if record.ErrorCode == "" {
+        if match := errorCodePattern.FindString(record.Message); match != "" {
+            record.ErrorCode = match
+        } else if match := httpStatusPattern.FindStringSubmatch(record.Message); match != nil {
+            record.ErrorCode = "HTTP " + match[1]
+        }
+    }
+    if record.Message == "" && record.ExceptionClass == "" && record.ErrorCode == "" {
+        return
+    }
+
+    key := strings.Join([]string{record.ExceptionClass, record.Message, record.ErrorCode, record.LogLevel, record.Component}, "\x00")
+    if i, ok := r.index[key]; ok {
+        r.list[i].Count++
+        return
+    }
+    if len(r.list) == maxErrorRecords {
+        return
+    }
+    record.Count = 1
+    r.index[key] = len(r.list)
+    r.list = append(r.list, record)
+}
+
+// errorMessages flattens error records into the messages searched as
+// error_messages, such as "java.io.IOException: Connection refused".
+func errorMessages(records []models.ErrorRecord) []string {
+    var messages []string
+    seen := make(map[string]bool)
+    for _, record := range records {
+        message := record.Message
+        switch {
+        case record.ExceptionClass != "" && message != "":
+            message = record.ExceptionClass + ": " + message
+        case record.ExceptionClass != "":
+            message = record.ExceptionClass
+        }
+        if message == "" || seen[message] {
+            continue
+        }
+        seen[message] = true
+        messages = append(messages, message)
+        if len(messages) == maxErrorMessages {
+            break
+        }
+    }
+    return messages
+}
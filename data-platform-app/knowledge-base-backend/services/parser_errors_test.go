@@ -0,0 +1,101 @@
+package services
+
+import (
+    "slices"
+    "testing"
+
+    "knowledge-base-backend/models"
+)
+
+func TestExtractErrors(t *testing.T) {
+    tests := []struct {
+        name  string
+        input string
+        want  []models.ErrorRecord
+    }{
+        {
+            name: "log4j record with a cause",
+            input: "2024-03-01 10:00:00,123 ERROR [main] org.apache.hadoop.hdfs.DFSClient: Failed to connect to namenode\n" +
+                "java.io.IOException: Connection refused\n" +
+                "\tat org.apache.hadoop.ipc.Client.call(Client.java:1476)\n" +
+                "\tat org.apache.hadoop.ipc.Client.call(Client.java:1413)\n" +
+                "Caused by: java.net.ConnectException: Connection refused\n" +
+                "\tat sun.nio.ch.SocketChannelImpl.checkConnect(Native Method)\n" +
+                "\t... 12 more\n" +
+                "2024-03-01 10:00:01,000 INFO [main] org.apache.hadoop.hdfs.DFSClient: retrying\n",
+            want: []models.ErrorRecord{
+                {
+                    ExceptionClass: "java.io.IOException",
+                    Message:        "Failed to connect to namenode",
+                    LogLevel:       "ERROR",
+                    Component:      "org.apache.hadoop.hdfs.DFSClient",
+                    FirstFrame:     "org.apache.hadoop.ipc.Client.call(Client.java:1476)",
+                    Count:          1,
+                },
+                {
+                    ExceptionClass: "java.net.ConnectException",
+                    Message:        "Connection refused",
+                    FirstFrame:     "sun.nio.ch.SocketChannelImpl.checkConnect(Native Method)",
+                    Count:          1,
+                },
+            },
+        },
+        {
+            name: "python traceback",
+            input: "Traceback (most recent call last):\n" +
+                "  File \"/opt/app/main.py\", line 10, in <module>\n" +
+                "    run()\n" +
+                "  File \"/opt/app/jobs.py\", line 42, in run\n" +
+                "    conn = connect(host)\n" +
+                "ConnectionRefusedError: [Errno 111] Connection refused\n",
+            want: []models.ErrorRecord{
+                {
+                    ExceptionClass: "ConnectionRefusedError",
+                    Message:        "[Errno 111] Connection refused",
+                    FirstFrame:     "/opt/app/jobs.py:42 in run",
+                    Count:          1,
+                },
+            },
+        },
+        {
+            name: "access log 5xx",
+            input: `10.0.0.1 - - [01/Mar/2024:10:00:00 +0000] "GET /api/v1/status HTTP/1.1" 200 512` + "\n" +
+                `10.0.0.1 - - [01/Mar/2024:10:00:01 +0000] "POST /api/v1/jobs HTTP/1.1" 503 0` + "\n",
+            want: []models.ErrorRecord{
+                {ErrorCode: "HTTP 503", Message: "503 Service Unavailable", Count: 1},
+            },
+        },
+        {
+            name: "repeated error counted once",
+            input: "10:00:00.123 [worker-1] ERROR c.e.Sync - ORA-00942: table or view does not exist\n" +
+                "10:00:01.456 [worker-2] ERROR c.e.Sync - ORA-00942: table or view does not exist\n" +
+                "10:00:02.789 [worker-1] WARN c.e.Sync - slow query\n" +
+                "10:00:03.000 [worker-3] ERROR c.e.Sync - ORA-00942: table or view does not exist\n",
+            want: []models.ErrorRecord{
+                {
+                    Message:   "ORA-00942: table or view does not exist",
+                    ErrorCode: "ORA-00942",
+                    LogLevel:  "ERROR",
+                    Component: "c.e.Sync",
+                    Count:     3,
+                },
+                {Message: "slow query", LogLevel: "WARN", Component: "c.e.Sync", Count: 1},
+            },
+        },
+        {
+            name:  "no errors",
+            input: "2024-03-01 10:00:00,123 INFO [main] org.example.App: started\nall good\n",
+            want:  nil,
+        },
+    }
+
+    p := NewParserService(nil)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := p.extractErrors(tt.input)
+            if !slices.Equal(got, tt.want) {
+                t.Errorf("got %+v\nwant %+v", got, tt.want)
+            }
+        })
+    }
+}
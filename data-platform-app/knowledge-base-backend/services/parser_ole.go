@@ -0,0 +1,775 @@
+package services
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "math"
+    "sort"
+    "strings"
+    "unicode/utf16"
+
+    "github.com/richardlehane/mscfb"
+    "golang.org/x/text/encoding/charmap"
+)
+
+// readCFBStreams returns the requested root-level streams of an OLE2/CFB
+// compound document. Missing streams are simply absent from the result.
+func readCFBStreams(data []byte, names ...string) (map[string][]byte, error) {
+    doc, err := mscfb.New(bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read compound document: %v", err)
+    }
+
+    wanted := make(map[string]bool, len(names))
+    for _, name := range names {
+        wanted[name] = true
+    }
+
+    streams := make(map[string][]byte)
+    for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+        if len(entry.Path) != 0 || !wanted[entry.Name] {
+            continue
+        }
+        stream, err := io.ReadAll(entry)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s stream: %v", entry.Name, err)
+        }
+        streams[entry.Name] = stream
+    }
+
+    return streams, nil
+}
+
+// decodeUTF16LE decodes little-endian UTF-16 code units.
+func decodeUTF16LE(b []byte) string {
+    units := make([]uint16, len(b)/2)
+    for i := range units {
+        units[i] = binary.LittleEndian.Uint16(b[i*2:])
+    }
+    return string(utf16.Decode(units))
+}
+
+// decodeCP1252 decodes the 8-bit "compressed" text used by Office binaries.
+func decodeCP1252(b []byte) string {
+    text, err := charmap.Windows1252.NewDecoder().Bytes(b)
+    if err != nil {
+        return string(b)
+    }
+    return string(text)
+}
+
+// parseDOC extracts the text of a Word 97-2003 binary document by following
+// the piece table (CLX) in the table stream to the text in WordDocument.
+func (p *ParserService) parseDOC(data []byte) (string, error) {
+    streams, err := readCFBStreams(data, "WordDocument", "0Table", "1Table")
+    if err != nil {
+        return "", err
+    }
+
+    wordDoc := streams["WordDocument"]
+    if len(wordDoc) < 34 || binary.LittleEndian.Uint16(wordDoc) != 0xA5EC {
+        return "", fmt.Errorf("not a Word 97-2003 document")
+    }
+
+    flags := binary.LittleEndian.Uint16(wordDoc[0x0A:])
+    if flags&0x0100 != 0 {
+        return "", fmt.Errorf("encrypted Word documents are not supported")
+    }
+
+    tableName := "0Table"
+    if flags&0x0200 != 0 {
+        tableName = "1Table"
+    }
+    table, ok := streams[tableName]
+    if !ok {
+        return "", fmt.Errorf("%s stream not found in DOC", tableName)
+    }
+
+    // The FIB is variable length: skip FibRgW and FibRgLw to reach
+    // FibRgFcLcb, where fcClx/lcbClx is the 34th pair
+    csw := int(binary.LittleEndian.Uint16(wordDoc[32:]))
+    lwOffset := 32 + 2 + csw*2
+    if len(wordDoc) < lwOffset+2 {
+        return "", fmt.Errorf("truncated Word FIB")
+    }
+    cslw := int(binary.LittleEndian.Uint16(wordDoc[lwOffset:]))
+    fcLcbOffset := lwOffset + 2 + cslw*4 + 2
+    clxOffset := fcLcbOffset + 33*8
+    if len(wordDoc) < clxOffset+8 {
+        return "", fmt.Errorf("truncated Word FIB")
+    }
+    fcClx := binary.LittleEndian.Uint32(wordDoc[clxOffset:])
+    lcbClx := binary.LittleEndian.Uint32(wordDoc[clxOffset+4:])
+    if uint64(fcClx)+uint64(lcbClx) > uint64(len(table)) {
+        return "", fmt.Errorf("piece table out of range")
+    }
+
+    clx := table[fcClx : fcClx+lcbClx]
+
+    // Skip Prc entries (property modifiers) to reach the Pcdt
+    pos := 0
+    for pos < len(clx) && clx[pos] == 0x01 {
+        if pos+3 > len(clx) {
+            return "", fmt.Errorf("truncated piece table")
+        }
+        pos += 3 + int(binary.LittleEndian.Uint16(clx[pos+1:]))
+    }
+    if pos+5 > len(clx) || clx[pos] != 0x02 {
+        return "", fmt.Errorf("piece table not found")
+    }
+    lcb := int(binary.LittleEndian.Uint32(clx[pos+1:]))
+    plc := clx[pos+5:]
+    if lcb > len(plc) || lcb < 4 {
+        return "", fmt.Errorf("truncated piece table")
+    }
+    plc = plc[:lcb]
+
+    // PlcPcd: n+1 character positions followed by n 8-byte piece descriptors
+    n := (lcb - 4) / 12
+    var raw strings.Builder
+    for i := 0; i < n; i++ {
+        cpStart := binary.LittleEndian.Uint32(plc[i*4:])
+        cpEnd := binary.LittleEndian.Uint32(plc[(i+1)*4:])
+        if cpEnd <= cpStart {
+            continue
+        }
+        cch := int(cpEnd - cpStart)
+
+        pcd := plc[(n+1)*4+i*8:]
+        fc := binary.LittleEndian.Uint32(pcd[2:])
+        if fc&0x40000000 != 0 {
+            start := int(fc&0x3FFFFFFF) / 2
+            if start+cch > len(wordDoc) {
+                continue
+            }
+            raw.WriteString(decodeCP1252(wordDoc[start : start+cch]))
+        } else {
+            start := int(fc)
+            if start+cch*2 > len(wordDoc) {
+                continue
+            }
+            raw.WriteString(decodeUTF16LE(wordDoc[start : start+cch*2]))
+        }
+    }
+
+    return cleanWordText(raw.String()), nil
+}
+
+// cleanWordText turns Word's in-band control characters into plain text:
+// paragraph and cell marks become line breaks and tabs, and field
+// instructions are dropped while field results are kept.
+func cleanWordText(raw string) string {
+    var text strings.Builder
+    fieldDepth := 0
+    inInstruction := []bool{}
+
+    for _, r := range raw {
+        switch r {
+        case 0x13: // field begin
+            fieldDepth++
+            inInstruction = append(inInstruction, true)
+            continue
+        case 0x14: // field separator
+            if fieldDepth > 0 {
+                inInstruction[fieldDepth-1] = false
+            }
+            continue
+        case 0x15: // field end
+            if fieldDepth > 0 {
+                fieldDepth--
+                inInstruction = inInstruction[:fieldDepth]
+            }
+            continue
+        }
+
+        if fieldDepth > 0 && inInstruction[fieldDepth-1] {
+            continue
+        }
+
+        switch {
+        case r == '\r' || r == 0x0B || r == 0x0C:
+            text.WriteRune('\n')
+        case r == 0x07:
+            text.WriteRune('\t')
+        case r == '\t' || r >= 0x20:
+            text.WriteRune(r)
+        }
+    }
+
+    return text.String()
+}
+
+// BIFF8 record types used when reading .xls workbooks.
+const (
+    biffFormula    = 0x0006
+    biffEOF        = 0x000A
+    biffFilePass   = 0x002F
+    biffContinue   = 0x003C
+    biffBoundSheet = 0x0085
+    biffMulRK      = 0x00BD
+    biffSST        = 0x00FC
+    biffLabelSST   = 0x00FD
+    biffNumber     = 0x0203
+    biffLabel      = 0x0204
+    biffBoolErr    = 0x0205
+    biffString     = 0x0207
+    biffRK         = 0x027E
+    biffBOF        = 0x0809
+)
+
+type biffRecord struct {
+    offset int
+    typ    uint16
+    data   []byte
+}
+
+type biffSheet struct {
+    name  string
+    cells map[int]map[int]string
+}
+
+func (s *biffSheet) set(row, col int, value string) {
+    if s.cells[row] == nil {
+        s.cells[row] = make(map[int]string)
+    }
+    s.cells[row][col] = value
+}
+
+// parseXLS extracts cell values from an Excel 97-2003 (BIFF8) workbook,
+// writing them sheet by sheet in the same layout as parseXLSX.
+func (p *ParserService) parseXLS(data []byte, progress ProgressFunc) ([]Section, error) {
+    streams, err := readCFBStreams(data, "Workbook", "Book")
+    if err != nil {
+        return nil, err
+    }
+
+    workbook, ok := streams["Workbook"]
+    if !ok {
+        if _, old := streams["Book"]; old {
+            return nil, fmt.Errorf("Excel 5.0/95 workbooks are not supported")
+        }
+        return nil, fmt.Errorf("Workbook stream not found in XLS")
+    }
+
+    var records []biffRecord
+    for pos := 0; pos+4 <= len(workbook); {
+        typ := binary.LittleEndian.Uint16(workbook[pos:])
+        size := int(binary.LittleEndian.Uint16(workbook[pos+2:]))
+        if pos+4+size > len(workbook) {
+            break
+        }
+        records = append(records, biffRecord{offset: pos, typ: typ, data: workbook[pos+4 : pos+4+size]})
+        pos += 4 + size
+    }
+
+    sheetNames := make(map[int]string)
+    var sheetOrder []int
+    var sst []string
+    var sheets []*biffSheet
+    var current *biffSheet
+
+    for i := 0; i < len(records); i++ {
+        rec := records[i]
+        d := rec.data
+
+        switch rec.typ {
+        case biffFilePass:
+            return nil, fmt.Errorf("encrypted Excel workbooks are not supported")
+
+        case biffBoundSheet:
+            if len(d) < 8 {
+                continue
+            }
+            offset := int(binary.LittleEndian.Uint32(d))
+            name, _ := readBIFFString(d[6:], 1)
+            sheetNames[offset] = name
+            sheetOrder = append(sheetOrder, offset)
+
+        case biffSST:
+            segments := [][]byte{d}
+            for i+1 < len(records) && records[i+1].typ == biffContinue {
+                i++
+                segments = append(segments, records[i].data)
+            }
+            sst = readSST(segments)
+
+        case biffBOF:
+            if name, ok := sheetNames[rec.offset]; ok {
+                current = &biffSheet{name: name, cells: make(map[int]map[int]string)}
+                sheets = append(sheets, current)
+            } else {
+                current = nil
+            }
+
+        case biffEOF:
+            current = nil
+        }
+
+        if current == nil || len(d) < 6 {
+            continue
+        }
+        row := int(binary.LittleEndian.Uint16(d))
+        col := int(binary.LittleEndian.Uint16(d[2:]))
+
+        switch rec.typ {
+        case biffLabelSST:
+            if len(d) >= 10 {
+                if idx := int(binary.LittleEndian.Uint32(d[6:])); idx < len(sst) {
+                    current.set(row, col, sst[idx])
+                }
+            }
+        case biffLabel:
+            if value, ok := readBIFFString(d[6:], 2); ok {
+                current.set(row, col, value)
+            }
+        case biffNumber:
+            if len(d) >= 14 {
+                current.set(row, col, formatBIFFNumber(math.Float64frombits(binary.LittleEndian.Uint64(d[6:]))))
+            }
+        case biffRK:
+            if len(d) >= 10 {
+                current.set(row, col, formatBIFFNumber(decodeRK(binary.LittleEndian.Uint32(d[6:]))))
+            }
+        case biffMulRK:
+            for c, pos := col, 4; pos+6 <= len(d)-2; c, pos = c+1, pos+6 {
+                current.set(row, c, formatBIFFNumber(decodeRK(binary.LittleEndian.Uint32(d[pos+2:]))))
+            }
+        case biffBoolErr:
+            if len(d) >= 8 && d[7] == 0 {
+                current.set(row, col, map[bool]string{true: "TRUE", false: "FALSE"}[d[6] != 0])
+            }
+        case biffFormula:
+            if len(d) < 14 {
+                continue
+            }
+            // String results (type 0) follow in a STRING record, see below
+            value := d[6:14]
+            if value[6] != 0xFF || value[7] != 0xFF {
+                current.set(row, col, formatBIFFNumber(math.Float64frombits(binary.LittleEndian.Uint64(value))))
+            } else if value[0] == 1 {
+                current.set(row, col, map[bool]string{true: "TRUE", false: "FALSE"}[value[2] != 0])
+            }
+        }
+    }
+
+    // STRING records carry no cell address, so a second pass pairs them with
+    // the formula that preceded them
+    current = nil
+    pending := [2]int{-1, -1}
+    for _, rec := range records {
+        switch rec.typ {
+        case biffBOF:
+            current = nil
+            for _, sheet := range sheets {
+                if sheetNames[rec.offset] == sheet.name {
+                    current = sheet
+                }
+            }
+        case biffFormula:
+            if len(rec.data) >= 14 && rec.data[12] == 0xFF && rec.data[13] == 0xFF && rec.data[6] == 0 {
+                pending = [2]int{int(binary.LittleEndian.Uint16(rec.data)), int(binary.LittleEndian.Uint16(rec.data[2:]))}
+            }
+        case biffString:
+            if current != nil && pending[0] >= 0 {
+                if value, ok := readBIFFString(rec.data, 2); ok {
+                    current.set(pending[0], pending[1], value)
+                }
+            }
+            pending = [2]int{-1, -1}
+        }
+    }
+
+    var sections []Section
+    for i, sheet := range sheets {
+        progress("parsing", i+1, len(sheets), "sheet")
+
+        var text strings.Builder
+        text.WriteString(fmt.Sprintf("Sheet: %s\n", sheet.name))
+
+        rows := make([]int, 0, len(sheet.cells))
+        for row := range sheet.cells {
+            rows = append(rows, row)
+        }
+        sort.Ints(rows)
+
+        for _, row := range rows {
+            maxCol := 0
+            for col := range sheet.cells[row] {
+                if col > maxCol {
+                    maxCol = col
+                }
+            }
+            values := make([]string, maxCol+1)
+            for col, value := range sheet.cells[row] {
+                values[col] = value
+            }
+            text.WriteString(strings.Join(values, "\t"))
+            text.WriteString("\n")
+        }
+        text.WriteString("\n")
+        sections = append(sections, Section{Text: text.String(), Sheet: sheet.name})
+    }
+
+    return sections, nil
+}
+
+// readBIFFString reads an XLUnicodeString whose character count is stored
+// in lenSize (1 or 2) bytes, followed by an option byte.
+func readBIFFString(b []byte, lenSize int) (string, bool) {
+    if len(b) < lenSize+1 {
+        return "", false
+    }
+    cch := int(b[0])
+    if lenSize == 2 {
+        cch = int(binary.LittleEndian.Uint16(b))
+    }
+    highByte := b[lenSize]&0x01 != 0
+    chars := b[lenSize+1:]
+
+    if highByte {
+        if len(chars) < cch*2 {
+            cch = len(chars) / 2
+        }
+        return decodeUTF16LE(chars[:cch*2]), true
+    }
+    if len(chars) < cch {
+        cch = len(chars)
+    }
+    return decodeCP1252(chars[:cch]), true
+}
+
+// sstReader walks the shared string table across its CONTINUE records.
+// Character data that crosses a record boundary restarts with a fresh option
+// byte saying whether the rest is 8- or 16-bit.
+type sstReader struct {
+    segments [][]byte
+    seg      int
+    pos      int
+}
+
+func (r *sstReader) remaining() int {
+    if r.seg >= len(r.segments) {
+        return 0
+    }
+    return len(r.segments[r.seg]) - r.pos
+}
+
+// left is the number of bytes remaining across all segments.
+func (r *sstReader) left() int {
+    n := r.remaining()
+    for _, segment := range r.segments[min(r.seg+1, len(r.segments)):] {
+        n += len(segment)
+    }
+    return n
+}
+
+func (r *sstReader) advance() bool {
+    for r.remaining() == 0 {
+        if r.seg >= len(r.segments)-1 {
+            return false
+        }
+        r.seg++
+        r.pos = 0
+    }
+    return true
+}
+
+func (r *sstReader) bytes(n int) ([]byte, bool) {
+    // Lengths come from the file, so never allocate more than it holds
+    if n > r.left() {
+        return nil, false
+    }
+    out := make([]byte, 0, n)
+    for len(out) < n {
+        if !r.advance() {
+            return nil, false
+        }
+        take := n - len(out)
+        if take > r.remaining() {
+            take = r.remaining()
+        }
+        out = append(out, r.segments[r.seg][r.pos:r.pos+take]...)
+        r.pos += take
+    }
+    return out, true
+}
+
+func (r *sstReader) chars(cch int, highByte bool) (string, bool) {
+    var text strings.Builder
+    for cch > 0 {
+        if r.remaining() == 0 {
+            // A continued string starts its segment with a new option byte
+            if !r.advance() {
+                return "", false
+            }
+            highByte = r.segments[r.seg][r.pos]&0x01 != 0
+            r.pos++
+        }
+
+        width := 1
+        if highByte {
+            width = 2
+        }
+        n := r.remaining() / width
+        if n > cch {
+            n = cch
+        }
+        if n == 0 {
+            return "", false
+        }
+
+        chunk := r.segments[r.seg][r.pos : r.pos+n*width]
+        if highByte {
+            text.WriteString(decodeUTF16LE(chunk))
+        } else {
+            text.WriteString(decodeCP1252(chunk))
+        }
+        r.pos += n * width
+        cch -= n
+    }
+    return text.String(), true
+}
+
+func readSST(segments [][]byte) []string {
+    r := &sstReader{segments: segments}
+
+    header, ok := r.bytes(8)
+    if !ok {
+        return nil
+    }
+    unique := int(binary.LittleEndian.Uint32(header[4:]))
+
+    // Every string takes at least its 3-byte header, which bounds how many
+    // the table can really hold whatever count it claims
+    strs := make([]string, 0, min(unique, r.left()/3))
+    for i := 0; i < unique; i++ {
+        head, ok := r.bytes(3)
+        if !ok {
+            break
+        }
+        cch := int(binary.LittleEndian.Uint16(head))
+        flags := head[2]
+
+        runs, extLen := 0, 0
+        if flags&0x08 != 0 {
+            b, ok := r.bytes(2)
+            if !ok {
+                break
+            }
+            runs = int(binary.LittleEndian.Uint16(b))
+        }
+        if flags&0x04 != 0 {
+            b, ok := r.bytes(4)
+            if !ok {
+                break
+            }
+            extLen = int(binary.LittleEndian.Uint32(b))
+        }
+
+        value, ok := r.chars(cch, flags&0x01 != 0)
+        if !ok {
+            break
+        }
+        strs = append(strs, value)
+
+        // Skip formatting runs and phonetic data
+        if _, ok := r.bytes(runs*4 + extLen); !ok && runs*4+extLen > 0 {
+            break
+        }
+    }
+
+    return strs
+}
+
+func decodeRK(rk uint32) float64 {
+    var value float64
+    if rk&0x02 != 0 {
+        value = float64(int32(rk) >> 2)
+    } else {
+        value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+    }
+    if rk&0x01 != 0 {
+        value /= 100
+    }
+    return value
+}
+
+func formatBIFFNumber(v float64) string {
+    return strings.TrimSuffix(fmt.Sprintf("%.10g", v), ".0")
+}
+
+// PowerPoint 97-2003 record types used when reading .ppt decks.
+const (
+    pptSlide             = 0x03EE
+    pptNotes             = 0x03F0
+    pptSlidePersistAtom  = 0x03F3
+    pptMainMaster        = 0x03F8
+    pptTextHeaderAtom    = 0x0F9F
+    pptTextCharsAtom     = 0x0FA0
+    pptTextBytesAtom     = 0x0FA8
+    pptHandout           = 0x0FC9
+    pptSlideListWithText = 0x0FF0
+)
+
+// maxPPTDepth bounds how deeply container records are followed. Real decks
+// nest a handful of levels; a crafted stream can nest one per 8 bytes.
+const maxPPTDepth = 32
+
+// pptWalker collects text atoms from the PowerPoint Document stream.
+type pptWalker struct {
+    outline  []*slideContent // placeholder text per slide, from SlideListWithText
+    drawings []*slideContent // other shape text per Slide container
+    notes    []*slideContent // per Notes container
+    isTitle  bool
+}
+
+// parsePPT extracts slide text and speaker notes from a PowerPoint 97-2003
+// deck. Placeholder text comes from the outline (SlideListWithText), which
+// is stored in slide order; free-standing text boxes and notes are matched to
+// slides by the order of their containers.
+func (p *ParserService) parsePPT(data []byte, progress ProgressFunc) ([]Section, error) {
+    streams, err := readCFBStreams(data, "PowerPoint Document")
+    if err != nil {
+        return nil, err
+    }
+
+    stream, ok := streams["PowerPoint Document"]
+    if !ok {
+        return nil, fmt.Errorf("PowerPoint Document stream not found in PPT")
+    }
+
+    w := &pptWalker{}
+    w.walk(stream, nil, 0, 0)
+
+    count := len(w.outline)
+    if len(w.drawings) > count {
+        count = len(w.drawings)
+    }
+    if count == 0 {
+        return nil, fmt.Errorf("no slides found in PPT")
+    }
+
+    var sections []Section
+    for i := 0; i < count; i++ {
+        progress("parsing", i+1, count, "slide")
+
+        var text strings.Builder
+        content := &slideContent{}
+        if i < len(w.outline) {
+            content.Titles = w.outline[i].Titles
+            content.Body = append(content.Body, w.outline[i].Body...)
+        }
+        if i < len(w.drawings) {
+            content.Body = append(content.Body, w.drawings[i].Body...)
+        }
+
+        text.WriteString(fmt.Sprintf("Slide %d:", i+1))
+        if len(content.Titles) > 0 {
+            text.WriteString(" ")
+            text.WriteString(strings.Join(content.Titles, " - "))
+        }
+        text.WriteString("\n")
+        for _, para := range content.Body {
+            text.WriteString(para)
+            text.WriteString("\n")
+        }
+
+        if i < len(w.notes) && len(w.notes[i].Body) > 0 {
+            text.WriteString("Notes:\n")
+            for _, para := range w.notes[i].Body {
+                text.WriteString(para)
+                text.WriteString("\n")
+            }
+        }
+        text.WriteString("\n")
+        sections = append(sections, Section{Text: text.String(), Slide: i + 1})
+    }
+
+    return sections, nil
+}
+
+// walk descends through container records. target is where text atoms in
+// the current container end up; nil means they are ignored. Containers
+// nested deeper than maxPPTDepth are skipped.
+func (w *pptWalker) walk(b []byte, target *slideContent, container uint16, depth int) {
+    if depth > maxPPTDepth {
+        return
+    }
+    for pos := 0; pos+8 <= len(b); {
+        verInstance := binary.LittleEndian.Uint16(b[pos:])
+        typ := binary.LittleEndian.Uint16(b[pos+2:])
+        size := int(binary.LittleEndian.Uint32(b[pos+4:]))
+        body := b[pos+8:]
+        if size > len(body) {
+            size = len(body)
+        }
+        body = body[:size]
+        pos += 8 + size
+
+        if verInstance&0x000F == 0x000F {
+            switch typ {
+            case pptMainMaster, pptHandout:
+                // Master and handout text is template boilerplate
+            case pptSlideListWithText:
+                // Instance 0 lists slides; others list notes and masters
+                if verInstance>>4 == 0 {
+                    w.walk(body, nil, typ, depth+1)
+                }
+            case pptSlide:
+                slide := &slideContent{}
+                w.drawings = append(w.drawings, slide)
+                w.walk(body, slide, typ, depth+1)
+            case pptNotes:
+                notes := &slideContent{}
+                w.notes = append(w.notes, notes)
+                w.walk(body, notes, typ, depth+1)
+            default:
+                w.walk(body, target, container, depth+1)
+            }
+            continue
+        }
+
+        switch typ {
+        case pptSlidePersistAtom:
+            if container == pptSlideListWithText {
+                w.outline = append(w.outline, &slideContent{})
+            }
+        case pptTextHeaderAtom:
+            // Text types 0 (title) and 6 (centered title) mark slide titles
+            w.isTitle = len(body) >= 4 && (body[0] == 0 || body[0] == 6)
+        case pptTextCharsAtom, pptTextBytesAtom:
+            var value string
+            if typ == pptTextCharsAtom {
+                value = decodeUTF16LE(body)
+            } else {
+                value = decodeCP1252(body)
+            }
+            w.addText(value, target, container)
+        }
+    }
+}
+
+func (w *pptWalker) addText(value string, target *slideContent, container uint16) {
+    if container == pptSlideListWithText && len(w.outline) > 0 {
+        target = w.outline[len(w.outline)-1]
+    }
+    if target == nil {
+        return
+    }
+
+    // Paragraphs are separated by carriage returns, line breaks by 0x0B
+    value = strings.ReplaceAll(value, "\x0b", " ")
+    for _, para := range strings.Split(value, "\r") {
+        para = strings.TrimSpace(para)
+        if para == "" {
+            continue
+        }
+        if w.isTitle && container == pptSlideListWithText {
+            target.Titles = append(target.Titles, para)
+        } else {
+            target.Body = append(target.Body, para)
+        }
+    }
+}
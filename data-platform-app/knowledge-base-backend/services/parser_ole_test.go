@@ -0,0 +1,397 @@
+package services
+
+import (
+    "bytes"
+    "encoding/binary"
+    "strings"
+    "testing"
+    "unicode/utf16"
+)
+
+const (
+    cfbFreeSect   = 0xFFFFFFFF
+    cfbEndOfChain = 0xFFFFFFFE
+    cfbFATSect    = 0xFFFFFFFD
+    cfbNoStream   = 0xFFFFFFFF
+)
+
+type cfbStream struct {
+    name string
+    data []byte
+}
+
+// buildCFB writes a version 3 compound document holding streams at the
+// root: one FAT sector, one directory sector and the streams after them.
+// Streams are padded to the mini stream cutoff so they all live in regular
+// sectors.
+func buildCFB(t *testing.T, streams ...cfbStream) []byte {
+    t.Helper()
+    if len(streams) > 3 {
+        t.Fatalf("buildCFB holds at most 3 streams")
+    }
+
+    const sectorSize = 512
+    le := binary.LittleEndian
+
+    fat := make([]uint32, sectorSize/4)
+    for i := range fat {
+        fat[i] = cfbFreeSect
+    }
+    fat[0] = cfbFATSect
+    fat[1] = cfbEndOfChain
+
+    dir := make([]byte, sectorSize)
+    for i := 0; i < 4; i++ {
+        entry := dir[i*128:]
+        le.PutUint32(entry[0x44:], cfbNoStream)
+        le.PutUint32(entry[0x48:], cfbNoStream)
+        le.PutUint32(entry[0x4C:], cfbNoStream)
+    }
+    writeEntry := func(i int, name string, typ byte, start uint32, size int) {
+        entry := dir[i*128:]
+        units := utf16.Encode([]rune(name))
+        for j, u := range units {
+            le.PutUint16(entry[j*2:], u)
+        }
+        le.PutUint16(entry[0x40:], uint16(len(units)*2+2))
+        entry[0x42] = typ
+        entry[0x43] = 1 // black
+        le.PutUint32(entry[0x74:], start)
+        le.PutUint64(entry[0x78:], uint64(size))
+    }
+    writeEntry(0, "Root Entry", 5, cfbEndOfChain, 0)
+    if len(streams) > 0 {
+        le.PutUint32(dir[0x4C:], 1)
+    }
+
+    var body bytes.Buffer
+    next := uint32(2)
+    for i, stream := range streams {
+        data := stream.data
+        if len(data) < 4096 {
+            data = append(append([]byte{}, data...), make([]byte, 4096-len(data))...)
+        }
+        sectors := (len(data) + sectorSize - 1) / sectorSize
+        if int(next)+sectors > len(fat) {
+            t.Fatalf("buildCFB streams do not fit in one FAT sector")
+        }
+        writeEntry(i+1, stream.name, 2, next, len(data))
+        if i+1 < len(streams) {
+            le.PutUint32(dir[(i+1)*128+0x48:], uint32(i+2))
+        }
+        for s := 0; s < sectors; s++ {
+            fat[int(next)+s] = next + uint32(s) + 1
+        }
+        fat[int(next)+sectors-1] = cfbEndOfChain
+        next += uint32(sectors)
+
+        body.Write(data)
+        body.Write(make([]byte, sectors*sectorSize-len(data)))
+    }
+
+    header := make([]byte, sectorSize)
+    copy(header, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+    le.PutUint16(header[0x18:], 0x003E)
+    le.PutUint16(header[0x1A:], 3)
+    le.PutUint16(header[0x1C:], 0xFFFE)
+    le.PutUint16(header[0x1E:], 9)
+    le.PutUint16(header[0x20:], 6)
+    le.PutUint32(header[0x2C:], 1)
+    le.PutUint32(header[0x30:], 1)
+    le.PutUint32(header[0x38:], 4096)
+    le.PutUint32(header[0x3C:], cfbEndOfChain)
+    le.PutUint32(header[0x44:], cfbEndOfChain)
+    for i := 0; i < 109; i++ {
+        le.PutUint32(header[0x4C+i*4:], cfbFreeSect)
+    }
+    le.PutUint32(header[0x4C:], 0)
+
+    var out bytes.Buffer
+    out.Write(header)
+    binary.Write(&out, le, fat)
+    out.Write(dir)
+    out.Write(body.Bytes())
+    return out.Bytes()
+}
+
+// wordStreams builds the WordDocument and 0Table streams of a document
+// whose text is a single CP1252 piece.
+func wordStreams(text string) (wordDoc, table []byte) {
+    le := binary.LittleEndian
+    const textOffset = 512
+
+    wordDoc = make([]byte, textOffset+len(text))
+    le.PutUint16(wordDoc, 0xA5EC)
+    copy(wordDoc[textOffset:], text)
+
+    // Empty FibRgW and FibRgLw put fcClx/lcbClx at 38 + 33*8
+    clx := []byte{0x02, 0, 0, 0, 0}
+    plc := make([]byte, 16)
+    le.PutUint32(plc[4:], uint32(len(text)))
+    le.PutUint32(plc[10:], 0x40000000|textOffset*2)
+    le.PutUint32(clx[1:], uint32(len(plc)))
+    table = append(clx, plc...)
+
+    le.PutUint32(wordDoc[302:], 0)
+    le.PutUint32(wordDoc[306:], uint32(len(table)))
+    return wordDoc, table
+}
+
+func TestParseDOC(t *testing.T) {
+    wordDoc, table := wordStreams("Heading\rBody text\x13 HYPERLINK x \x14link\x15\r")
+
+    shortWordDoc := append([]byte{}, wordDoc[:100]...)
+    badCLX := append([]byte{}, wordDoc...)
+    binary.LittleEndian.PutUint32(badCLX[306:], 1<<20)
+    encrypted := append([]byte{}, wordDoc...)
+    binary.LittleEndian.PutUint16(encrypted[0x0A:], 0x0100)
+
+    tests := []struct {
+        name    string
+        data    []byte
+        want    string
+        wantErr string
+    }{
+        {
+            name: "piece table",
+            data: buildCFB(t, cfbStream{"WordDocument", wordDoc}, cfbStream{"0Table", table}),
+            want: "Heading\nBody textlink\n",
+        },
+        {
+            name:    "not a compound document",
+            data:    []byte("plain text, not OLE"),
+            wantErr: "failed to read compound document",
+        },
+        {
+            name:    "missing WordDocument stream",
+            data:    buildCFB(t, cfbStream{"0Table", table}),
+            wantErr: "not a Word 97-2003 document",
+        },
+        {
+            name:    "missing table stream",
+            data:    buildCFB(t, cfbStream{"WordDocument", wordDoc}),
+            wantErr: "0Table stream not found",
+        },
+        {
+            name:    "encrypted",
+            data:    buildCFB(t, cfbStream{"WordDocument", encrypted}, cfbStream{"0Table", table}),
+            wantErr: "encrypted",
+        },
+        {
+            name:    "piece table out of range",
+            data:    buildCFB(t, cfbStream{"WordDocument", badCLX}, cfbStream{"0Table", table}),
+            wantErr: "piece table out of range",
+        },
+        {
+            // buildCFB pads the stream with zeros, so the CLX is empty
+            name:    "short WordDocument stream",
+            data:    buildCFB(t, cfbStream{"WordDocument", shortWordDoc}, cfbStream{"0Table", table}),
+            wantErr: "piece table not found",
+        },
+    }
+
+    p := NewParserService(nil)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            text, err := p.parseDOC(tt.data)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if text != tt.want {
+                t.Errorf("got %q, want %q", text, tt.want)
+            }
+        })
+    }
+}
+
+// pptRecord encodes one PowerPoint record; containers have version 0xF.
+func pptRecord(container bool, instance, typ uint16, body ...[]byte) []byte {
+    data := bytes.Join(body, nil)
+    verInstance := instance << 4
+    if container {
+        verInstance |= 0x000F
+    }
+    header := make([]byte, 8)
+    binary.LittleEndian.PutUint16(header, verInstance)
+    binary.LittleEndian.PutUint16(header[2:], typ)
+    binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+    return append(header, data...)
+}
+
+func pptText(title bool, text string) []byte {
+    textType := []byte{1, 0, 0, 0}
+    if title {
+        textType[0] = 0
+    }
+    return append(pptRecord(false, 0, pptTextHeaderAtom, textType), pptRecord(false, 0, pptTextBytesAtom, []byte(text))...)
+}
+
+func TestParsePPT(t *testing.T) {
+    outline := pptRecord(true, 0, pptSlideListWithText,
+        pptRecord(false, 0, pptSlidePersistAtom, make([]byte, 20)),
+        pptText(true, "Agenda"),
+        pptText(false, "First point\rSecond point"),
+        pptRecord(false, 0, pptSlidePersistAtom, make([]byte, 20)),
+        pptText(true, "Summary"),
+    )
+    slides := append(
+        pptRecord(true, 0, pptSlide, pptText(false, "Text box")),
+        pptRecord(true, 0, pptSlide)...,
+    )
+    notes := pptRecord(true, 0, pptNotes, pptText(false, "Speaker note"))
+    deck := pptRecord(true, 0, 0x03E8, outline, slides, notes)
+
+    // Containers nested far past maxPPTDepth, with text at the bottom
+    nested := pptText(false, "too deep")
+    for i := 0; i < 2000; i++ {
+        nested = pptRecord(true, 0, 0x1000, nested)
+    }
+    deep := pptRecord(true, 0, pptSlide, nested)
+
+    // A record claiming more bytes than the stream holds
+    truncated := pptRecord(true, 0, pptSlide, pptText(false, "cut off"))
+    binary.LittleEndian.PutUint32(truncated[4:], 1<<30)
+
+    tests := []struct {
+        name    string
+        stream  []byte
+        want    []string
+        exclude []string
+        wantErr string
+    }{
+        {
+            name:   "outline, text boxes and notes",
+            stream: deck,
+            want:   []string{"Slide 1: Agenda\nFirst point\nSecond point\nText box\nNotes:\nSpeaker note\n", "Slide 2: Summary\n"},
+        },
+        {
+            name:    "deeply nested containers",
+            stream:  deep,
+            want:    []string{"Slide 1:"},
+            exclude: []string{"too deep"},
+        },
+        {
+            name:   "record longer than the stream",
+            stream: truncated,
+            want:   []string{"Slide 1:\ncut off\n"},
+        },
+        {
+            name:    "no slides",
+            stream:  pptRecord(true, 0, pptMainMaster, pptText(true, "Master")),
+            wantErr: "no slides found",
+        },
+        {
+            name:    "garbage",
+            stream:  bytes.Repeat([]byte{0xFF}, 100),
+            wantErr: "no slides found",
+        },
+    }
+
+    p := NewParserService(nil)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            data := buildCFB(t, cfbStream{"PowerPoint Document", tt.stream})
+            sections, err := p.parsePPT(data, func(string, int, int, string) {})
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            text := joinSections(sections)
+            for _, want := range tt.want {
+                if !strings.Contains(text, want) {
+                    t.Errorf("missing %q in:\n%s", want, text)
+                }
+            }
+            for _, exclude := range tt.exclude {
+                if strings.Contains(text, exclude) {
+                    t.Errorf("unexpected %q in:\n%s", exclude, text)
+                }
+            }
+        })
+    }
+}
+
+func TestParseXLSMalformed(t *testing.T) {
+    tests := []struct {
+        name    string
+        data    []byte
+        wantErr string
+    }{
+        {"not a compound document", []byte{0xD0, 0xCF, 0x11, 0xE0}, "failed to read compound document"},
+        {"no workbook stream", buildCFB(t, cfbStream{"Other", []byte("x")}), "Workbook stream not found"},
+        {"Excel 95 workbook", buildCFB(t, cfbStream{"Book", []byte("x")}), "not supported"},
+    }
+
+    p := NewParserService(nil)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := p.parseXLS(tt.data, func(string, int, int, string) {})
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+            }
+        })
+    }
+}
+
+// sstString encodes one uncompressed 8-bit SST entry.
+func sstString(text string) []byte {
+    head := []byte{0, 0, 0}
+    binary.LittleEndian.PutUint16(head, uint16(len(text)))
+    return append(head, text...)
+}
+
+func TestReadSSTForgedCounts(t *testing.T) {
+    sstHeader := func(unique uint32) []byte {
+        header := make([]byte, 8)
+        binary.LittleEndian.PutUint32(header[4:], unique)
+        return header
+    }
+
+    // A string claiming far more phonetic data than the table holds
+    phonetic := []byte{1, 0, 0x04, 0xFF, 0xFF, 0xFF, 0x7F, 'z'}
+
+    tests := []struct {
+        name     string
+        segments [][]byte
+        want     []string
+    }{
+        {
+            name:     "unique count past the table",
+            segments: [][]byte{append(sstHeader(0xFFFFFFFF), sstString("one")...), sstString("two")},
+            want:     []string{"one", "two"},
+        },
+        {
+            name:     "phonetic length past the table",
+            segments: [][]byte{append(append(sstHeader(2), phonetic...), sstString("lost")...)},
+            want:     []string{"z"},
+        },
+        {
+            name:     "header only",
+            segments: [][]byte{sstHeader(0xFFFFFFFF)},
+            want:     []string{},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := readSST(tt.segments)
+            if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+                t.Errorf("got %q, want %q", got, tt.want)
+            }
+            if cap(got) > 64 {
+                t.Errorf("capacity %d not bounded by the table size", cap(got))
+            }
+        })
+    }
+}
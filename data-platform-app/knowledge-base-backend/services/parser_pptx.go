@@ -0,0 +1,283 @@
+package services
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "path"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+const drawingMLNamespace = "http://schemas.openxmlformats.org/drawingml/2006/main"
+
+var slidePathPattern = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// slideContent is the text found on one slide or notes page.
+type slideContent struct {
+    Titles []string
+    Body   []string
+    Tables [][][]string // table -> row -> cell
+}
+
+// parsePPTX extracts slide titles, body text, tables and speaker notes from a
+// PowerPoint deck, walking ppt/slides/slideN.xml in slide number order. Each
+// slide's text is prefixed with its slide number.
+func (p *ParserService) parsePPTX(data []byte, progress ProgressFunc) ([]Section, error) {
+    reader := bytes.NewReader(data)
+    zipReader, err := zip.NewReader(reader, int64(len(data)))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read PPTX as zip: %v", err)
+    }
+
+    files := make(map[string]*zip.File, len(zipReader.File))
+    type slideFile struct {
+        number int
+        name   string
+    }
+    var slides []slideFile
+
+    for _, file := range zipReader.File {
+        files[file.Name] = file
+        if m := slidePathPattern.FindStringSubmatch(file.Name); m != nil {
+            n, _ := strconv.Atoi(m[1])
+            slides = append(slides, slideFile{number: n, name: file.Name})
+        }
+    }
+
+    if len(slides) == 0 {
+        return nil, fmt.Errorf("no slides found in PPTX")
+    }
+
+    sort.Slice(slides, func(i, j int) bool { return slides[i].number < slides[j].number })
+
+    var sections []Section
+    for i, slide := range slides {
+        progress("parsing", i+1, len(slides), "slide")
+
+        xmlData, err := readZipFile(files[slide.name])
+        if err != nil {
+            continue
+        }
+        content, err := extractSlideText(xmlData)
+        if err != nil {
+            continue
+        }
+
+        var text strings.Builder
+        text.WriteString(fmt.Sprintf("Slide %d:", slide.number))
+        if len(content.Titles) > 0 {
+            text.WriteString(" ")
+            text.WriteString(strings.Join(content.Titles, " - "))
+        }
+        text.WriteString("\n")
+
+        for _, para := range content.Body {
+            text.WriteString(para)
+            text.WriteString("\n")
+        }
+        writeSlideTables(&text, content.Tables)
+
+        if notes := slideNotes(files, slide.name); len(notes) > 0 {
+            text.WriteString("Notes:\n")
+            for _, para := range notes {
+                text.WriteString(para)
+                text.WriteString("\n")
+            }
+        }
+        text.WriteString("\n")
+        sections = append(sections, Section{Text: text.String(), Slide: slide.number})
+    }
+
+    return sections, nil
+}
+
+func writeSlideTables(text *strings.Builder, tables [][][]string) {
+    for _, table := range tables {
+        text.WriteString("Table:\n")
+        for _, row := range table {
+            text.WriteString(strings.Join(row, "\t"))
+            text.WriteString("\n")
+        }
+    }
+}
+
+// slideNotes returns the speaker notes linked from a slide's relationships.
+func slideNotes(files map[string]*zip.File, slideName string) []string {
+    relsName := path.Join(path.Dir(slideName), "_rels", path.Base(slideName)+".rels")
+    relsFile, ok := files[relsName]
+    if !ok {
+        return nil
+    }
+
+    relsData, err := readZipFile(relsFile)
+    if err != nil {
+        return nil
+    }
+
+    var rels struct {
+        Relationships []struct {
+            Type   string `xml:"Type,attr"`
+            Target string `xml:"Target,attr"`
+        } `xml:"Relationship"`
+    }
+    if err := xml.Unmarshal(relsData, &rels); err != nil {
+        return nil
+    }
+
+    for _, rel := range rels.Relationships {
+        if !strings.HasSuffix(rel.Type, "/notesSlide") {
+            continue
+        }
+
+        notesFile, ok := files[path.Join(path.Dir(slideName), rel.Target)]
+        if !ok {
+            return nil
+        }
+        notesData, err := readZipFile(notesFile)
+        if err != nil {
+            return nil
+        }
+        content, err := extractSlideText(notesData)
+        if err != nil {
+            return nil
+        }
+        return content.Body
+    }
+
+    return nil
+}
+
+// extractSlideText walks slide (or notes page) XML. Text in title
+// placeholders goes to Titles, table cells to Tables and everything else to
+// Body, one entry per paragraph. Slide number, date and footer placeholders
+// are skipped.
+func extractSlideText(data []byte) (*slideContent, error) {
+    decoder := xml.NewDecoder(bytes.NewReader(data))
+    content := &slideContent{}
+
+    var (
+        shapeDepth int
+        isTitle    bool
+        skipShape  bool
+        shapeParas []string
+        para       strings.Builder
+        inText     bool
+        table      [][]string
+        row        []string
+        cell       strings.Builder
+        tableDepth int
+        inCell     bool
+    )
+
+    for {
+        token, err := decoder.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse slide XML: %v", err)
+        }
+
+        switch t := token.(type) {
+        case xml.StartElement:
+            switch {
+            case t.Name.Local == "sp" && t.Name.Space != drawingMLNamespace:
+                shapeDepth++
+                if shapeDepth == 1 {
+                    isTitle, skipShape, shapeParas = false, false, nil
+                }
+            case t.Name.Local == "ph" && shapeDepth > 0:
+                for _, attr := range t.Attr {
+                    if attr.Name.Local != "type" {
+                        continue
+                    }
+                    switch attr.Value {
+                    case "title", "ctrTitle":
+                        isTitle = true
+                    case "sldNum", "dt", "ftr", "hdr", "sldImg":
+                        skipShape = true
+                    }
+                }
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "tbl":
+                tableDepth++
+                if tableDepth == 1 {
+                    table = nil
+                }
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "tr" && tableDepth > 0:
+                row = nil
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "tc" && tableDepth > 0:
+                inCell = true
+                cell.Reset()
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "p":
+                para.Reset()
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "t":
+                inText = true
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "br":
+                para.WriteString(" ")
+            }
+
+        case xml.CharData:
+            if inText {
+                para.Write(t)
+            }
+
+        case xml.EndElement:
+            switch {
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "t":
+                inText = false
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "p":
+                line := strings.TrimSpace(para.String())
+                if line == "" {
+                    break
+                }
+                if inCell {
+                    if cell.Len() > 0 {
+                        cell.WriteString(" ")
+                    }
+                    cell.WriteString(line)
+                } else if shapeDepth > 0 {
+                    shapeParas = append(shapeParas, line)
+                } else {
+                    content.Body = append(content.Body, line)
+                }
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "tc" && tableDepth > 0:
+                inCell = false
+                row = append(row, cell.String())
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "tr" && tableDepth > 0:
+                table = append(table, row)
+            case t.Name.Space == drawingMLNamespace && t.Name.Local == "tbl":
+                tableDepth--
+                if tableDepth == 0 && len(table) > 0 {
+                    content.Tables = append(content.Tables, table)
+                }
+            case t.Name.Local == "sp" && t.Name.Space != drawingMLNamespace:
+                shapeDepth--
+                if shapeDepth > 0 || skipShape {
+                    break
+                }
+                if isTitle {
+                    content.Titles = append(content.Titles, strings.Join(shapeParas, " "))
+                } else {
+                    content.Body = append(content.Body, shapeParas...)
+                }
+            }
+        }
+    }
+
+    return content, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+    rc, err := file.Open()
+    if err != nil {
+        return nil, err
+    }
+    defer rc.Close()
+
+    return io.ReadAll(rc)
+}
@@ -0,0 +1,479 @@
+package services
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+
+    "golang.org/x/net/html"
+    "golang.org/x/net/html/atom"
+    "golang.org/x/text/encoding"
+    "golang.org/x/text/encoding/charmap"
+    "golang.org/x/text/encoding/unicode"
+    "gopkg.in/yaml.v3"
+)
+
+// decodeText converts plain-text uploads to UTF-8. A byte order mark wins;
+// otherwise valid UTF-8 is kept, NUL-interleaved text is read as BOM-less
+// UTF-16 and anything else is assumed to be Windows-1252, which is what
+// Windows tools usually write.
+func decodeText(data []byte) string {
+    switch {
+    case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+        return string(data[3:])
+    case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+        return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), data)
+    case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+        return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), data)
+    case utf8.Valid(data):
+        return string(data)
+    }
+
+    // Count NULs at even and odd offsets in a sample to spot UTF-16
+    sample := data
+    if len(sample) > 4096 {
+        sample = sample[:4096]
+    }
+    var even, odd int
+    for i, b := range sample {
+        if b == 0 {
+            if i%2 == 0 {
+                even++
+            } else {
+                odd++
+            }
+        }
+    }
+    switch {
+    case odd > len(sample)/4 && even < odd/8:
+        return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), data)
+    case even > len(sample)/4 && odd < even/8:
+        return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), data)
+    }
+
+    return decodeWith(charmap.Windows1252, data)
+}
+
+func decodeWith(enc encoding.Encoding, data []byte) string {
+    text, err := enc.NewDecoder().Bytes(data)
+    if err != nil {
+        return strings.ToValidUTF8(string(data), "�")
+    }
+    return string(text)
+}
+
+// parseLog passes log files through as text after encoding detection,
+// dropping stray NULs left by truncated writes.
+func (p *ParserService) parseLog(data []byte) string {
+    return strings.ReplaceAll(decodeText(data), "\x00", "")
+}
+
+var (
+    markdownImage    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+    markdownLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)]*)\)`)
+    markdownRefLink  = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+    markdownEmphasis = regexp.MustCompile(`(\*\*|__|~~)(.+?)(\*\*|__|~~)`)
+    markdownItalic   = regexp.MustCompile(`(^|[\s(])[*_]([^*_\s][^*_]*?)[*_]`)
+    markdownCode     = regexp.MustCompile("`([^`]+)`")
+    markdownTag      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+    markdownHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+    markdownRefDef   = regexp.MustCompile(`^\s*\[[^\]]+\]:\s+\S+`)
+)
+
+// parseMarkdown keeps the section structure of a Markdown file: headings stay
+// on their own lines with their # level, setext headings are normalized to
+// the same form, fenced code is kept verbatim and inline markup is reduced to
+// its text. Each heading starts a new section.
+func (p *ParserService) parseMarkdown(data []byte) []Section {
+    lines := strings.Split(strings.ReplaceAll(decodeText(data), "\r\n", "\n"), "\n")
+
+    var text headingSections
+    inFence := false
+    fence := ""
+
+    for i := 0; i < len(lines); i++ {
+        line := lines[i]
+        trimmed := strings.TrimSpace(line)
+
+        if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+            marker := trimmed[:3]
+            if !inFence {
+                inFence, fence = true, marker
+                continue
+            }
+            if marker == fence {
+                inFence = false
+                continue
+            }
+        }
+        if inFence {
+            text.WriteString(line)
+            text.WriteString("\n")
+            continue
+        }
+
+        if m := markdownHeading.FindStringSubmatch(trimmed); m != nil {
+            title := stripMarkdownInline(m[2])
+            text.startSection(len(m[1]), title)
+            text.WriteString(m[1] + " " + title + "\n")
+            continue
+        }
+
+        // Setext headings underline their text with === or ---
+        if i+1 < len(lines) && trimmed != "" {
+            next := strings.TrimSpace(lines[i+1])
+            if len(next) >= 3 && strings.Trim(next, "=") == "" {
+                title := stripMarkdownInline(trimmed)
+                text.startSection(1, title)
+                text.WriteString("# " + title + "\n")
+                i++
+                continue
+            }
+            if len(next) >= 3 && strings.Trim(next, "-") == "" && !strings.HasPrefix(trimmed, "-") {
+                title := stripMarkdownInline(trimmed)
+                text.startSection(2, title)
+                text.WriteString("## " + title + "\n")
+                i++
+                continue
+            }
+        }
+
+        if markdownRefDef.MatchString(line) {
+            continue
+        }
+        if len(trimmed) >= 3 && strings.Trim(trimmed, "-*_ ") == "" {
+            // Horizontal rule
+            text.WriteString("\n")
+            continue
+        }
+
+        line = strings.TrimLeft(line, " \t")
+        line = strings.TrimLeft(line, "> ")
+        if strings.HasPrefix(line, "|") {
+            // Table row: keep cells, drop the separator row
+            cells := strings.Split(strings.Trim(line, "| "), "|")
+            if strings.Trim(strings.Join(cells, ""), "-: ") == "" {
+                continue
+            }
+            for j := range cells {
+                cells[j] = stripMarkdownInline(strings.TrimSpace(cells[j]))
+            }
+            line = strings.Join(cells, "\t")
+        } else {
+            line = stripMarkdownInline(line)
+        }
+
+        text.WriteString(line)
+        text.WriteString("\n")
+    }
+
+    return text.sections()
+}
+
+func stripMarkdownInline(s string) string {
+    s = markdownImage.ReplaceAllString(s, "$1")
+    s = markdownLink.ReplaceAllString(s, "$1 ($2)")
+    s = markdownRefLink.ReplaceAllString(s, "$1")
+    s = markdownCode.ReplaceAllString(s, "$1")
+    s = markdownEmphasis.ReplaceAllString(s, "$2")
+    s = markdownItalic.ReplaceAllString(s, "$1$2")
+    s = markdownTag.ReplaceAllString(s, "")
+    return s
+}
+
+// parseHTML strips an HTML page to readable text. Headings are kept as
+// Markdown-style "#" lines so the section structure survives, block elements
+// start new lines, list items are bulleted and table cells tab-separated.
+// Scripts, styles and other non-content elements are dropped. Each heading
+// starts a new section.
+func (p *ParserService) parseHTML(data []byte) ([]Section, error) {
+    root, err := html.Parse(strings.NewReader(decodeText(data)))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse HTML: %v", err)
+    }
+
+    w := &htmlTextWriter{}
+    w.walk(root)
+    return w.sections(), nil
+}
+
+type htmlTextWriter struct {
+    text  headingSections
+    line  strings.Builder
+    inPre bool
+}
+
+func (w *htmlTextWriter) sections() []Section {
+    w.flush()
+    return w.text.sections()
+}
+
+// flush ends the current line, collapsing runs of blank lines.
+func (w *htmlTextWriter) flush() {
+    line := strings.TrimSpace(w.line.String())
+    w.line.Reset()
+    if line == "" {
+        return
+    }
+    w.text.WriteString(line)
+    w.text.WriteString("\n")
+}
+
+func (w *htmlTextWriter) walk(n *html.Node) {
+    switch n.Type {
+    case html.TextNode:
+        if w.inPre {
+            for i, part := range strings.Split(n.Data, "\n") {
+                if i > 0 {
+                    w.flush()
+                }
+                w.line.WriteString(part)
+            }
+            return
+        }
+        text := strings.Join(strings.Fields(n.Data), " ")
+        if text == "" {
+            if strings.TrimSpace(n.Data) != n.Data && w.line.Len() > 0 {
+                w.line.WriteString(" ")
+            }
+            return
+        }
+        if w.line.Len() > 0 && n.Data[0] <= ' ' {
+            w.line.WriteString(" ")
+        }
+        w.line.WriteString(text)
+        if n.Data[len(n.Data)-1] <= ' ' {
+            w.line.WriteString(" ")
+        }
+        return
+    case html.CommentNode, html.DoctypeNode:
+        return
+    case html.ElementNode:
+        switch n.DataAtom {
+        case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Iframe, atom.Object:
+            return
+        case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+            w.flush()
+            level := int(n.Data[1] - '0')
+            w.children(n)
+            title := strings.TrimSpace(w.line.String())
+            w.line.Reset()
+            if title != "" {
+                w.text.startSection(level, title)
+                w.line.WriteString(strings.Repeat("#", level) + " " + title)
+            }
+            w.flush()
+            return
+        case atom.Br:
+            w.flush()
+            return
+        case atom.Li:
+            w.flush()
+            w.line.WriteString("- ")
+            w.children(n)
+            w.flush()
+            return
+        case atom.Td, atom.Th:
+            if w.line.Len() > 0 {
+                w.line.WriteString("\t")
+            }
+            w.children(n)
+            return
+        case atom.Pre:
+            w.flush()
+            w.inPre = true
+            w.children(n)
+            w.inPre = false
+            w.flush()
+            return
+        case atom.Title:
+            w.flush()
+            w.children(n)
+            w.flush()
+            return
+        }
+
+        if isHTMLBlock(n.DataAtom) {
+            w.flush()
+            w.children(n)
+            w.flush()
+            return
+        }
+    }
+
+    w.children(n)
+}
+
+func (w *htmlTextWriter) children(n *html.Node) {
+    for c := n.FirstChild; c != nil; c = c.NextSibling {
+        w.walk(c)
+    }
+}
+
+func isHTMLBlock(a atom.Atom) bool {
+    switch a {
+    case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer,
+        atom.Main, atom.Aside, atom.Nav, atom.Ul, atom.Ol, atom.Dl, atom.Dt, atom.Dd,
+        atom.Table, atom.Tr, atom.Thead, atom.Tbody, atom.Blockquote, atom.Hr,
+        atom.Figure, atom.Figcaption, atom.Form, atom.Fieldset, atom.Details,
+        atom.Summary, atom.Caption, atom.Address:
+        return true
+    }
+    return false
+}
+
+// parseJSON flattens JSON into "path: value" lines, e.g.
+// "spec.containers[0].image: nginx". Keys keep their document order. A file
+// holding several values (JSON Lines) prefixes each with its index.
+func (p *ParserService) parseJSON(data []byte) (string, error) {
+    decoder := json.NewDecoder(strings.NewReader(decodeText(data)))
+    decoder.UseNumber()
+
+    var text strings.Builder
+    var values int
+    for {
+        prefix := ""
+        if values > 0 {
+            prefix = fmt.Sprintf("[%d]", values)
+        }
+
+        var flat []string
+        err := flattenJSON(decoder, prefix, &flat)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", fmt.Errorf("failed to parse JSON: %v", err)
+        }
+        values++
+        text.WriteString(strings.Join(flat, "\n"))
+        text.WriteString("\n")
+    }
+
+    if values == 0 {
+        return "", fmt.Errorf("failed to parse JSON: empty document")
+    }
+    return text.String(), nil
+}
+
+// flattenJSON reads one value from decoder, appending a line per scalar.
+func flattenJSON(decoder *json.Decoder, path string, out *[]string) error {
+    token, err := decoder.Token()
+    if err != nil {
+        return err
+    }
+
+    switch t := token.(type) {
+    case json.Delim:
+        switch t {
+        case '{':
+            for decoder.More() {
+                keyToken, err := decoder.Token()
+                if err != nil {
+                    return err
+                }
+                key, _ := keyToken.(string)
+                if err := flattenJSON(decoder, joinFlatPath(path, key), out); err != nil {
+                    return err
+                }
+            }
+        case '[':
+            for i := 0; decoder.More(); i++ {
+                if err := flattenJSON(decoder, fmt.Sprintf("%s[%d]", path, i), out); err != nil {
+                    return err
+                }
+            }
+        }
+        // Consume the closing delimiter
+        _, err := decoder.Token()
+        return err
+    case nil:
+        *out = append(*out, flatLine(path, "null"))
+    default:
+        *out = append(*out, flatLine(path, fmt.Sprint(t)))
+    }
+    return nil
+}
+
+// parseYAML flattens every document in a YAML stream into "path: value"
+// lines, in the same form as parseJSON. Documents after the first are
+// prefixed with their index.
+func (p *ParserService) parseYAML(data []byte) (string, error) {
+    decoder := yaml.NewDecoder(strings.NewReader(decodeText(data)))
+
+    var text strings.Builder
+    for i := 0; ; i++ {
+        var root yaml.Node
+        err := decoder.Decode(&root)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", fmt.Errorf("failed to parse YAML: %v", err)
+        }
+
+        prefix := ""
+        if i > 0 {
+            prefix = fmt.Sprintf("[%d]", i)
+        }
+
+        var flat []string
+        flattenYAML(&root, prefix, &flat)
+        text.WriteString(strings.Join(flat, "\n"))
+        text.WriteString("\n")
+    }
+
+    return text.String(), nil
+}
+
+func flattenYAML(node *yaml.Node, path string, out *[]string) {
+    switch node.Kind {
+    case yaml.DocumentNode:
+        for _, child := range node.Content {
+            flattenYAML(child, path, out)
+        }
+    case yaml.MappingNode:
+        for i := 0; i+1 < len(node.Content); i += 2 {
+            key := node.Content[i]
+            if key.Value == "<<" {
+                // Merge keys pull their fields into the current mapping
+                flattenYAML(node.Content[i+1], path, out)
+                continue
+            }
+            flattenYAML(node.Content[i+1], joinFlatPath(path, key.Value), out)
+        }
+    case yaml.SequenceNode:
+        for i, child := range node.Content {
+            flattenYAML(child, fmt.Sprintf("%s[%d]", path, i), out)
+        }
+    case yaml.AliasNode:
+        // The anchored value is already flattened where it is defined;
+        // expanding aliases would loop on cyclic anchors and let a few
+        // bytes of nested aliases expand into gigabytes of text
+        *out = append(*out, flatLine(path, "*"+node.Value))
+    case yaml.ScalarNode:
+        *out = append(*out, flatLine(path, node.Value))
+    }
+}
+
+func joinFlatPath(path, key string) string {
+    if strings.ContainsAny(key, ".[] ") {
+        key = fmt.Sprintf("%q", key)
+    }
+    if path == "" {
+        return key
+    }
+    return path + "." + key
+}
+
+func flatLine(path, value string) string {
+    value = strings.ReplaceAll(value, "\n", "\\n")
+    if path == "" {
+        return value
+    }
+    return path + ": " + value
+}
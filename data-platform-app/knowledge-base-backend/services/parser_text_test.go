@@ -0,0 +1,92 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseYAML(t *testing.T) {
+    tests := []struct {
+        name    string
+        input   string
+        want    []string
+        wantErr bool
+    }{
+        {
+            name:  "nested mapping and sequence",
+            input: "server:\n  port: 8080\n  hosts:\n    - a\n    - b\n",
+            want:  []string{"server.port: 8080", "server.hosts[0]: a", "server.hosts[1]: b"},
+        },
+        {
+            name:  "alias is not expanded",
+            input: "base: &base\n  timeout: 30\ncopy: *base\n",
+            want:  []string{"base.timeout: 30", "copy: *base"},
+        },
+        {
+            name:  "merge key keeps the anchor name",
+            input: "base: &base\n  timeout: 30\njob:\n  <<: *base\n  name: etl\n",
+            want:  []string{"base.timeout: 30", "job: *base", "job.name: etl"},
+        },
+        {
+            name:  "cyclic alias",
+            input: "a: &a\n  b: *a\n",
+            want:  []string{"a.b: *a"},
+        },
+        {
+            name:  "multiple documents",
+            input: "a: 1\n---\nb: 2\n",
+            want:  []string{"a: 1", "[1].b: 2"},
+        },
+        {
+            name:    "malformed",
+            input:   "a: [1, 2\n",
+            wantErr: true,
+        },
+    }
+
+    p := NewParserService(nil)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            text, err := p.parseYAML([]byte(tt.input))
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatalf("expected an error, got %q", text)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            for _, line := range tt.want {
+                if !strings.Contains(text, line) {
+                    t.Errorf("missing %q in:\n%s", line, text)
+                }
+            }
+        })
+    }
+}
+
+func TestParseYAMLExponentialAliases(t *testing.T) {
+    // Each level refers to the one before it nine times; expanded, the last
+    // level would be 9^8 (about 43 million) values.
+    var input strings.Builder
+    input.WriteString("l0: &l0 [x, x, x, x, x, x, x, x, x]\n")
+    for level := 1; level <= 8; level++ {
+        prev := fmt.Sprintf("*l%d", level-1)
+        fmt.Fprintf(&input, "l%d: &l%d [%s%s]\n", level, level, strings.Repeat(prev+", ", 8), prev)
+    }
+
+    start := time.Now()
+    text, err := NewParserService(nil).parseYAML([]byte(input.String()))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(text) > 10*input.Len() {
+        t.Errorf("output grew to %d bytes from %d bytes of input", len(text), input.Len())
+    }
+    if elapsed := time.Since(start); elapsed > 5*time.Second {
+        t.Errorf("parsing took %v", elapsed)
+    }
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/couchbase/gocb/v2"
+    "knowledge-base-backend/models"
+)
+
+// queryStatID keys a query's statistics by its text, ignoring case, and the
+// folder it was searched in.
+func queryStatID(query, product, subProduct, category string) string {
+    key := strings.ToLower(strings.Join([]string{product, subProduct, category, query}, "\n"))
+    sum := sha256.Sum256([]byte(key))
+    return "query::" + hex.EncodeToString(sum[:16])
+}
+
+// RecordSearchQuery counts one more search for the query, creating its
+// statistics on first use.
+func (s *CouchbaseService) RecordSearchQuery(query, product, subProduct, category string) error {
+    id := queryStatID(query, product, subProduct, category)
+    _, err := s.queryCollection.MutateIn(id, []gocb.MutateInSpec{
+        gocb.UpsertSpec("id", id, nil),
+        gocb.UpsertSpec("query", query, nil),
+        gocb.UpsertSpec("product", product, nil),
+        gocb.UpsertSpec("sub_product", subProduct, nil),
+        gocb.UpsertSpec("category", category, nil),
+        gocb.IncrementSpec("count", 1, nil),
+        gocb.UpsertSpec("last_searched_at", time.Now().UTC(), nil),
+    }, &gocb.MutateInOptions{StoreSemantic: gocb.StoreSemanticsUpsert})
+    if err != nil {
+        return fmt.Errorf("failed to record search query: %v", err)
+    }
+    return nil
+}
+
+// ListPopularQueries returns the most searched queries, most frequent first.
+func (s *CouchbaseService) ListPopularQueries(limit int) ([]models.QueryStat, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT q.* FROM %s q
+        ORDER BY q.count DESC
+        LIMIT $1
+    `, s.keyspace(s.queryCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{limit},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    var stats []models.QueryStat
+    for results.Next() {
+        var stat models.QueryStat
+        if err := results.Row(&stat); err != nil {
+            continue
+        }
+        stats = append(stats, stat)
+    }
+
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return stats, nil
+}
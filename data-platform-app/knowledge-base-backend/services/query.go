@@ -0,0 +1,583 @@
+package services
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "unicode"
+
+    "github.com/blevesearch/bleve/v2/analysis/lang/en"
+)
+
+// QueryNode is a node of a parsed search query. Backends compile the tree
+// into their own query language.
+type QueryNode interface {
+    queryNode()
+}
+
+// AndNode matches documents matching every clause.
+type AndNode struct {
+    Clauses []QueryNode
+}
+
+// OrNode matches documents matching any clause.
+type OrNode struct {
+    Clauses []QueryNode
+}
+
+// NotNode matches documents not matching its clause.
+type NotNode struct {
+    Clause QueryNode
+}
+
+// TermNode matches a word or phrase. Field is empty for the full-text fields
+// (names, keywords, error messages and parsed text) or names one document
+// field. Wildcard terms contain * or ? and are never phrases. Pos is the
+// offset in runes of Text in the query it was parsed from.
+type TermNode struct {
+    Field    string
+    Text     string
+    Phrase   bool
+    Wildcard bool
+    Pos      int
+}
+
+// DateRangeNode matches documents whose Field falls in [From, To). A zero
+// bound leaves that side open.
+type DateRangeNode struct {
+    Field string
+    From  time.Time
+    To    time.Time
+}
+
+func (*AndNode) queryNode()       {}
+func (*OrNode) queryNode()        {}
+func (*NotNode) queryNode()       {}
+func (*TermNode) queryNode()      {}
+func (*DateRangeNode) queryNode() {}
+
+// queryFields maps the field qualifiers of the query language to document
+// fields. Qualifiers that are not listed are searched as plain text, since
+// pasted log lines are full of "key:value" pairs.
+var queryFields = map[string]string{
+    "product":     "product",
+    "sub_product": "sub_product",
+    "category":    "category",
+    "type":        "file_type",
+    "status":      "status",
+    "uploader":    "uploaded_by",
+    "keyword":     "keywords",
+    "error":       "error_messages",
+    "exception":   "errors.exception_class",
+    "code":        "errors.error_code",
+    "level":       "errors.log_level",
+    "component":   "errors.component",
+    "frame":       "errors.first_frame",
+}
+
+// Date qualifiers: uploaded:2025-03 matches that month and also accepts
+// >, >=, < and <=; after: is inclusive and before: exclusive.
+var queryDateFields = map[string]bool{
+    "uploaded": true,
+    "after":    true,
+    "before":   true,
+}
+
+// queryStopwords are the words removed by the English analyzer of both
+// search backends.
+var queryStopwords = parseStopwords(en.EnglishStopWords)
+
+// parseStopwords reads a word list in the snowball format, where "|" starts
+// a comment, or the Lucene one, where "#" does.
+func parseStopwords(list []byte) map[string]bool {
+    words := make(map[string]bool)
+    for _, line := range strings.Split(string(list), "\n") {
+        line, _, _ = strings.Cut(line, "|")
+        line, _, _ = strings.Cut(line, "#")
+        for _, word := range strings.Fields(line) {
+            words[word] = true
+        }
+    }
+    return words
+}
+
+// QuerySyntaxError describes an invalid search query. Position counts
+// characters from the start of the query.
+type QuerySyntaxError struct {
+    Message  string
+    Position int
+}
+
+func (e *QuerySyntaxError) Error() string {
+    return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+type queryTokenKind int
+
+const (
+    tokenEOF queryTokenKind = iota
+    tokenTerm
+    tokenLParen
+    tokenRParen
+    tokenAnd
+    tokenOr
+    tokenNot
+)
+
+type queryToken struct {
+    kind   queryTokenKind
+    pos    int
+    text   string // term value
+    field  string // qualifier as written, lowercased
+    phrase bool
+}
+
+// ParseQuery parses the search query language:
+//
+//   - words match any full-text field and "quoted phrases" match in order
+//   - terms are ANDed by default; AND, OR, NOT and parentheses combine them,
+//     and -term excludes one
+//   - product:, sub_product:, category:, type:, status:, uploader:, keyword:
+//     and error: restrict a term to one field, and exception:, code:,
+//     level:, component: and frame: to one field of the extracted errors
+//   - uploaded:, after: and before: compare the upload date
+//   - * and ? are wildcards within a word
+//
+// Parentheses and NOT nest at most maxQueryDepth levels. Syntax errors are
+// returned as *QuerySyntaxError.
+func ParseQuery(text string) (QueryNode, error) {
+    tokens, err := lexQuery([]rune(text))
+    if err != nil {
+        return nil, err
+    }
+
+    p := &queryParser{tokens: tokens}
+    node, err := p.parseOr()
+    if err != nil {
+        return nil, err
+    }
+    if tok := p.peek(); tok.kind == tokenRParen {
+        return nil, &QuerySyntaxError{Message: "unexpected ')'", Position: tok.pos}
+    }
+    if node == nil {
+        return nil, &QuerySyntaxError{Message: "query has no search terms", Position: 0}
+    }
+    return node, nil
+}
+
+func lexQuery(runes []rune) ([]queryToken, error) {
+    var tokens []queryToken
+    i := 0
+    for {
+        for i < len(runes) && unicode.IsSpace(runes[i]) {
+            i++
+        }
+        if i == len(runes) {
+            return append(tokens, queryToken{kind: tokenEOF, pos: i}), nil
+        }
+
+        start := i
+        switch r := runes[i]; {
+        case r == '(':
+            tokens = append(tokens, queryToken{kind: tokenLParen, pos: i})
+            i++
+        case r == ')':
+            tokens = append(tokens, queryToken{kind: tokenRParen, pos: i})
+            i++
+        case r == '"':
+            phrase, next, err := lexPhrase(runes, i)
+            if err != nil {
+                return nil, err
+            }
+            tokens = append(tokens, queryToken{kind: tokenTerm, pos: start, text: phrase, phrase: true})
+            i = next
+        case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+            tokens = append(tokens, queryToken{kind: tokenNot, pos: i})
+            i++
+        default:
+            tok := queryToken{kind: tokenTerm, pos: start}
+            if field, n := lexQualifier(runes[i:]); n > 0 {
+                tok.field = field
+                i += n
+                if i < len(runes) && runes[i] == '"' {
+                    phrase, next, err := lexPhrase(runes, i)
+                    if err != nil {
+                        return nil, err
+                    }
+                    tok.text, tok.phrase = phrase, true
+                    i = next
+                    tokens = append(tokens, tok)
+                    continue
+                }
+            }
+            for i < len(runes) && !isQueryDelimiter(runes[i]) {
+                i++
+            }
+            word := string(runes[start:i])
+            if tok.field != "" {
+                tok.text = string(runes[start+len([]rune(tok.field))+1 : i])
+                if tok.text == "" {
+                    return nil, &QuerySyntaxError{Message: fmt.Sprintf("missing value after %s:", tok.field), Position: i}
+                }
+            } else {
+                switch word {
+                case "AND":
+                    tok.kind = tokenAnd
+                case "OR":
+                    tok.kind = tokenOr
+                case "NOT":
+                    tok.kind = tokenNot
+                }
+                tok.text = word
+            }
+            tokens = append(tokens, tok)
+        }
+    }
+}
+
+func isQueryDelimiter(r rune) bool {
+    return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+// lexQualifier returns the field qualifier at the start of runes, if any,
+// and how many runes it takes including the colon.
+func lexQualifier(runes []rune) (string, int) {
+    n := 0
+    for n < len(runes) && (unicode.IsLetter(runes[n]) || runes[n] == '_') {
+        n++
+    }
+    if n == 0 || n >= len(runes) || runes[n] != ':' {
+        return "", 0
+    }
+    field := strings.ToLower(string(runes[:n]))
+    if _, ok := queryFields[field]; !ok && !queryDateFields[field] {
+        return "", 0
+    }
+    return field, n + 1
+}
+
+// lexPhrase reads the quoted phrase starting at runes[start].
+func lexPhrase(runes []rune, start int) (string, int, error) {
+    for i := start + 1; i < len(runes); i++ {
+        if runes[i] == '"' {
+            return string(runes[start+1 : i]), i + 1, nil
+        }
+    }
+    return "", 0, &QuerySyntaxError{Message: "unterminated quoted phrase", Position: start}
+}
+
+// maxQueryDepth bounds how deeply parentheses and NOT may nest. The parser
+// and every backend compiler recurse once per level.
+const maxQueryDepth = 32
+
+type queryParser struct {
+    tokens []queryToken
+    pos    int
+    depth  int
+}
+
+// enter descends one nesting level for the group or NOT starting at tok.
+func (p *queryParser) enter(tok queryToken) error {
+    p.depth++
+    if p.depth > maxQueryDepth {
+        return &QuerySyntaxError{Message: fmt.Sprintf("query nests deeper than %d levels", maxQueryDepth), Position: tok.pos}
+    }
+    return nil
+}
+
+func (p *queryParser) peek() queryToken {
+    return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+    tok := p.tokens[p.pos]
+    if tok.kind != tokenEOF {
+        p.pos++
+    }
+    return tok
+}
+
+// endsClause reports whether tok cannot start a term.
+func endsClause(tok queryToken) bool {
+    return tok.kind == tokenEOF || tok.kind == tokenRParen || tok.kind == tokenAnd || tok.kind == tokenOr
+}
+
+func (p *queryParser) parseOr() (QueryNode, error) {
+    var clauses []QueryNode
+    for {
+        node, err := p.parseAnd()
+        if err != nil {
+            return nil, err
+        }
+        if node == nil && p.peek().kind == tokenOr {
+            return nil, &QuerySyntaxError{Message: "expected a search term before OR", Position: p.peek().pos}
+        }
+        if node != nil {
+            clauses = append(clauses, node)
+        }
+
+        if p.peek().kind != tokenOr {
+            break
+        }
+        or := p.next()
+        if endsClause(p.peek()) {
+            return nil, &QuerySyntaxError{Message: "expected a search term after OR", Position: or.pos}
+        }
+    }
+
+    switch len(clauses) {
+    case 0:
+        return nil, nil
+    case 1:
+        return clauses[0], nil
+    }
+    return &OrNode{Clauses: clauses}, nil
+}
+
+func (p *queryParser) parseAnd() (QueryNode, error) {
+    var clauses []QueryNode
+    for {
+        tok := p.peek()
+        if tok.kind == tokenEOF || tok.kind == tokenRParen || tok.kind == tokenOr {
+            break
+        }
+        if tok.kind == tokenAnd {
+            if len(clauses) == 0 {
+                return nil, &QuerySyntaxError{Message: "expected a search term before AND", Position: tok.pos}
+            }
+            p.next()
+            if endsClause(p.peek()) {
+                return nil, &QuerySyntaxError{Message: "expected a search term after AND", Position: tok.pos}
+            }
+            continue
+        }
+
+        node, err := p.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        if node != nil {
+            clauses = append(clauses, node)
+        }
+    }
+
+    switch len(clauses) {
+    case 0:
+        return nil, nil
+    case 1:
+        return clauses[0], nil
+    }
+    return &AndNode{Clauses: clauses}, nil
+}
+
+func (p *queryParser) parseUnary() (QueryNode, error) {
+    tok := p.peek()
+    if tok.kind != tokenNot {
+        return p.parsePrimary()
+    }
+
+    p.next()
+    if endsClause(p.peek()) {
+        return nil, &QuerySyntaxError{Message: "expected a search term after NOT", Position: tok.pos}
+    }
+    if err := p.enter(tok); err != nil {
+        return nil, err
+    }
+    node, err := p.parseUnary()
+    p.depth--
+    if err != nil || node == nil {
+        return nil, err
+    }
+    return &NotNode{Clause: node}, nil
+}
+
+func (p *queryParser) parsePrimary() (QueryNode, error) {
+    tok := p.next()
+    switch tok.kind {
+    case tokenLParen:
+        if err := p.enter(tok); err != nil {
+            return nil, err
+        }
+        node, err := p.parseOr()
+        p.depth--
+        if err != nil {
+            return nil, err
+        }
+        if p.next().kind != tokenRParen {
+            return nil, &QuerySyntaxError{Message: "missing closing parenthesis", Position: tok.pos}
+        }
+        if node == nil {
+            return nil, &QuerySyntaxError{Message: "empty parentheses", Position: tok.pos}
+        }
+        return node, nil
+    case tokenTerm:
+        return termNode(tok)
+    }
+    return nil, &QuerySyntaxError{Message: "unexpected token", Position: tok.pos}
+}
+
+// termNode builds the node for a word or phrase token.
+func termNode(tok queryToken) (QueryNode, error) {
+    valuePos := tok.pos
+    if tok.field != "" {
+        valuePos += len([]rune(tok.field)) + 1
+    }
+
+    if queryDateFields[tok.field] {
+        if tok.phrase {
+            return nil, &QuerySyntaxError{Message: fmt.Sprintf("%s: takes a date, not a phrase", tok.field), Position: valuePos}
+        }
+        return dateRangeNode(tok.field, tok.text, valuePos)
+    }
+
+    node := &TermNode{Field: queryFields[tok.field], Text: tok.text, Phrase: tok.phrase, Pos: valuePos}
+    if tok.phrase {
+        node.Pos++ // past the opening quote
+        if strings.TrimSpace(tok.text) == "" {
+            return nil, &QuerySyntaxError{Message: "empty quoted phrase", Position: valuePos}
+        }
+        return node, nil
+    }
+
+    if strings.ContainsAny(tok.text, "*?") {
+        if !strings.ContainsFunc(tok.text, func(r rune) bool { return r != '*' && r != '?' }) {
+            return nil, &QuerySyntaxError{Message: "wildcard needs at least one other character", Position: valuePos}
+        }
+        node.Wildcard = true
+    }
+    if node.Field == "file_type" {
+        node.Text = normalizeFileType(node.Text)
+    }
+    return node, nil
+}
+
+// normalizeFileType lets type:pdf match the stored extension ".pdf", and
+// type:do* match ".doc" and ".docx". A pattern starting with * already
+// covers the dot.
+func normalizeFileType(fileType string) string {
+    fileType = strings.ToLower(fileType)
+    if !strings.HasPrefix(fileType, ".") && !strings.HasPrefix(fileType, "*") {
+        fileType = "." + fileType
+    }
+    return fileType
+}
+
+// dateRangeNode parses the value of a date qualifier, e.g. >=2025-01-01.
+func dateRangeNode(field, value string, pos int) (QueryNode, error) {
+    op := ""
+    for _, candidate := range []string{">=", "<=", ">", "<"} {
+        if strings.HasPrefix(value, candidate) {
+            op = candidate
+            break
+        }
+    }
+    if op != "" && field != "uploaded" {
+        return nil, &QuerySyntaxError{Message: fmt.Sprintf("%s: does not take a comparison", field), Position: pos}
+    }
+
+    start, end, err := parseQueryDate(value[len(op):])
+    if err != nil {
+        return nil, &QuerySyntaxError{Message: err.Error(), Position: pos + len(op)}
+    }
+
+    node := &DateRangeNode{Field: "uploaded_at"}
+    switch {
+    case field == "after" || op == ">=":
+        node.From = start
+    case field == "before" || op == "<":
+        node.To = start
+    case op == ">":
+        node.From = end
+    case op == "<=":
+        node.To = end
+    default:
+        node.From, node.To = start, end
+    }
+    return node, nil
+}
+
+// parseQueryDate parses a year, month, day or RFC 3339 time and returns the
+// span it covers.
+func parseQueryDate(value string) (time.Time, time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, t.Add(time.Second), nil
+    }
+    layouts := []struct {
+        layout        string
+        years, months int
+        days          int
+    }{
+        {"2006-01-02", 0, 0, 1},
+        {"2006-01", 0, 1, 0},
+        {"2006", 1, 0, 0},
+    }
+    for _, l := range layouts {
+        if t, err := time.Parse(l.layout, value); err == nil {
+            return t, t.AddDate(l.years, l.months, l.days), nil
+        }
+    }
+    return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q, expected 2006, 2006-01, 2006-01-02 or an RFC 3339 time", value)
+}
+
+// positiveTerms returns the terms a document can match on, skipping those
+// under NOT and ignorable words.
+func positiveTerms(node QueryNode) []*TermNode {
+    switch n := node.(type) {
+    case *AndNode:
+        var terms []*TermNode
+        for _, clause := range n.Clauses {
+            terms = append(terms, positiveTerms(clause)...)
+        }
+        return terms
+    case *OrNode:
+        var terms []*TermNode
+        for _, clause := range n.Clauses {
+            terms = append(terms, positiveTerms(clause)...)
+        }
+        return terms
+    case *TermNode:
+        if !n.ignorable() {
+            return []*TermNode{n}
+        }
+    }
+    return nil
+}
+
+// ignorable reports whether a plain word would match nothing as a required
+// term: the English analyzer drops stopwords, and words without letters or
+// digits, such as a lone "-", index to nothing.
+func (n *TermNode) ignorable() bool {
+    if n.Field != "" || n.Phrase || n.Wildcard {
+        return false
+    }
+    return queryStopwords[strings.ToLower(n.Text)] ||
+        !strings.ContainsFunc(n.Text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+}
+
+// splitAndClauses separates the clauses of an AND into those that must match
+// and those that must not, and collects its plain full-text words so
+// backends can reward documents containing them as a phrase. Ignorable words
+// are not required unless nothing else is.
+func splitAndClauses(n *AndNode) (must, mustNot []QueryNode, words []string) {
+    var ignored []QueryNode
+    for _, clause := range n.Clauses {
+        switch c := clause.(type) {
+        case *NotNode:
+            mustNot = append(mustNot, c.Clause)
+            continue
+        case *TermNode:
+            if c.Field == "" && !c.Phrase && !c.Wildcard {
+                words = append(words, c.Text)
+            }
+            if c.ignorable() {
+                ignored = append(ignored, clause)
+                continue
+            }
+        }
+        must = append(must, clause)
+    }
+    if len(must) == 0 {
+        must = ignored
+    }
+    return must, mustNot, words
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// describeQuery renders a parsed query compactly, e.g.
+// AND(kerberos, file_type:.pdf, NOT("ticket expired")).
+func describeQuery(node QueryNode) string {
+    clauses := func(nodes []QueryNode) string {
+        parts := make([]string, len(nodes))
+        for i, n := range nodes {
+            parts[i] = describeQuery(n)
+        }
+        return strings.Join(parts, ", ")
+    }
+
+    switch n := node.(type) {
+    case *AndNode:
+        return "AND(" + clauses(n.Clauses) + ")"
+    case *OrNode:
+        return "OR(" + clauses(n.Clauses) + ")"
+    case *NotNode:
+        return "NOT(" + describeQuery(n.Clause) + ")"
+    case *TermNode:
+        text := n.Text
+        if n.Phrase {
+            text = fmt.Sprintf("%q", text)
+        }
+        if n.Wildcard {
+            text = "~" + text
+        }
+        if n.Field != "" {
+            return n.Field + ":" + text
+        }
+        return text
+    case *DateRangeNode:
+        return fmt.Sprintf("%s[%s,%s)", n.Field, n.From.Format("2006-01-02"), n.To.Format("2006-01-02"))
+    }
+    return fmt.Sprintf("%T", node)
+}
+
+func TestParseQuery(t *testing.T) {
+    tests := []struct {
+        query string
+        want  string
+    }{
+        {"kerberos", "kerberos"},
+        {"kerberos ticket", "AND(kerberos, ticket)"},
+        {"kerberos AND ticket", "AND(kerberos, ticket)"},
+        {"kerberos OR ldap", "OR(kerberos, ldap)"},
+        {"a b OR c", "OR(AND(a, b), c)"},
+        {"a (b OR c)", "AND(a, OR(b, c))"},
+        {"-debug kerberos", "AND(NOT(debug), kerberos)"},
+        {"NOT debug", "NOT(debug)"},
+        {`"ticket expired"`, `"ticket expired"`},
+        {`error:"connection refused"`, `error_messages:"connection refused"`},
+        {"product:CDP", "product:CDP"},
+        {"Product:cdp", "product:cdp"},
+        {"exception:java.io.IOException", "errors.exception_class:java.io.IOException"},
+        {"host:node1", "host:node1"},
+        {"krb*", "~krb*"},
+        {"type:pdf", "file_type:.pdf"},
+        {"type:.PDF", "file_type:.pdf"},
+        {"type:DO*", "file_type:~.do*"},
+        {"type:.do?", "file_type:~.do?"},
+        {"type:*x", "file_type:~*x"},
+        {"uploaded:2025-03", "uploaded_at[2025-03-01,2025-04-01)"},
+        {"after:2025-01-01", "uploaded_at[2025-01-01,0001-01-01)"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            node, err := ParseQuery(tt.query)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if got := describeQuery(node); got != tt.want {
+                t.Errorf("got %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseQueryErrors(t *testing.T) {
+    tests := []struct {
+        query    string
+        message  string
+        position int
+    }{
+        {"", "query has no search terms", 0},
+        {`"unterminated`, "unterminated quoted phrase", 0},
+        {"a OR", "expected a search term after OR", 2},
+        {"OR a", "expected a search term before OR", 0},
+        {"AND a", "expected a search term before AND", 0},
+        {"a NOT", "expected a search term after NOT", 2},
+        {"(a", "missing closing parenthesis", 0},
+        {"a)", "unexpected ')'", 1},
+        {"()", "empty parentheses", 0},
+        {"product:", "missing value after product:", 8},
+        {"**", "wildcard needs at least one other character", 0},
+        {`uploaded:"2025"`, "uploaded: takes a date, not a phrase", 9},
+        {strings.Repeat("-", 33) + "x", "query nests deeper than 32 levels", 32},
+        {strings.Repeat("NOT ", 33) + "x", "query nests deeper than 32 levels", 128},
+        {strings.Repeat("(", 33) + "x" + strings.Repeat(")", 33), "query nests deeper than 32 levels", 32},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            _, err := ParseQuery(tt.query)
+            var syntaxErr *QuerySyntaxError
+            if !errors.As(err, &syntaxErr) {
+                t.Fatalf("expected a syntax error, got %v", err)
+            }
+            if syntaxErr.Message != tt.message || syntaxErr.Position != tt.position {
+                t.Errorf("got %q at %d, want %q at %d", syntaxErr.Message, syntaxErr.Position, tt.message, tt.position)
+            }
+        })
+    }
+}
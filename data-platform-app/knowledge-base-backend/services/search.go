@@ -0,0 +1,91 @@
+package services
+
+import (
+    "fmt"
+    "time"
+
+    "knowledge-base-backend/models"
+)
+
+// SearchBackend ranks documents for a query. Backends that keep their own
+// index are kept in sync through Index and Remove, and Rebuild reindexes
+// every document from Couchbase; backends without one ignore all three.
+type SearchBackend interface {
+    Name() string
+    Search(query QueryNode, filter SearchFilter, page Page) (*SearchResults, error)
+    Index(doc *models.Document) error
+    Remove(documentID string) error
+    Rebuild() (int, error)
+    Close() error
+}
+
+// SearchFilter restricts a search. Terms maps facet fields to the values
+// accepted for them; the upload time and size bounds are inclusive and unset
+// ones leave their range open.
+type SearchFilter struct {
+    Terms        map[string][]string
+    UploadedFrom time.Time
+    UploadedTo   time.Time
+    MinSize      *int64
+    MaxSize      *int64
+}
+
+// SearchResults holds one page of hits, how many documents matched in total
+// and the facet counts over all of them, keyed by facet field.
+type SearchResults struct {
+    Hits   []models.SearchHit
+    Total  int
+    Facets map[string][]models.FacetCount
+}
+
+// Search backends selectable with SEARCH_BACKEND.
+const (
+    SearchBackendCouchbase = "couchbase"
+    SearchBackendBleve     = "bleve"
+)
+
+// NewSearchBackend returns the backend named by kind. The bleve backend keeps
+// its index under indexPath.
+func NewSearchBackend(kind, indexPath string, couchbase *CouchbaseService) (SearchBackend, error) {
+    switch kind {
+    case "", SearchBackendCouchbase:
+        return &couchbaseSearchBackend{couchbase: couchbase}, nil
+    case SearchBackendBleve:
+        return OpenBleveSearch(indexPath, couchbase)
+    }
+    return nil, fmt.Errorf("unknown search backend: %s", kind)
+}
+
+// searchFields are the fields every backend queries, with their boosts: file
+// names outrank keywords, which outrank error messages and exception
+// classes, which outrank the body text.
+var searchFields = []struct {
+    name  string
+    boost float64
+}{
+    {"file_name", 4},
+    {"original_name", 4},
+    {"keywords", 3},
+    {"error_messages", 2},
+    {"errors.exception_class", 2},
+    {"parsed_text", 1},
+}
+
+// couchbaseSearchBackend searches with Couchbase FTS, which indexes the
+// document collection itself, so Index and Remove have nothing to do.
+type couchbaseSearchBackend struct {
+    couchbase *CouchbaseService
+}
+
+func (b *couchbaseSearchBackend) Name() string {
+    return SearchBackendCouchbase
+}
+
+func (b *couchbaseSearchBackend) Search(query QueryNode, filter SearchFilter, page Page) (*SearchResults, error) {
+    return b.couchbase.SearchDocuments(query, filter, page)
+}
+
+func (b *couchbaseSearchBackend) Index(doc *models.Document) error { return nil }
+func (b *couchbaseSearchBackend) Remove(documentID string) error   { return nil }
+func (b *couchbaseSearchBackend) Rebuild() (int, error)            { return 0, nil }
+func (b *couchbaseSearchBackend) Close() error                     { return nil }
@@ -0,0 +1,536 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/blevesearch/bleve/v2"
+    "github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+    "github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+    "github.com/blevesearch/bleve/v2/analysis/lang/en"
+    "github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+    "github.com/blevesearch/bleve/v2/analysis/tokenizer/regexp"
+    "github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
+    "github.com/blevesearch/bleve/v2/mapping"
+    "github.com/blevesearch/bleve/v2/search"
+    "github.com/blevesearch/bleve/v2/search/query"
+    index "github.com/blevesearch/bleve_index_api"
+    "knowledge-base-backend/models"
+)
+
+const (
+    // bleveBatchSize is how many documents a rebuild writes per batch.
+    bleveBatchSize = 100
+    // bleveMappingVersion is stored in the index. Bump it whenever the
+    // mapping changes; an index with another version is recreated on open.
+    bleveMappingVersion = "4"
+)
+
+var bleveMappingVersionKey = []byte("mapping_version")
+
+// BleveSearch is an embedded on-disk search index for environments without
+// the Couchbase Search service. It ranks with BM25 and mirrors the fields
+// and boosts of the FTS index. Hits are loaded from Couchbase, so only the
+// searchable fields are kept in the index.
+type BleveSearch struct {
+    index     bleve.Index
+    couchbase *CouchbaseService
+    created   bool
+}
+
+// bleveDocument is the indexed form of a document.
+type bleveDocument struct {
+    FileName      string               `json:"file_name"`
+    OriginalName  string               `json:"original_name"`
+    Keywords      []string             `json:"keywords"`
+    ErrorMessages []string             `json:"error_messages"`
+    Errors        []models.ErrorRecord `json:"errors"`
+    ParsedText    string               `json:"parsed_text"`
+    Product       string               `json:"product"`
+    SubProduct    string               `json:"sub_product"`
+    Category      string               `json:"category"`
+    FileType      string               `json:"file_type"`
+    FileSize      int64                `json:"file_size"`
+    Status        string               `json:"status"`
+    UploadedBy    string               `json:"uploaded_by"`
+    UploadedAt    time.Time            `json:"uploaded_at"`
+}
+
+// OpenBleveSearch opens the index at path. A missing index, or one built
+// with an older mapping, is created empty; Created then reports true and the
+// caller should Rebuild it.
+func OpenBleveSearch(path string, couchbase *CouchbaseService) (*BleveSearch, error) {
+    idx, err := bleve.Open(path)
+    if err == nil {
+        version, err := idx.GetInternal(bleveMappingVersionKey)
+        if err == nil && string(version) == bleveMappingVersion {
+            return &BleveSearch{index: idx, couchbase: couchbase}, nil
+        }
+        log.Printf("Search index at %s has mapping version %q, recreating it", path, version)
+        idx.Close()
+        if err := os.RemoveAll(path); err != nil {
+            return nil, fmt.Errorf("failed to remove outdated search index: %v", err)
+        }
+    } else if !errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+        return nil, fmt.Errorf("failed to open search index: %v", err)
+    }
+
+    indexMapping, err := bleveIndexMapping()
+    if err != nil {
+        return nil, err
+    }
+    idx, err = bleve.New(path, indexMapping)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create search index: %v", err)
+    }
+    if err := idx.SetInternal(bleveMappingVersionKey, []byte(bleveMappingVersion)); err != nil {
+        idx.Close()
+        return nil, fmt.Errorf("failed to record search index version: %v", err)
+    }
+
+    return &BleveSearch{index: idx, couchbase: couchbase, created: true}, nil
+}
+
+// Created reports whether the index was created empty when it was opened.
+func (b *BleveSearch) Created() bool {
+    return b.created
+}
+
+func bleveIndexMapping() (*mapping.IndexMappingImpl, error) {
+    indexMapping := bleve.NewIndexMapping()
+    indexMapping.ScoringModel = index.BM25Scoring
+
+    // Split names on punctuation so "kafka_broker.log" matches "kafka"
+    err := indexMapping.AddCustomTokenizer("file_name", map[string]interface{}{
+        "type":   regexp.Name,
+        "regexp": `[\p{L}\p{N}]+`,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to add tokenizer: %v", err)
+    }
+    err = indexMapping.AddCustomAnalyzer("file_name", map[string]interface{}{
+        "type":          custom.Name,
+        "tokenizer":     "file_name",
+        "token_filters": []string{lowercase.Name},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to add analyzer: %v", err)
+    }
+    // sort_key indexes a whole value lowercased; it also matches error codes
+    // and log levels exactly but ignoring case
+    err = indexMapping.AddCustomAnalyzer("sort_key", map[string]interface{}{
+        "type":          custom.Name,
+        "tokenizer":     single.Name,
+        "token_filters": []string{lowercase.Name},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to add analyzer: %v", err)
+    }
+
+    textField := func(analyzer string) *mapping.FieldMapping {
+        field := bleve.NewTextFieldMapping()
+        field.Analyzer = analyzer
+        field.Store = false
+        field.IncludeInAll = false
+        return field
+    }
+    keywordField := func() *mapping.FieldMapping {
+        field := bleve.NewKeywordFieldMapping()
+        field.Analyzer = keyword.Name
+        field.Store = false
+        field.IncludeInAll = false
+        return field
+    }
+
+    doc := bleve.NewDocumentStaticMapping()
+    // file_name is also indexed whole and lowercased for sorting
+    fileNameSort := textField("sort_key")
+    fileNameSort.Name = "file_name_sort"
+    fileNameSort.DocValues = true
+    doc.AddFieldMappingsAt("file_name", textField("file_name"), fileNameSort)
+    doc.AddFieldMappingsAt("original_name", textField("file_name"))
+    doc.AddFieldMappingsAt("keywords", textField(en.AnalyzerName))
+    doc.AddFieldMappingsAt("error_messages", textField(en.AnalyzerName))
+    doc.AddFieldMappingsAt("parsed_text", textField(en.AnalyzerName))
+
+    // Class, logger and frame names split on punctuation like file names
+    errorRecord := bleve.NewDocumentStaticMapping()
+    errorRecord.AddFieldMappingsAt("exception_class", textField("file_name"))
+    errorRecord.AddFieldMappingsAt("message", textField(en.AnalyzerName))
+    errorRecord.AddFieldMappingsAt("error_code", textField("sort_key"))
+    errorRecord.AddFieldMappingsAt("log_level", textField("sort_key"))
+    errorRecord.AddFieldMappingsAt("component", textField("file_name"))
+    errorRecord.AddFieldMappingsAt("first_frame", textField("file_name"))
+    doc.AddSubDocumentMapping("errors", errorRecord)
+
+    doc.AddFieldMappingsAt("product", keywordField())
+    doc.AddFieldMappingsAt("sub_product", keywordField())
+    doc.AddFieldMappingsAt("category", keywordField())
+    doc.AddFieldMappingsAt("file_type", keywordField())
+    doc.AddFieldMappingsAt("status", keywordField())
+    doc.AddFieldMappingsAt("uploaded_by", keywordField())
+
+    fileSize := bleve.NewNumericFieldMapping()
+    fileSize.Store = false
+    fileSize.IncludeInAll = false
+    doc.AddFieldMappingsAt("file_size", fileSize)
+
+    uploadedAt := bleve.NewDateTimeFieldMapping()
+    uploadedAt.Store = false
+    uploadedAt.DocValues = true
+    uploadedAt.IncludeInAll = false
+    doc.AddFieldMappingsAt("uploaded_at", uploadedAt)
+
+    indexMapping.DefaultMapping = doc
+    return indexMapping, nil
+}
+
+func newBleveDocument(doc *models.Document) *bleveDocument {
+    return &bleveDocument{
+        FileName:      doc.FileName,
+        OriginalName:  doc.OriginalName,
+        Keywords:      doc.Keywords,
+        ErrorMessages: doc.ErrorMessages,
+        Errors:        doc.Errors,
+        ParsedText:    doc.ParsedText,
+        Product:       doc.Product,
+        SubProduct:    doc.SubProduct,
+        Category:      doc.Category,
+        FileType:      doc.FileType,
+        FileSize:      doc.FileSize,
+        Status:        doc.Status,
+        UploadedBy:    doc.UploadedBy,
+        UploadedAt:    doc.UploadedAt,
+    }
+}
+
+func (b *BleveSearch) Name() string {
+    return SearchBackendBleve
+}
+
+func (b *BleveSearch) Index(doc *models.Document) error {
+    if err := b.index.Index(doc.ID, newBleveDocument(doc)); err != nil {
+        return fmt.Errorf("failed to index document: %v", err)
+    }
+    return nil
+}
+
+func (b *BleveSearch) Remove(documentID string) error {
+    if err := b.index.Delete(documentID); err != nil {
+        return fmt.Errorf("failed to remove document from index: %v", err)
+    }
+    return nil
+}
+
+func (b *BleveSearch) Close() error {
+    return b.index.Close()
+}
+
+// bleveQuery builds the query for a parsed query and filter, matching the
+// structure of the FTS query.
+func bleveQuery(node QueryNode, filter SearchFilter) query.Query {
+    conjuncts := []query.Query{bleveCompile(node)}
+
+    for _, field := range facetFields {
+        values := filter.Terms[field]
+        if len(values) == 0 {
+            continue
+        }
+        var anyValue []query.Query
+        for _, value := range values {
+            term := bleve.NewTermQuery(value)
+            term.SetField(field)
+            anyValue = append(anyValue, term)
+        }
+        conjuncts = append(conjuncts, bleve.NewDisjunctionQuery(anyValue...))
+    }
+    if !filter.UploadedFrom.IsZero() || !filter.UploadedTo.IsZero() {
+        inclusive := true
+        uploaded := bleve.NewDateRangeInclusiveQuery(filter.UploadedFrom, filter.UploadedTo, &inclusive, &inclusive)
+        uploaded.SetField("uploaded_at")
+        conjuncts = append(conjuncts, uploaded)
+    }
+    if filter.MinSize != nil || filter.MaxSize != nil {
+        var min, max *float64
+        if filter.MinSize != nil {
+            value := float64(*filter.MinSize)
+            min = &value
+        }
+        if filter.MaxSize != nil {
+            value := float64(*filter.MaxSize)
+            max = &value
+        }
+        inclusive := true
+        size := bleve.NewNumericRangeInclusiveQuery(min, max, &inclusive, &inclusive)
+        size.SetField("file_size")
+        conjuncts = append(conjuncts, size)
+    }
+
+    return bleve.NewConjunctionQuery(conjuncts...)
+}
+
+// bleveCompile translates a parsed query node like ftsCompile.
+func bleveCompile(node QueryNode) query.Query {
+    switch n := node.(type) {
+    case *AndNode:
+        must, mustNot, words := splitAndClauses(n)
+        boolean := bleve.NewBooleanQuery()
+        if len(must) == 0 {
+            boolean.AddMust(bleve.NewMatchAllQuery())
+        }
+        for _, clause := range must {
+            boolean.AddMust(bleveCompile(clause))
+        }
+        for _, clause := range mustNot {
+            boolean.AddMustNot(bleveCompile(clause))
+        }
+        if len(words) > 1 {
+            // Reward passages containing the words as a phrase
+            phrase := bleve.NewMatchPhraseQuery(strings.Join(words, " "))
+            phrase.SetField("parsed_text")
+            phrase.SetBoost(2)
+            boolean.AddShould(phrase)
+        }
+        return boolean
+    case *OrNode:
+        var clauses []query.Query
+        for _, clause := range n.Clauses {
+            clauses = append(clauses, bleveCompile(clause))
+        }
+        return bleve.NewDisjunctionQuery(clauses...)
+    case *NotNode:
+        boolean := bleve.NewBooleanQuery()
+        boolean.AddMust(bleve.NewMatchAllQuery())
+        boolean.AddMustNot(bleveCompile(n.Clause))
+        return boolean
+    case *DateRangeNode:
+        inclusive, exclusive := true, false
+        dates := bleve.NewDateRangeInclusiveQuery(n.From, n.To, &inclusive, &exclusive)
+        dates.SetField(n.Field)
+        return dates
+    case *TermNode:
+        if n.Field != "" {
+            return bleveTerm(n, n.Field, 1)
+        }
+        var fields []query.Query
+        for _, field := range searchFields {
+            fields = append(fields, bleveTerm(n, field.name, field.boost))
+        }
+        return bleve.NewDisjunctionQuery(fields...)
+    }
+    return bleve.NewMatchNoneQuery()
+}
+
+func bleveTerm(n *TermNode, field string, boost float64) query.Query {
+    var q interface {
+        query.FieldableQuery
+        query.BoostableQuery
+    }
+    switch {
+    case n.Wildcard && IsFacetField(field):
+        q = bleve.NewWildcardQuery(n.Text)
+    case n.Wildcard:
+        q = bleve.NewWildcardQuery(strings.ToLower(n.Text))
+    case IsFacetField(field):
+        q = bleve.NewTermQuery(n.Text)
+    case n.Phrase:
+        q = bleve.NewMatchPhraseQuery(n.Text)
+    default:
+        q = bleve.NewMatchQuery(n.Text)
+    }
+    q.SetField(field)
+    q.SetBoost(boost)
+    return q
+}
+
+// Search returns a page of the documents matching query, ranked by BM25
+// relevance unless the page asks for another order.
+func (b *BleveSearch) Search(queryNode QueryNode, filter SearchFilter, page Page) (*SearchResults, error) {
+    months := facetMonthRanges(time.Now())
+    request := bleve.NewSearchRequestOptions(bleveQuery(queryNode, filter), page.Limit, page.Offset, false)
+    request.SortBy(bleveSort(page))
+    request.IncludeLocations = true
+    for _, field := range facetFields {
+        request.AddFacet(field, bleve.NewFacetRequest(field, facetSize))
+    }
+    monthFacet := bleve.NewFacetRequest("uploaded_at", len(months))
+    for _, month := range months {
+        monthFacet.AddDateTimeRange(month.name, month.start, month.end)
+    }
+    request.AddFacet(UploadMonthFacet, monthFacet)
+
+    result, err := b.index.Search(request)
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute search: %v", err)
+    }
+
+    results := &SearchResults{
+        Hits:   make([]models.SearchHit, 0, len(result.Hits)),
+        Total:  int(result.Total),
+        Facets: map[string][]models.FacetCount{},
+    }
+    for name, facet := range result.Facets {
+        results.Facets[name] = bleveFacetCounts(name, facet, months)
+    }
+
+    // Count each selected facet as if only its own values were unrestricted
+    for _, field := range filter.selectedFields() {
+        facetRequest := bleve.NewSearchRequestOptions(bleveQuery(queryNode, filter.without(field)), 0, 0, false)
+        facetRequest.AddFacet(field, bleve.NewFacetRequest(field, facetSize))
+        facetResult, err := b.index.Search(facetRequest)
+        if err != nil {
+            return nil, fmt.Errorf("failed to execute facet search: %v", err)
+        }
+        results.Facets[field] = bleveFacetCounts(field, facetResult.Facets[field], months)
+    }
+
+    for _, hit := range result.Hits {
+        doc, err := b.couchbase.GetDocument(hit.ID)
+        if errors.Is(err, ErrDocumentNotFound) {
+            // Deleted while the index was unavailable; drop it for next time
+            log.Printf("Removing deleted document %s from the search index", hit.ID)
+            if err := b.Remove(hit.ID); err != nil {
+                log.Printf("Failed to remove %s from the search index: %v", hit.ID, err)
+            }
+            results.Total--
+            continue
+        }
+        if err != nil {
+            log.Printf("Failed to load search hit %s: %v", hit.ID, err)
+            continue
+        }
+        var matches []models.TextMatch
+        for field, terms := range hit.Locations {
+            for _, locations := range terms {
+                for _, location := range locations {
+                    index := 0
+                    if len(location.ArrayPositions) > 0 {
+                        index = int(location.ArrayPositions[0])
+                    }
+                    matches = append(matches, models.TextMatch{
+                        Field: field,
+                        Index: index,
+                        Start: int(location.Start),
+                        End:   int(location.End),
+                    })
+                }
+            }
+        }
+        results.Hits = append(results.Hits, models.SearchHit{Document: *doc, Score: hit.Score, Matches: matches})
+    }
+
+    return results, nil
+}
+
+// bleveSort orders hits like ftsSort.
+func bleveSort(page Page) []string {
+    direction := ""
+    if page.Descending {
+        direction = "-"
+    }
+
+    switch page.Sort {
+    case SortRelevance:
+        return []string{direction + "_score", "-uploaded_at", direction + "_id"}
+    case SortFileName:
+        return []string{direction + "file_name_sort", direction + "_id"}
+    }
+    return []string{direction + page.Sort, direction + "_id"}
+}
+
+func bleveFacetCounts(name string, facet *search.FacetResult, months []monthRange) []models.FacetCount {
+    if facet == nil {
+        return []models.FacetCount{}
+    }
+    if name == UploadMonthFacet {
+        counts := make(map[string]int)
+        for _, month := range facet.DateRanges {
+            counts[month.Name] = month.Count
+        }
+        return monthCounts(counts, months)
+    }
+
+    terms := facet.Terms.Terms()
+    counts := make([]models.FacetCount, 0, len(terms))
+    for _, term := range terms {
+        if term.Term != "" {
+            counts = append(counts, models.FacetCount{Value: term.Term, Count: term.Count})
+        }
+    }
+    return counts
+}
+
+// Rebuild indexes every document in Couchbase and drops index entries for
+// documents that no longer exist. It works on the live index, so searches
+// keep being served while it runs.
+func (b *BleveSearch) Rebuild() (int, error) {
+    seen := make(map[string]bool)
+    batch := b.index.NewBatch()
+
+    err := b.couchbase.ForEachDocument(func(doc *models.Document) error {
+        seen[doc.ID] = true
+        if err := batch.Index(doc.ID, newBleveDocument(doc)); err != nil {
+            return fmt.Errorf("failed to index %s: %v", doc.ID, err)
+        }
+        if batch.Size() >= bleveBatchSize {
+            if err := b.index.Batch(batch); err != nil {
+                return fmt.Errorf("failed to write batch: %v", err)
+            }
+            batch.Reset()
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, err
+    }
+    if batch.Size() > 0 {
+        if err := b.index.Batch(batch); err != nil {
+            return 0, fmt.Errorf("failed to write batch: %v", err)
+        }
+    }
+
+    stale, err := b.staleIDs(seen)
+    if err != nil {
+        return 0, err
+    }
+    for _, id := range stale {
+        if err := b.index.Delete(id); err != nil {
+            return 0, fmt.Errorf("failed to remove %s: %v", id, err)
+        }
+    }
+
+    return len(seen), nil
+}
+
+// staleIDs pages through every indexed ID and returns those not in keep.
+func (b *BleveSearch) staleIDs(keep map[string]bool) ([]string, error) {
+    var stale []string
+    var after []string
+
+    for {
+        request := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 1000, 0, false)
+        request.SortBy([]string{"_id"})
+        if after != nil {
+            request.SetSearchAfter(after)
+        }
+
+        result, err := b.index.Search(request)
+        if err != nil {
+            return nil, fmt.Errorf("failed to list indexed documents: %v", err)
+        }
+        if len(result.Hits) == 0 {
+            return stale, nil
+        }
+
+        for _, hit := range result.Hits {
+            if !keep[hit.ID] {
+                stale = append(stale, hit.ID)
+            }
+        }
+        after = []string{result.Hits[len(result.Hits)-1].ID}
+    }
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+    "math"
+    "slices"
+    "strings"
+    "unicode"
+)
+
+const (
+    // minCorrectedWordLength leaves short words alone; too many other words
+    // are a letter away from them.
+    minCorrectedWordLength = 3
+    // maxVocabularyWordLength skips hashes, encoded blobs and the like.
+    maxVocabularyWordLength = 40
+)
+
+// wordCount is how often a word occurs in one document.
+type wordCount struct {
+    word  string
+    count int
+}
+
+// vocabularyWords splits text into the lower-cased words spelling is
+// corrected against: runs of letters and digits that contain a letter and
+// are not stopwords.
+func vocabularyWords(text string) []string {
+    var words []string
+    for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    }) {
+        length := len([]rune(word))
+        if length < minCorrectedWordLength || length > maxVocabularyWordLength || queryStopwords[word] {
+            continue
+        }
+        if strings.ContainsFunc(word, unicode.IsLetter) {
+            words = append(words, word)
+        }
+    }
+    return words
+}
+
+// documentWords counts the words of a document's name, keywords and parsed
+// text.
+func documentWords(texts ...string) []wordCount {
+    counts := make(map[string]int)
+    for _, text := range texts {
+        for _, word := range vocabularyWords(text) {
+            counts[word]++
+        }
+    }
+    words := make([]wordCount, 0, len(counts))
+    for word, count := range counts {
+        words = append(words, wordCount{word: word, count: count})
+    }
+    return words
+}
+
+// addWordsLocked adjusts the vocabulary, which is grouped by word length so
+// corrections only compare words of about the right size.
+func (s *Suggester) addWordsLocked(words []wordCount, sign int) {
+    for _, w := range words {
+        length := len([]rune(w.word))
+        bucket := s.words[length]
+        if bucket == nil {
+            bucket = make(map[string]int)
+            s.words[length] = bucket
+        }
+        bucket[w.word] += sign * w.count
+        if bucket[w.word] <= 0 {
+            delete(bucket, w.word)
+        }
+    }
+}
+
+// Correct suggests a respelling of query in which each word not found in any
+// document is replaced by the likeliest known word within a small edit
+// distance, weighing closeness against how often the word occurs. Only the
+// words of plain terms are respelled; qualifiers, fielded and wildcard terms
+// and operators are kept as typed. It reports false when no word needed or
+// could be given a correction.
+func (s *Suggester) Correct(query string, node QueryNode) (string, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    runes := []rune(query)
+    corrections := make(map[string]string)
+    var terms []*TermNode
+    for _, term := range positiveTerms(node) {
+        if term.Field != "" || term.Wildcard || !termFromQuery(term, runes) {
+            continue
+        }
+        terms = append(terms, term)
+        for _, word := range vocabularyWords(term.Text) {
+            if _, done := corrections[word]; done || s.words[len([]rune(word))][word] > 0 {
+                continue
+            }
+            if correction := s.correctWordLocked(word); correction != "" {
+                corrections[word] = correction
+            }
+        }
+    }
+    if len(corrections) == 0 {
+        return "", false
+    }
+
+    // Respell the words in the spans of those terms
+    slices.SortFunc(terms, func(a, b *TermNode) int { return a.Pos - b.Pos })
+    var corrected strings.Builder
+    last := 0
+    for _, term := range terms {
+        text := []rune(term.Text)
+        for i := 0; i < len(text); {
+            if !isWordRune(text[i]) {
+                i++
+                continue
+            }
+            end := i
+            for end < len(text) && isWordRune(text[end]) {
+                end++
+            }
+            if correction, ok := corrections[strings.ToLower(string(text[i:end]))]; ok {
+                corrected.WriteString(string(runes[last : term.Pos+i]))
+                corrected.WriteString(correction)
+                last = term.Pos + end
+            }
+            i = end
+        }
+    }
+    corrected.WriteString(string(runes[last:]))
+    return corrected.String(), true
+}
+
+// termFromQuery reports whether term was parsed from query rather than
+// added to it, e.g. as a synonym.
+func termFromQuery(term *TermNode, query []rune) bool {
+    end := term.Pos + len([]rune(term.Text))
+    return term.Pos >= 0 && end <= len(query) && string(query[term.Pos:end]) == term.Text
+}
+
+func isWordRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// correctWordLocked returns the known word that best replaces word, or "".
+// Each extra edit must be paid for by a tenfold higher frequency.
+func (s *Suggester) correctWordLocked(word string) string {
+    runes := []rune(word)
+    maxDistance := 1
+    if len(runes) >= 5 {
+        maxDistance = 2
+    }
+
+    best, bestScore := "", 0.0
+    for length := len(runes) - maxDistance; length <= len(runes)+maxDistance; length++ {
+        for candidate, count := range s.words[length] {
+            distance := editDistance(runes, []rune(candidate), maxDistance)
+            if distance > maxDistance {
+                continue
+            }
+            score := float64(count) / math.Pow(10, float64(distance))
+            if score > bestScore || (score == bestScore && candidate < best) {
+                best, bestScore = candidate, score
+            }
+        }
+    }
+    return best
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of adjacent characters. It
+// gives up with max+1 once the distance must exceed max.
+func editDistance(a, b []rune, max int) int {
+    if abs(len(a)-len(b)) > max {
+        return max + 1
+    }
+
+    // Three rows suffice: the swap looks two rows back
+    previous2 := make([]int, len(b)+1)
+    previous := make([]int, len(b)+1)
+    current := make([]int, len(b)+1)
+    for j := range previous {
+        previous[j] = j
+    }
+    for i := 1; i <= len(a); i++ {
+        current[0] = i
+        rowMin := current[0]
+        for j := 1; j <= len(b); j++ {
+            cost := 1
+            if a[i-1] == b[j-1] {
+                cost = 0
+            }
+            current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+            if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+                current[j] = min(current[j], previous2[j-2]+1)
+            }
+            rowMin = min(rowMin, current[j])
+        }
+        if rowMin > max {
+            return max + 1
+        }
+        previous2, previous, current = previous, current, previous2
+    }
+    return previous[len(b)]
+}
+
+func abs(n int) int {
+    if n < 0 {
+        return -n
+    }
+    return n
+}
@@ -0,0 +1,72 @@
+package services
+
+import "testing"
+
+func TestEditDistance(t *testing.T) {
+    tests := []struct {
+        a, b string
+        max  int
+        want int
+    }{
+        {"kerberos", "kerberos", 2, 0},
+        {"kerberso", "kerberos", 2, 1},
+        {"ab", "ba", 2, 1},
+        {"hadop", "hadoop", 2, 1},
+        {"kitten", "sitting", 3, 3},
+        {"ca", "abc", 3, 3},
+        {"zookeper", "zookeeper", 1, 1},
+        {"abc", "", 2, 3},
+        {"abcdef", "uvwxyz", 2, 3},
+        {"héllo", "hello", 1, 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+            if got := editDistance([]rune(tt.a), []rune(tt.b), tt.max); got != tt.want {
+                t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.max, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestSuggesterCorrect(t *testing.T) {
+    s := NewSuggester(nil)
+    s.addWordsLocked(documentWords(
+        "Kerberos ticket renewal failed for the HDFS NameNode",
+        "kerberos authentication kerberos keytab",
+        "Impala query failed with authentication error",
+    ), 1)
+
+    tests := []struct {
+        query string
+        want  string
+        ok    bool
+    }{
+        {"kerberos ticket", "", false},
+        {"kerberso", "kerberos", true},
+        {"Kerberso AND tikcet", "kerberos AND ticket", true},
+        {`"kerberso ticket" renewal`, `"kerberos ticket" renewal`, true},
+        {"(kerberso OR impla) -debug", "(kerberos OR impala) -debug", true},
+        // Fielded and wildcard terms keep the misspelling, even when the same
+        // word is corrected elsewhere
+        {"category:kerberso kerberso", "category:kerberso kerberos", true},
+        {"error:authentcation authentcation", "error:authentcation authentication", true},
+        {"kerber* tikcet", "kerber* ticket", true},
+        // Excluded words are not respelled
+        {"-kerberso", "", false},
+        {"xyzzyplugh", "", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.query, func(t *testing.T) {
+            node, err := ParseQuery(tt.query)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            got, ok := s.Correct(tt.query, node)
+            if got != tt.want || ok != tt.ok {
+                t.Errorf("Correct(%q) = %q, %v, want %q, %v", tt.query, got, ok, tt.want, tt.ok)
+            }
+        })
+    }
+}
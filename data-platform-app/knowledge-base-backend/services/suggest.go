@@ -0,0 +1,333 @@
+package services
+
+import (
+    "sort"
+    "strings"
+    "sync"
+    "unicode"
+
+    "knowledge-base-backend/models"
+)
+
+// Suggestion kinds.
+const (
+    SuggestFileName     = "file_name"
+    SuggestKeyword      = "keyword"
+    SuggestErrorMessage = "error_message"
+    SuggestQuery        = "query"
+)
+
+const (
+    // maxSuggestionLength leaves out longer texts, which make poor completions.
+    maxSuggestionLength = 200
+    // maxSuggestionWords is how many word starts of a text a prefix may match.
+    maxSuggestionWords = 8
+    // popularQueryLimit caps the past queries loaded at startup.
+    popularQueryLimit = 10000
+)
+
+// Suggester completes search queries from file names, keywords, error
+// messages and past queries, and corrects their spelling against the words
+// of every document. Everything is held in memory behind a sorted prefix
+// table so it can be asked on every keystroke; counts are kept per folder so
+// suggestions can be limited to the caller's path.
+type Suggester struct {
+    couchbase *CouchbaseService
+
+    mu        sync.RWMutex
+    entries   map[string]*suggestEntry
+    documents map[string]documentSuggestions
+    prefixes  []suggestPrefix // rebuilt on the first lookup after a change
+    dirty     bool
+    words     map[int]map[string]int // word length to word counts
+}
+
+type suggestEntry struct {
+    text   string
+    kind   string
+    counts map[string]int // folder path to documents or searches
+}
+
+// documentSuggestions is what one document added, so it can be taken back
+// when the document is reindexed or deleted.
+type documentSuggestions struct {
+    path  string
+    keys  []string
+    words []wordCount
+}
+
+type suggestPrefix struct {
+    key   string // lower-cased text from one of its word starts
+    entry *suggestEntry
+}
+
+func NewSuggester(couchbase *CouchbaseService) *Suggester {
+    return &Suggester{
+        couchbase: couchbase,
+        entries:   make(map[string]*suggestEntry),
+        documents: make(map[string]documentSuggestions),
+        words:     make(map[int]map[string]int),
+    }
+}
+
+// Load fills the suggester from every document and the most popular past
+// queries, returning how many documents it read.
+func (s *Suggester) Load() (int, error) {
+    count := 0
+    err := s.couchbase.ForEachDocument(func(doc *models.Document) error {
+        s.Add(doc)
+        count++
+        return nil
+    })
+    if err != nil {
+        return count, err
+    }
+
+    stats, err := s.couchbase.ListPopularQueries(popularQueryLimit)
+    if err != nil {
+        return count, err
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, stat := range stats {
+        s.addLocked(SuggestQuery, stat.Query, folderPath(stat.Product, stat.SubProduct, stat.Category), stat.Count)
+    }
+    return count, nil
+}
+
+// Add offers the document's name, keywords and error messages as
+// suggestions and its words as spelling corrections, replacing whatever it
+// offered before.
+func (s *Suggester) Add(doc *models.Document) {
+    name := doc.OriginalName
+    if name == "" {
+        name = doc.FileName
+    }
+    path := folderPath(doc.Product, doc.SubProduct, doc.Category)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.removeLocked(doc.ID)
+
+    added := documentSuggestions{
+        path:  path,
+        words: documentWords(name, strings.Join(doc.Keywords, " "), doc.ParsedText),
+    }
+    s.addWordsLocked(added.words, 1)
+    seen := make(map[string]bool)
+    add := func(kind, text string) {
+        key := suggestKey(kind, text)
+        if key == "" || seen[key] {
+            return
+        }
+        seen[key] = true
+        s.addLocked(kind, text, path, 1)
+        added.keys = append(added.keys, key)
+    }
+    add(SuggestFileName, name)
+    for _, keyword := range doc.Keywords {
+        add(SuggestKeyword, keyword)
+    }
+    for _, message := range doc.ErrorMessages {
+        add(SuggestErrorMessage, message)
+    }
+    s.documents[doc.ID] = added
+}
+
+// Remove takes back what a deleted document offered.
+func (s *Suggester) Remove(documentID string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.removeLocked(documentID)
+}
+
+func (s *Suggester) removeLocked(documentID string) {
+    previous, ok := s.documents[documentID]
+    if !ok {
+        return
+    }
+    for _, key := range previous.keys {
+        if entry := s.entries[key]; entry != nil {
+            s.addLocked(entry.kind, entry.text, previous.path, -1)
+        }
+    }
+    s.addWordsLocked(previous.words, -1)
+    delete(s.documents, documentID)
+}
+
+// RecordQuery counts a search that found documents, within the folder its
+// filter selects, so that it is suggested to later searches.
+func (s *Suggester) RecordQuery(query string, filter SearchFilter) error {
+    query = strings.Join(strings.Fields(query), " ")
+    if query == "" || len(query) > maxSuggestionLength {
+        return nil
+    }
+
+    // Only a single selected value narrows the search to one folder
+    var folder [3]string
+    for i, field := range []string{"product", "sub_product", "category"} {
+        if values := filter.Terms[field]; len(values) == 1 {
+            folder[i] = values[0]
+        } else {
+            break
+        }
+    }
+
+    s.mu.Lock()
+    s.addLocked(SuggestQuery, query, folderPath(folder[0], folder[1], folder[2]), 1)
+    s.mu.Unlock()
+
+    return s.couchbase.RecordSearchQuery(query, folder[0], folder[1], folder[2])
+}
+
+// suggestKey identifies a suggestion of kind, ignoring case, or returns ""
+// for text that is not suggested.
+func suggestKey(kind, text string) string {
+    text = strings.TrimSpace(text)
+    if text == "" || len(text) > maxSuggestionLength {
+        return ""
+    }
+    return kind + "\x00" + strings.ToLower(text)
+}
+
+// addLocked adjusts the count of text in a folder by delta.
+func (s *Suggester) addLocked(kind, text, path string, delta int) {
+    key := suggestKey(kind, text)
+    if key == "" {
+        return
+    }
+
+    entry := s.entries[key]
+    if entry == nil {
+        if delta <= 0 {
+            return
+        }
+        entry = &suggestEntry{text: strings.TrimSpace(text), kind: kind, counts: make(map[string]int)}
+        s.entries[key] = entry
+        s.dirty = true
+    }
+
+    entry.counts[path] += delta
+    if entry.counts[path] <= 0 {
+        delete(entry.counts, path)
+    }
+    if len(entry.counts) == 0 {
+        delete(s.entries, key)
+        s.dirty = true
+    }
+}
+
+// Suggest returns up to limit completions of prefix, most frequent first. A
+// prefix matches the start of any word of a suggestion. When path is set
+// only documents in that folder count, and only queries searched in it, in
+// a folder above it or in none.
+func (s *Suggester) Suggest(prefix, path string, limit int) []models.Suggestion {
+    prefix = strings.ToLower(strings.TrimLeft(prefix, " \t"))
+    path = strings.Trim(path, "/")
+    if prefix == "" || limit <= 0 {
+        return []models.Suggestion{}
+    }
+
+    s.mu.RLock()
+    if s.dirty {
+        s.mu.RUnlock()
+        s.mu.Lock()
+        if s.dirty {
+            s.rebuildPrefixes()
+        }
+        s.mu.Unlock()
+        s.mu.RLock()
+    }
+    defer s.mu.RUnlock()
+
+    best := make(map[string]models.Suggestion)
+    start := sort.Search(len(s.prefixes), func(i int) bool { return s.prefixes[i].key >= prefix })
+    for i := start; i < len(s.prefixes) && strings.HasPrefix(s.prefixes[i].key, prefix); i++ {
+        entry := s.prefixes[i].entry
+        count := entry.count(path)
+        if count == 0 {
+            continue
+        }
+        // The same text may come from several sources; offer it once
+        text := strings.ToLower(entry.text)
+        if current, ok := best[text]; !ok || count > current.Count {
+            best[text] = models.Suggestion{Text: entry.text, Kind: entry.kind, Count: count}
+        }
+    }
+
+    suggestions := make([]models.Suggestion, 0, len(best))
+    for _, suggestion := range best {
+        suggestions = append(suggestions, suggestion)
+    }
+    sort.Slice(suggestions, func(i, j int) bool {
+        a, b := suggestions[i], suggestions[j]
+        if a.Count != b.Count {
+            return a.Count > b.Count
+        }
+        if len(a.Text) != len(b.Text) {
+            return len(a.Text) < len(b.Text)
+        }
+        return a.Text < b.Text
+    })
+    if len(suggestions) > limit {
+        suggestions = suggestions[:limit]
+    }
+    return suggestions
+}
+
+// count is how often the entry occurs in folder path.
+func (e *suggestEntry) count(path string) int {
+    total := 0
+    for entryPath, count := range e.counts {
+        if inFolder(entryPath, path) || (e.kind == SuggestQuery && inFolder(path, entryPath)) {
+            total += count
+        }
+    }
+    return total
+}
+
+func (s *Suggester) rebuildPrefixes() {
+    prefixes := make([]suggestPrefix, 0, len(s.entries))
+    for _, entry := range s.entries {
+        text := strings.ToLower(entry.text)
+        for _, start := range wordStarts(text, maxSuggestionWords) {
+            prefixes = append(prefixes, suggestPrefix{key: text[start:], entry: entry})
+        }
+    }
+    sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].key < prefixes[j].key })
+    s.prefixes = prefixes
+    s.dirty = false
+}
+
+// wordStarts returns the byte offsets of the first max words of text, where
+// a word is a run of letters or digits.
+func wordStarts(text string, max int) []int {
+    var starts []int
+    previous := ' '
+    for i, r := range text {
+        word := unicode.IsLetter(r) || unicode.IsDigit(r)
+        previousWord := unicode.IsLetter(previous) || unicode.IsDigit(previous)
+        if word && !previousWord {
+            starts = append(starts, i)
+            if len(starts) == max {
+                break
+            }
+        }
+        previous = r
+    }
+    if len(starts) == 0 || starts[0] != 0 {
+        starts = append([]int{0}, starts...)
+    }
+    return starts
+}
+
+// folderPath joins the parts of a folder in the document tree, dropping
+// unset trailing parts.
+func folderPath(product, subProduct, category string) string {
+    return strings.TrimRight(product+"/"+subProduct+"/"+category, "/")
+}
+
+// inFolder reports whether path is folder or lies below it.
+func inFolder(path, folder string) bool {
+    return folder == "" || path == folder || strings.HasPrefix(path, folder+"/")
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+
+    "github.com/couchbase/gocb/v2"
+    "knowledge-base-backend/models"
+)
+
+const (
+    // maxSynonymTermLength bounds one word or phrase of a synonym.
+    maxSynonymTermLength = 100
+    // maxSynonymTerms bounds how many terms one synonym groups.
+    maxSynonymTerms = 20
+)
+
+// ErrSynonymNotFound is returned for a synonym ID that does not exist.
+var ErrSynonymNotFound = errors.New("synonym not found")
+
+func (s *CouchbaseService) SaveSynonym(synonym *models.Synonym) error {
+    _, err := s.synonymCollection.Upsert(synonym.ID, synonym, nil)
+    if err != nil {
+        return fmt.Errorf("failed to save synonym: %v", err)
+    }
+    return nil
+}
+
+func (s *CouchbaseService) GetSynonym(id string) (*models.Synonym, error) {
+    result, err := s.synonymCollection.Get(id, nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return nil, ErrSynonymNotFound
+        }
+        return nil, fmt.Errorf("failed to get synonym: %v", err)
+    }
+
+    var synonym models.Synonym
+    if err := result.Content(&synonym); err != nil {
+        return nil, fmt.Errorf("failed to decode synonym: %v", err)
+    }
+    return &synonym, nil
+}
+
+func (s *CouchbaseService) DeleteSynonym(id string) error {
+    _, err := s.synonymCollection.Remove(id, nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return ErrSynonymNotFound
+        }
+        return fmt.Errorf("failed to delete synonym: %v", err)
+    }
+    return nil
+}
+
+// ListSynonyms returns every synonym, global ones first, then by product
+// and first term. It waits for the index to catch up, so a dictionary
+// reloaded right after an edit includes it.
+func (s *CouchbaseService) ListSynonyms() ([]models.Synonym, error) {
+    n1qlQuery := fmt.Sprintf(`
+        SELECT s.* FROM %s s
+        ORDER BY IFMISSINGORNULL(s.product, ""), s.terms[0]
+    `, s.keyspace(s.synonymCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to execute query: %v", err)
+    }
+
+    synonyms := []models.Synonym{}
+    for results.Next() {
+        var synonym models.Synonym
+        if err := results.Row(&synonym); err != nil {
+            continue
+        }
+        synonyms = append(synonyms, synonym)
+    }
+
+    if err := results.Err(); err != nil {
+        return nil, fmt.Errorf("query iteration error: %v", err)
+    }
+
+    return synonyms, nil
+}
+
+// NormalizeSynonymTerms lower-cases the terms of a synonym, collapses their
+// whitespace and drops duplicates, rejecting groups of fewer than two
+// distinct terms.
+func NormalizeSynonymTerms(terms []string) ([]string, error) {
+    var normalized []string
+    seen := make(map[string]bool)
+    for _, term := range terms {
+        term = synonymKey(term)
+        if term == "" || seen[term] {
+            continue
+        }
+        if len(term) > maxSynonymTermLength {
+            return nil, fmt.Errorf("term %q is longer than %d characters", term, maxSynonymTermLength)
+        }
+        if strings.ContainsAny(term, `"*?()`) {
+            return nil, fmt.Errorf("term %q may not contain quotes, wildcards or parentheses", term)
+        }
+        seen[term] = true
+        normalized = append(normalized, term)
+    }
+    if len(normalized) < 2 {
+        return nil, fmt.Errorf("a synonym needs at least two different terms")
+    }
+    if len(normalized) > maxSynonymTerms {
+        return nil, fmt.Errorf("a synonym may have at most %d terms", maxSynonymTerms)
+    }
+    return normalized, nil
+}
+
+func synonymKey(term string) string {
+    return strings.Join(strings.Fields(strings.ToLower(term)), " ")
+}
+
+// SynonymDictionary expands search queries with the synonyms stored in
+// Couchbase. Expansion happens on the parsed query, before a backend
+// compiles it, so each product can give a term its own meaning and edits
+// apply without rebuilding an index. Neither the FTS index definition nor
+// the Bleve mapping has a synonym source: indexed text is analyzed as
+// written, and synonyms only take effect through queries expanded here.
+type SynonymDictionary struct {
+    couchbase *CouchbaseService
+
+    mu       sync.RWMutex
+    synonyms []models.Synonym
+}
+
+func NewSynonymDictionary(couchbase *CouchbaseService) *SynonymDictionary {
+    return &SynonymDictionary{couchbase: couchbase}
+}
+
+// Load replaces the dictionary with the synonyms currently stored.
+func (d *SynonymDictionary) Load() (int, error) {
+    synonyms, err := d.couchbase.ListSynonyms()
+    if err != nil {
+        return 0, err
+    }
+
+    d.mu.Lock()
+    d.synonyms = synonyms
+    d.mu.Unlock()
+    return len(synonyms), nil
+}
+
+// Expand returns query with every full-text word or phrase that has
+// synonyms replaced by an OR of it and them. Consecutive words of an AND
+// are matched against multi-word synonyms. Synonyms of a product apply when
+// the search is filtered to it, by products or by a product: term of the
+// query; without a known product only global synonyms apply.
+func (d *SynonymDictionary) Expand(query QueryNode, products []string) QueryNode {
+    alternatives := d.alternatives(append(queryProducts(query), products...))
+    if len(alternatives) == 0 {
+        return query
+    }
+
+    maxWords := 1
+    for term := range alternatives {
+        maxWords = max(maxWords, len(strings.Fields(term)))
+    }
+    return expandSynonyms(query, alternatives, maxWords)
+}
+
+// alternatives maps each term to the other terms of the synonyms that apply.
+func (d *SynonymDictionary) alternatives(products []string) map[string][]string {
+    d.mu.RLock()
+    defer d.mu.RUnlock()
+
+    alternatives := make(map[string][]string)
+    for _, synonym := range d.synonyms {
+        if synonym.Product != "" && !containsFold(products, synonym.Product) {
+            continue
+        }
+        for _, term := range synonym.Terms {
+            for _, other := range synonym.Terms {
+                if other != term && !containsFold(alternatives[term], other) {
+                    alternatives[term] = append(alternatives[term], other)
+                }
+            }
+        }
+    }
+    return alternatives
+}
+
+// queryProducts returns the products that product: terms of query require.
+func queryProducts(query QueryNode) []string {
+    var products []string
+    for _, term := range positiveTerms(query) {
+        if term.Field == "product" && !term.Wildcard {
+            products = append(products, term.Text)
+        }
+    }
+    return products
+}
+
+func expandSynonyms(node QueryNode, alternatives map[string][]string, maxWords int) QueryNode {
+    switch n := node.(type) {
+    case *AndNode:
+        var clauses []QueryNode
+        for i := 0; i < len(n.Clauses); {
+            // Prefer the longest run of plain words that is a synonym
+            matched := 0
+            for size := min(maxWords, len(n.Clauses)-i); size > 1; size-- {
+                if words, ok := plainWords(n.Clauses[i : i+size]); ok && alternatives[words] != nil {
+                    clauses = append(clauses, synonymOr(&AndNode{Clauses: n.Clauses[i : i+size]}, alternatives[words]))
+                    matched = size
+                    break
+                }
+            }
+            if matched == 0 {
+                clauses = append(clauses, expandSynonyms(n.Clauses[i], alternatives, maxWords))
+                matched = 1
+            }
+            i += matched
+        }
+        if len(clauses) == 1 {
+            return clauses[0]
+        }
+        return &AndNode{Clauses: clauses}
+    case *OrNode:
+        clauses := make([]QueryNode, len(n.Clauses))
+        for i, clause := range n.Clauses {
+            clauses[i] = expandSynonyms(clause, alternatives, maxWords)
+        }
+        return &OrNode{Clauses: clauses}
+    case *NotNode:
+        return &NotNode{Clause: expandSynonyms(n.Clause, alternatives, maxWords)}
+    case *TermNode:
+        if n.Field != "" || n.Wildcard {
+            return n
+        }
+        if others := alternatives[synonymKey(n.Text)]; others != nil {
+            return synonymOr(n, others)
+        }
+    }
+    return node
+}
+
+// plainWords joins a run of unqualified single-word terms into a synonym key.
+func plainWords(clauses []QueryNode) (string, bool) {
+    words := make([]string, len(clauses))
+    for i, clause := range clauses {
+        term, ok := clause.(*TermNode)
+        if !ok || term.Field != "" || term.Phrase || term.Wildcard {
+            return "", false
+        }
+        words[i] = strings.ToLower(term.Text)
+    }
+    return strings.Join(words, " "), true
+}
+
+// synonymOr matches original or any of its synonyms, phrases as phrases.
+func synonymOr(original QueryNode, others []string) QueryNode {
+    clauses := []QueryNode{original}
+    for _, other := range others {
+        clauses = append(clauses, &TermNode{Text: other, Phrase: strings.Contains(other, " ")})
+    }
+    return &OrNode{Clauses: clauses}
+}
+
+func containsFold(values []string, value string) bool {
+    for _, v := range values {
+        if strings.EqualFold(v, value) {
+            return true
+        }
+    }
+    return false
+}
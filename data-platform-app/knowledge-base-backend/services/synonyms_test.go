@@ -0,0 +1,49 @@
+package services
+
+import (
+    "testing"
+
+    "knowledge-base-backend/models"
+)
+
+func TestSynonymDictionaryExpand(t *testing.T) {
+    d := &SynonymDictionary{synonyms: []models.Synonym{
+        {Terms: []string{"k8s", "kubernetes"}},
+        {Terms: []string{"name node", "namenode"}},
+        {Terms: []string{"nn", "name node"}, Product: "CDP"},
+        {Terms: []string{"nn", "neural network"}, Product: "AI"},
+    }}
+
+    tests := []struct {
+        name     string
+        query    string
+        products []string
+        want     string
+    }{
+        {"single word", "k8s pods", nil, "AND(OR(k8s, kubernetes), pods)"},
+        {"case insensitive", "Kubernetes", nil, "OR(Kubernetes, k8s)"},
+        {"phrase alternative", "namenode", nil, `OR(namenode, "name node")`},
+        {"multi-word run", "name node down", nil, "AND(OR(AND(name, node), namenode), down)"},
+        {"quoted phrase", `"name node"`, nil, `OR("name node", namenode)`},
+        {"inside OR and NOT", "k8s OR -namenode", nil, `OR(OR(k8s, kubernetes), NOT(OR(namenode, "name node")))`},
+        {"qualified term untouched", "keyword:k8s", nil, "keywords:k8s"},
+        {"wildcard untouched", "k8*", nil, "~k8*"},
+        {"product synonym needs a product", "nn", nil, "nn"},
+        {"product from the filter", "nn", []string{"cdp"}, `OR(nn, "name node")`},
+        {"product from the query", "product:AI nn", nil, `AND(product:AI, OR(nn, "neural network"))`},
+        {"excluded product is not known", "-product:AI nn", nil, "AND(NOT(product:AI), nn)"},
+        {"other product", "nn", []string{"HDP"}, "nn"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            query, err := ParseQuery(tt.query)
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if got := describeQuery(d.Expand(query, tt.products)); got != tt.want {
+                t.Errorf("got %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "path"
+    "slices"
+    "strings"
+    "time"
+
+    "github.com/couchbase/gocb/v2"
+    "knowledge-base-backend/models"
+)
+
+// VersionedPath is the GCS path of one version of a file in a folder, e.g.
+// knowledge_based/cloudera/cdp/services/install_guide@v2.pdf. Sanitized file
+// names never contain "@", so a version cannot collide with another file.
+func VersionedPath(dir, safeName string, version int) string {
+    ext := path.Ext(safeName)
+    return fmt.Sprintf("%s/%s@v%d%s", dir, strings.TrimSuffix(safeName, ext), version, ext)
+}
+
+// DocumentVersions returns the versions of a document, oldest first. A
+// document uploaded before versioning has its file as version 1.
+func DocumentVersions(doc *models.Document) []models.DocumentVersion {
+    if len(doc.Versions) > 0 {
+        return doc.Versions
+    }
+    return []models.DocumentVersion{{
+        Version:      1,
+        GCSPath:      doc.GCSPath,
+        FileSize:     doc.FileSize,
+        ContentHash:  doc.ContentHash,
+        OriginalName: doc.OriginalName,
+        UploadedBy:   doc.UploadedBy,
+        UploadedAt:   doc.UploadedAt,
+    }}
+}
+
+// CurrentVersion is the number of the version a document's file and parsed
+// text belong to.
+func CurrentVersion(doc *models.Document) int {
+    if doc.Version == 0 {
+        return 1
+    }
+    return doc.Version
+}
+
+// NextVersion is the number after a document's latest version. New versions
+// are numbered with ClaimVersion, which starts counting from it.
+func NextVersion(doc *models.Document) int {
+    versions := DocumentVersions(doc)
+    return versions[len(versions)-1].Version + 1
+}
+
+// versionCounterID is the key of the counter numbering a document's versions
+// in the version collection.
+func versionCounterID(documentID string) string {
+    return documentID + "::next_version"
+}
+
+// ClaimVersion reserves the number of a new version of doc. Numbers come
+// from a counter, so concurrent uploads of the same file never share a
+// number or the GCS path named after it.
+func (s *CouchbaseService) ClaimVersion(doc *models.Document) (int, error) {
+    result, err := s.versionCollection.Binary().Increment(versionCounterID(doc.ID), &gocb.IncrementOptions{
+        Initial: int64(NextVersion(doc)),
+        Delta:   1,
+    })
+    if err != nil {
+        return 0, fmt.Errorf("failed to claim version: %v", err)
+    }
+    return int(result.Content()), nil
+}
+
+// nameReservationTTL is how long the first upload of a file name holds it.
+// By the time it expires the upload has saved its document and
+// FindDocumentByName returns it.
+const nameReservationTTL = time.Hour
+
+// nameReservation records which document the first upload of a file name in
+// a folder creates. Removing a document's version texts removes it too.
+type nameReservation struct {
+    DocumentID string `json:"document_id"`
+}
+
+// nameReservationID is the key of a file name's reservation in the version
+// collection. The name is hashed to stay within the key length limit.
+func nameReservationID(product, subProduct, category, fileName string) string {
+    sum := sha256.Sum256([]byte(strings.Join([]string{product, subProduct, category, fileName}, "/")))
+    return "name::" + hex.EncodeToString(sum[:])
+}
+
+// ReserveDocumentName claims version 1 of a file name in a folder for a new
+// document, so that concurrent first uploads of the same name cannot both
+// create it. When another upload holds the name it returns false and the ID
+// of the document that upload creates.
+func (s *CouchbaseService) ReserveDocumentName(product, subProduct, category, fileName, documentID string) (bool, string, error) {
+    id := nameReservationID(product, subProduct, category, fileName)
+    for attempt := 1; ; attempt++ {
+        _, err := s.versionCollection.Insert(id, &nameReservation{DocumentID: documentID}, &gocb.InsertOptions{
+            Expiry: nameReservationTTL,
+        })
+        if err == nil {
+            return true, documentID, nil
+        }
+        if !errors.Is(err, gocb.ErrDocumentExists) {
+            return false, "", fmt.Errorf("failed to reserve file name: %v", err)
+        }
+
+        result, err := s.versionCollection.Get(id, nil)
+        if errors.Is(err, gocb.ErrDocumentNotFound) && attempt < maxUpdateAttempts {
+            // Released or expired since the insert
+            continue
+        }
+        if err != nil {
+            return false, "", fmt.Errorf("failed to read file name reservation: %v", err)
+        }
+        var reservation nameReservation
+        if err := result.Content(&reservation); err != nil {
+            return false, "", fmt.Errorf("failed to decode file name reservation: %v", err)
+        }
+        return false, reservation.DocumentID, nil
+    }
+}
+
+// ReleaseDocumentName gives up documentID's reservation of a file name when
+// its upload did not create the document.
+func (s *CouchbaseService) ReleaseDocumentName(product, subProduct, category, fileName, documentID string) error {
+    id := nameReservationID(product, subProduct, category, fileName)
+    result, err := s.versionCollection.Get(id, nil)
+    if errors.Is(err, gocb.ErrDocumentNotFound) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to read file name reservation: %v", err)
+    }
+
+    var reservation nameReservation
+    if err := result.Content(&reservation); err != nil {
+        return fmt.Errorf("failed to decode file name reservation: %v", err)
+    }
+    if reservation.DocumentID != documentID {
+        return nil
+    }
+
+    _, err = s.versionCollection.Remove(id, &gocb.RemoveOptions{Cas: result.Cas()})
+    if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) && !errors.Is(err, gocb.ErrCasMismatch) {
+        return fmt.Errorf("failed to release file name reservation: %v", err)
+    }
+    return nil
+}
+
+// FindVersion returns a version of a document, or nil if it has none with
+// that number.
+func FindVersion(doc *models.Document, number int) *models.DocumentVersion {
+    versions := DocumentVersions(doc)
+    for i := range versions {
+        if versions[i].Version == number {
+            return &versions[i]
+        }
+    }
+    return nil
+}
+
+// AddDocumentVersion adds version to a document's history and makes its
+// file the current one, leaving the document to be parsed again. The parsed
+// text of the previous version stays until then. A version saved after a
+// newer one, by a slower concurrent upload, only joins the history.
+func AddDocumentVersion(doc *models.Document, version models.DocumentVersion) {
+    versions := DocumentVersions(doc)
+    i := len(versions)
+    for i > 0 && versions[i-1].Version > version.Version {
+        i--
+    }
+    doc.Versions = slices.Insert(versions, i, version)
+    if i < len(versions) {
+        return
+    }
+
+    doc.Version = version.Version
+    doc.GCSPath = version.GCSPath
+    doc.FileSize = version.FileSize
+    doc.ContentHash = version.ContentHash
+    doc.OriginalName = version.OriginalName
+    doc.DuplicateOf = ""
+    doc.Status = "uploaded"
+    doc.ParseError = ""
+    doc.UpdatedAt = version.UploadedAt
+}
+
+// ErrVersionTextNotFound is returned for a version whose parsed text was
+// not stored.
+var ErrVersionTextNotFound = errors.New("version text not found")
+
+// VersionTextID is the key of a version's parsed text in the version
+// collection.
+func VersionTextID(documentID string, version int) string {
+    return fmt.Sprintf("%s::v%d", documentID, version)
+}
+
+// NewVersionText captures the parsed text of a document's current version.
+func NewVersionText(doc *models.Document) *models.VersionText {
+    text := &models.VersionText{
+        ID:            VersionTextID(doc.ID, CurrentVersion(doc)),
+        DocumentID:    doc.ID,
+        Version:       CurrentVersion(doc),
+        ParsedText:    doc.ParsedText,
+        Keywords:      doc.Keywords,
+        ErrorMessages: doc.ErrorMessages,
+        ParserVersion: doc.ParserVersion,
+    }
+    if doc.ParsedAt != nil {
+        text.ParsedAt = *doc.ParsedAt
+    }
+    return text
+}
+
+func (s *CouchbaseService) SaveVersionText(text *models.VersionText) error {
+    _, err := s.versionCollection.Upsert(text.ID, text, nil)
+    if err != nil {
+        return fmt.Errorf("failed to save version text: %v", err)
+    }
+    return nil
+}
+
+func (s *CouchbaseService) GetVersionText(documentID string, version int) (*models.VersionText, error) {
+    result, err := s.versionCollection.Get(VersionTextID(documentID, version), nil)
+    if err != nil {
+        if errors.Is(err, gocb.ErrDocumentNotFound) {
+            return nil, ErrVersionTextNotFound
+        }
+        return nil, fmt.Errorf("failed to get version text: %v", err)
+    }
+
+    var text models.VersionText
+    if err := result.Content(&text); err != nil {
+        return nil, fmt.Errorf("failed to decode version text: %v", err)
+    }
+    return &text, nil
+}
+
+// DeleteVersionTexts removes the parsed text of every version of a document,
+// the counter numbering them and any reservation of its file name.
+func (s *CouchbaseService) DeleteVersionTexts(documentID string) error {
+    _, err := s.versionCollection.Remove(versionCounterID(documentID), nil)
+    if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+        return fmt.Errorf("failed to delete version counter: %v", err)
+    }
+
+    n1qlQuery := fmt.Sprintf(`
+        DELETE FROM %s v
+        WHERE v.document_id = $1
+    `, s.keyspace(s.versionCollectionName))
+
+    results, err := s.cluster.Query(n1qlQuery, &gocb.QueryOptions{
+        PositionalParameters: []interface{}{documentID},
+    })
+    if err != nil {
+        return fmt.Errorf("failed to delete version texts: %v", err)
+    }
+    return results.Close()
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+    "slices"
+    "testing"
+
+    "knowledge-base-backend/models"
+)
+
+func TestAddDocumentVersion(t *testing.T) {
+    tests := []struct {
+        name        string
+        existing    []int
+        add         int
+        wantOrder   []int
+        wantCurrent int
+    }{
+        {"legacy document", nil, 2, []int{1, 2}, 2},
+        {"next version", []int{1, 2}, 3, []int{1, 2, 3}, 3},
+        {"saved after a newer version", []int{1, 2, 4}, 3, []int{1, 2, 3, 4}, 4},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            doc := &models.Document{GCSPath: "dir/a@v1.pdf", ContentHash: "h1"}
+            for _, number := range tt.existing {
+                doc.Versions = append(doc.Versions, models.DocumentVersion{Version: number, ContentHash: "h"})
+            }
+            if len(tt.existing) > 0 {
+                doc.Version = tt.existing[len(tt.existing)-1]
+            }
+
+            AddDocumentVersion(doc, models.DocumentVersion{Version: tt.add, ContentHash: "new"})
+
+            var order []int
+            for _, version := range doc.Versions {
+                order = append(order, version.Version)
+            }
+            if !slices.Equal(order, tt.wantOrder) {
+                t.Errorf("versions %v, want %v", order, tt.wantOrder)
+            }
+            if CurrentVersion(doc) != tt.wantCurrent {
+                t.Errorf("current version %d, want %d", CurrentVersion(doc), tt.wantCurrent)
+            }
+            if (tt.wantCurrent == tt.add) != (doc.ContentHash == "new") {
+                t.Errorf("content hash %q after adding version %d", doc.ContentHash, tt.add)
+            }
+        })
+    }
+}
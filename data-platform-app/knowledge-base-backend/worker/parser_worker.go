@@ -2,104 +2,590 @@ package worker
 
 import (
     "context"
+    "errors"
     "fmt"
     "log"
+    "math/rand"
+    "os"
+    "sync/atomic"
     "time"
 
+    "github.com/google/uuid"
     "knowledge-base-backend/models"
     "knowledge-base-backend/services"
 )
 
-type ParseJob struct {
-    Document *models.Document
+const (
+    // leaseDuration is how long a claimed job stays invisible to other
+    // workers without a heartbeat.
+    leaseDuration = 2 * time.Minute
+    // heartbeatInterval must stay well below leaseDuration.
+    heartbeatInterval = 30 * time.Second
+    // pollInterval bounds how long an idle worker waits before checking the
+    // job collection again, e.g. for jobs enqueued by another instance.
+    pollInterval = 5 * time.Second
+
+    // backlogRefreshInterval is how often the pending job count used for
+    // upload backpressure is re-read from Couchbase.
+    backlogRefreshInterval = 5 * time.Second
+    // sweepInterval is how often documents without a job are requeued, e.g.
+    // when enqueueing timed out during the upload request.
+    sweepInterval = 5 * time.Minute
+
+    // maxParseAttempts is how often a job is tried before it is dead-lettered.
+    maxParseAttempts = 5
+    // Retries back off exponentially from retryBaseDelay up to retryMaxDelay.
+    retryBaseDelay = 30 * time.Second
+    retryMaxDelay  = 30 * time.Minute
+)
+
+// permanentError marks failures that retrying cannot fix, such as a file the
+// parser does not understand. Jobs failing this way are dead-lettered at once.
+type permanentError struct {
+    err error
 }
 
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
 type ParserWorker struct {
-    jobQueue       chan ParseJob
-    gcsService     *services.GCSService
+    wake             chan struct{}
+    instanceID       string
+    backlog          atomic.Int64
+    backlogLimit     int
+    progress         *progressTracker
+    reparses         *reparseRuns
+    gcsService       *services.GCSService
     couchbaseService *services.CouchbaseService
-    parserService  *services.ParserService
+    searchBackend    services.SearchBackend
+    suggester        *services.Suggester
+    corpus           *services.KeywordCorpus
+    issues           *services.IssueRegistry
+    parserService    *services.ParserService
 }
 
 func NewParserWorker(
     channelSize int,
+    backlogLimit int,
     gcsService *services.GCSService,
     couchbaseService *services.CouchbaseService,
+    searchBackend services.SearchBackend,
+    suggester *services.Suggester,
+    corpus *services.KeywordCorpus,
+    issues *services.IssueRegistry,
 ) *ParserWorker {
+    hostname, err := os.Hostname()
+    if err != nil {
+        hostname = "worker"
+    }
+
     return &ParserWorker{
-        jobQueue:         make(chan ParseJob, channelSize),
+        wake:             make(chan struct{}, channelSize),
+        instanceID:       fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+        backlogLimit:     backlogLimit,
+        progress:         newProgressTracker(),
+        reparses:         newReparseRuns(),
         gcsService:       gcsService,
         couchbaseService: couchbaseService,
-        parserService:    services.NewParserService(),
+        searchBackend:    searchBackend,
+        suggester:        suggester,
+        corpus:           corpus,
+        issues:           issues,
+        parserService:    services.NewParserService(corpus),
     }
 }
 
 func (w *ParserWorker) Start(numWorkers int) {
+    // Pick up documents left behind by a previous run before taking new work
+    w.sweep()
+    w.refreshBacklog()
+
     log.Printf("Starting %d parser workers...", numWorkers)
-    
+
     for i := 0; i < numWorkers; i++ {
         go w.processJobs(i)
     }
+    go w.monitor()
+}
+
+// AddJob persists a parse job for doc and wakes an idle worker without
+// waiting for one. The job survives restarts; if no worker is idle it is
+// picked up on the next poll. When the job cannot be written the document
+// stays "uploaded", and the sweep that runs at startup and every
+// sweepInterval enqueues it, so callers only need to log the error.
+func (w *ParserWorker) AddJob(doc *models.Document) error {
+    return w.enqueue(doc.ID, services.PriorityUpload)
+}
+
+// AddDuplicate saves doc, a new record for content already stored as
+// original. A parsed original's text, keywords, errors and chunks are copied
+// rather than parsing the same bytes again; otherwise doc is queued for
+// parsing like any upload.
+func (w *ParserWorker) AddDuplicate(doc, original *models.Document) error {
+    if original.Status != "parsed" || original.ParserVersion != services.ParserVersion {
+        if err := w.couchbaseService.SaveDocument(doc); err != nil {
+            return err
+        }
+        return w.AddJob(doc)
+    }
+
+    chunks, err := w.couchbaseService.ListDocumentChunks(original.ID, "")
+    if err != nil {
+        return fmt.Errorf("failed to read chunks: %v", err)
+    }
+    for i := range chunks {
+        chunks[i].ID = services.ChunkID(doc.ID, chunks[i].Ordinal)
+        chunks[i].DocumentID = doc.ID
+    }
+    if err := w.couchbaseService.ReplaceDocumentChunks(doc.ID, chunks); err != nil {
+        return fmt.Errorf("failed to save chunks: %v", err)
+    }
+
+    doc.ParsedText = original.ParsedText
+    doc.Keywords = original.Keywords
+    doc.KeywordScores = original.KeywordScores
+    doc.ErrorMessages = original.ErrorMessages
+    doc.Errors = original.Errors
+    doc.KnownIssues = w.issues.Link(doc)
+    doc.ChunkCount = len(chunks)
+    doc.Status = "parsed"
+    doc.ParserVersion = original.ParserVersion
+    doc.ParsedAt = original.ParsedAt
+    if err := w.couchbaseService.SaveDocument(doc); err != nil {
+        return err
+    }
+    w.indexDocument(doc)
+    return nil
+}
+
+// VersionText returns the parsed text of a version of doc: the text stored
+// when it was parsed, the document's own for its parsed current version, or
+// else the version's file parsed now and stored for next time.
+func (w *ParserWorker) VersionText(ctx context.Context, doc *models.Document, number int) (*models.VersionText, error) {
+    text, err := w.couchbaseService.GetVersionText(doc.ID, number)
+    if err == nil {
+        return text, nil
+    }
+    if !errors.Is(err, services.ErrVersionTextNotFound) {
+        return nil, err
+    }
+    if number == services.CurrentVersion(doc) && doc.Status == "parsed" {
+        return services.NewVersionText(doc), nil
+    }
+
+    version := services.FindVersion(doc, number)
+    if version == nil {
+        return nil, fmt.Errorf("document has no version %d", number)
+    }
+    fileData, err := w.gcsService.DownloadFile(ctx, version.GCSPath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to download file: %v", err)
+    }
+    result, err := w.parserService.ParseDocument(fileData, doc.FileName, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse document: %v", err)
+    }
+
+    text = &models.VersionText{
+        ID:            services.VersionTextID(doc.ID, number),
+        DocumentID:    doc.ID,
+        Version:       number,
+        ParsedText:    result.Text,
+        Keywords:      make([]string, len(result.Keywords)),
+        ErrorMessages: result.ErrorMessages,
+        ParserVersion: services.ParserVersion,
+        ParsedAt:      time.Now(),
+    }
+    for i, keyword := range result.Keywords {
+        text.Keywords[i] = keyword.Keyword
+    }
+    if err := w.couchbaseService.SaveVersionText(text); err != nil {
+        log.Printf("Failed to save version text of %s: %v", doc.ID, err)
+    }
+    return text, nil
+}
+
+// AddVersion queues a document whose file was replaced by a new version,
+// with the priority of an upload. Like AddJob, a failure is left to the
+// sweep.
+func (w *ParserWorker) AddVersion(doc *models.Document) error {
+    return w.reparse(doc, services.PriorityUpload)
+}
+
+// Reparse queues an already parsed document to be parsed again with the
+// current parser. Its existing text stays searchable until the new parse
+// succeeds.
+func (w *ParserWorker) Reparse(doc *models.Document) error {
+    return w.reparse(doc, services.PriorityReparse)
+}
+
+func (w *ParserWorker) reparse(doc *models.Document, priority int) error {
+    // A dead-lettered job would swallow the enqueue, so revive it instead
+    if job, err := w.couchbaseService.GetParseJob(doc.ID); err == nil && job.Status == "failed" {
+        return w.reviveJob(doc.ID)
+    }
+    return w.enqueue(doc.ID, priority)
+}
+
+func (w *ParserWorker) enqueue(documentID string, priority int) error {
+    if err := w.couchbaseService.EnqueueParseJob(documentID, priority); err != nil {
+        return err
+    }
+    w.backlog.Add(1)
+    w.signal()
+    return nil
+}
+
+// signal wakes an idle worker, if there is one.
+func (w *ParserWorker) signal() {
+    select {
+    case w.wake <- struct{}{}:
+    default:
+    }
+}
+
+// Backlog returns the last known number of queued and in-flight jobs across
+// all instances.
+func (w *ParserWorker) Backlog() int {
+    return int(w.backlog.Load())
 }
 
-func (w *ParserWorker) AddJob(doc *models.Document) {
-    w.jobQueue <- ParseJob{Document: doc}
+// Saturated reports whether the backlog has reached the configured limit, in
+// which case new uploads should be turned away until it drains.
+func (w *ParserWorker) Saturated() bool {
+    return w.backlogLimit > 0 && w.Backlog() >= w.backlogLimit
+}
+
+// Fits reports whether n more jobs keep the backlog within the configured
+// limit, and whether they could ever fit once it has drained.
+func (w *ParserWorker) Fits(n int) (now, ever bool) {
+    if w.backlogLimit <= 0 {
+        return true, true
+    }
+    return w.Backlog()+n <= w.backlogLimit, n <= w.backlogLimit
+}
+
+func (w *ParserWorker) monitor() {
+    backlogTicker := time.NewTicker(backlogRefreshInterval)
+    defer backlogTicker.Stop()
+    sweepTicker := time.NewTicker(sweepInterval)
+    defer sweepTicker.Stop()
+
+    for {
+        select {
+        case <-backlogTicker.C:
+            w.refreshBacklog()
+        case <-sweepTicker.C:
+            w.sweep()
+        }
+    }
+}
+
+func (w *ParserWorker) refreshBacklog() {
+    count, err := w.couchbaseService.CountPendingParseJobs()
+    if err != nil {
+        log.Printf("Failed to refresh parse backlog: %v", err)
+        return
+    }
+    w.backlog.Store(int64(count))
+}
+
+func (w *ParserWorker) sweep() {
+    requeued, err := w.couchbaseService.RequeueAbandonedDocuments()
+    if err != nil {
+        log.Printf("Warning: failed to requeue abandoned documents: %v", err)
+    } else if requeued > 0 {
+        log.Printf("Requeued %d abandoned documents", requeued)
+    }
 }
 
 func (w *ParserWorker) processJobs(workerID int) {
-    for job := range w.jobQueue {
-        log.Printf("Worker %d: Processing document %s", workerID, job.Document.ID)
-        
-        err := w.processDocument(job.Document)
+    owner := fmt.Sprintf("%s-%d", w.instanceID, workerID)
+
+    for {
+        job, err := w.couchbaseService.ClaimParseJob(owner, leaseDuration)
         if err != nil {
-            log.Printf("Worker %d: Error processing %s: %v", workerID, job.Document.ID, err)
+            log.Printf("Worker %d: Failed to claim job: %v", workerID, err)
+        }
+        if job == nil {
+            select {
+            case <-w.wake:
+            case <-time.After(pollInterval):
+            }
+            continue
+        }
+
+        log.Printf("Worker %d: Processing document %s", workerID, job.DocumentID)
+
+        err = w.runJob(job, owner)
+        if err != nil {
+            log.Printf("Worker %d: Error processing %s: %v", workerID, job.DocumentID, err)
         } else {
-            log.Printf("Worker %d: Successfully processed %s", workerID, job.Document.ID)
+            log.Printf("Worker %d: Successfully processed %s", workerID, job.DocumentID)
         }
     }
 }
 
-func (w *ParserWorker) processDocument(doc *models.Document) error {
-    ctx := context.Background()
+// RetryJob revives a dead-lettered document with a fresh attempt budget. A
+// parsed document whose reparse was dead-lettered keeps its status, so that
+// failing again leaves it parsed.
+func (w *ParserWorker) RetryJob(doc *models.Document) error {
+    if err := w.reviveJob(doc.ID); err != nil {
+        return err
+    }
+    if doc.Status == "parsed" {
+        return nil
+    }
 
-    // Update status to parsing
-    doc.Status = "parsing"
-    doc.UpdatedAt = time.Now()
-    if err := w.couchbaseService.SaveDocument(doc); err != nil {
-        return fmt.Errorf("failed to update status: %v", err)
+    stored, err := w.couchbaseService.UpdateDocument(doc.ID, func(doc *models.Document) {
+        if doc.Status == "parsed" {
+            return
+        }
+        doc.Status = "uploaded"
+        doc.ParseError = ""
+        doc.UpdatedAt = time.Now()
+    })
+    if err != nil {
+        return err
+    }
+    *doc = *stored
+    return nil
+}
+
+// reviveJob replaces a document's dead-lettered job with a queued one and
+// wakes a worker for it.
+func (w *ParserWorker) reviveJob(documentID string) error {
+    if err := w.couchbaseService.RetryParseJob(documentID); err != nil {
+        return err
+    }
+    w.backlog.Add(1)
+    w.signal()
+    return nil
+}
+
+// runJob processes a claimed job while keeping its lease alive. Successful
+// jobs are removed from the queue; failed ones are rescheduled or
+// dead-lettered by failJob.
+func (w *ParserWorker) runJob(job *models.ParseJob, owner string) error {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    go w.heartbeat(ctx, cancel, job, owner)
+
+    reporter := w.newStageReporter(job, owner)
+
+    doc, err := w.couchbaseService.GetDocument(job.DocumentID)
+    if err != nil {
+        return w.failJob(job, owner, reporter, nil, false, err)
+    }
+    // A reparse that fails leaves a parsed document as it was.
+    // processDocument never moves a parsed document to "parsing", so this
+    // holds on every attempt, including after a crash or a lost lease
+    parsed := doc.Status == "parsed"
+
+    // A job whose lease keeps expiring (e.g. the process crashes on this
+    // file) never reaches failJob, so enforce the budget on claim as well
+    if job.Attempts > maxParseAttempts {
+        err := fmt.Errorf("abandoned after %d attempts", job.Attempts-1)
+        return w.failJob(job, owner, reporter, doc, parsed, &permanentError{err})
+    }
+
+    if err := w.processDocument(ctx, doc, reporter.report); err != nil {
+        if ctx.Err() != nil {
+            // Another worker owns the job now and records the outcome
+            return fmt.Errorf("lease lost: %v", err)
+        }
+        return w.failJob(job, owner, reporter, doc, parsed, err)
+    }
+
+    if err := w.couchbaseService.CompleteParseJob(job.ID, owner); err != nil {
+        if errors.Is(err, services.ErrLeaseLost) {
+            log.Printf("Lease on job %s was lost before completion", job.ID)
+        } else {
+            log.Printf("Failed to complete job %s: %v", job.ID, err)
+        }
+    }
+    reporter.finish(doc, nil, nil)
+
+    return nil
+}
+
+// failJob records a failed attempt. Transient failures are retried with
+// exponential backoff until maxParseAttempts; after that, or on a permanent
+// failure, the document moves to the "failed" dead-letter state. A document
+// that was parsed before the job keeps its status: a failed reparse is
+// recorded on the job only.
+func (w *ParserWorker) failJob(job *models.ParseJob, owner string, reporter *stageReporter, doc *models.Document, parsed bool, cause error) error {
+    var retryAt *time.Time
+    var permanent *permanentError
+    if !errors.As(cause, &permanent) && job.Attempts < maxParseAttempts {
+        next := time.Now().UTC().Add(retryBackoff(job.Attempts))
+        retryAt = &next
+    }
+
+    if doc != nil && parsed {
+        // Its parsed text still belongs to its current version
+        stored, err := w.couchbaseService.UpdateDocument(doc.ID, func(doc *models.Document) {
+            doc.Status = "parsed"
+        })
+        if err != nil {
+            log.Printf("Failed to restore status of %s: %v", doc.ID, err)
+        } else {
+            doc = stored
+        }
+    } else if doc != nil {
+        doc.Status = "failed"
+        if retryAt != nil {
+            doc.Status = "uploaded"
+        }
+        doc.ParseError = cause.Error()
+        doc.UpdatedAt = time.Now()
+        if err := w.couchbaseService.SaveDocument(doc); err != nil {
+            log.Printf("Failed to record parse error on %s: %v", doc.ID, err)
+        } else {
+            w.indexDocument(doc)
+        }
+    }
+
+    if err := w.couchbaseService.ReleaseParseJob(job.ID, owner, cause.Error(), retryAt); err != nil {
+        log.Printf("Failed to release job %s: %v", job.ID, err)
+    }
+    reporter.finish(doc, cause, retryAt)
+
+    if retryAt != nil {
+        return fmt.Errorf("attempt %d failed, retrying at %s: %v", job.Attempts, retryAt.Format(time.RFC3339), cause)
+    }
+    return fmt.Errorf("attempt %d failed, giving up: %v", job.Attempts, cause)
+}
+
+// retryBackoff returns the delay before the next attempt, doubling per
+// attempt with up to 20% jitter so failed batches don't retry in lockstep.
+func retryBackoff(attempt int) time.Duration {
+    delay := retryMaxDelay
+    if attempt < 16 {
+        delay = retryBaseDelay << (attempt - 1)
+        if delay > retryMaxDelay {
+            delay = retryMaxDelay
+        }
+    }
+    return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// heartbeat extends the lease on job until ctx is done. If the lease is lost
+// to another worker it calls cancel, so that processing stops before this
+// worker writes over the new owner's results.
+func (w *ParserWorker) heartbeat(ctx context.Context, cancel context.CancelFunc, job *models.ParseJob, owner string) {
+    ticker := time.NewTicker(heartbeatInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            err := w.couchbaseService.HeartbeatParseJob(job.ID, owner, leaseDuration)
+            if errors.Is(err, services.ErrLeaseLost) {
+                log.Printf("Lease on job %s was lost", job.ID)
+                cancel()
+                return
+            }
+            if err != nil {
+                log.Printf("Failed to heartbeat job %s: %v", job.ID, err)
+            }
+        }
+    }
+}
+
+func (w *ParserWorker) processDocument(ctx context.Context, doc *models.Document, progress services.ProgressFunc) error {
+    // A reparsed document stays "parsed" and searchable under its status
+    // until the new text replaces it, also if this attempt dies halfway
+    if doc.Status != "parsed" {
+        doc.Status = "parsing"
+        doc.UpdatedAt = time.Now()
+        if err := w.couchbaseService.SaveDocument(doc); err != nil {
+            return fmt.Errorf("failed to update status: %v", err)
+        }
     }
 
     // Download file from GCS
+    progress("downloading", 0, 0, "")
     fileData, err := w.gcsService.DownloadFile(ctx, doc.GCSPath)
     if err != nil {
-        doc.Status = "error"
-        doc.UpdatedAt = time.Now()
-        w.couchbaseService.SaveDocument(doc)
         return fmt.Errorf("failed to download file: %v", err)
     }
 
-    // Parse document
-    parsedText, keywords, errors, err := w.parserService.ParseDocument(fileData, doc.FileName)
+    // Parse document; the same bytes will fail the same way next time
+    result, err := w.parserService.ParseDocument(fileData, doc.FileName, progress)
     if err != nil {
-        doc.Status = "error"
-        doc.UpdatedAt = time.Now()
-        w.couchbaseService.SaveDocument(doc)
-        return fmt.Errorf("failed to parse document: %v", err)
+        return &permanentError{fmt.Errorf("failed to parse document: %v", err)}
+    }
+
+    // Nothing is written once the lease is gone
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    // Store passages before the document so a parsed document always has them
+    progress("chunking", 0, 0, "")
+    chunks := services.ChunkSections(doc.ID, result.Sections)
+    if err := w.couchbaseService.ReplaceDocumentChunks(doc.ID, chunks); err != nil {
+        return fmt.Errorf("failed to save chunks: %v", err)
     }
 
     // Update document with parsed data
     now := time.Now()
-    doc.ParsedText = parsedText
-    doc.Keywords = keywords
-    doc.ErrorMessages = errors
+    doc.ParsedText = result.Text
+    doc.Keywords = make([]string, len(result.Keywords))
+    for i, keyword := range result.Keywords {
+        doc.Keywords[i] = keyword.Keyword
+    }
+    doc.KeywordScores = result.Keywords
+    doc.ErrorMessages = result.ErrorMessages
+    doc.Errors = result.Errors
+    doc.KnownIssues = w.issues.Link(doc)
+    doc.ChunkCount = len(chunks)
     doc.Status = "parsed"
+    doc.ParseError = ""
+    doc.ParserVersion = services.ParserVersion
     doc.ParsedAt = &now
     doc.UpdatedAt = now
 
     // Save to Couchbase
+    progress("saving", 0, 0, "")
+    if err := ctx.Err(); err != nil {
+        return err
+    }
     if err := w.couchbaseService.SaveDocument(doc); err != nil {
         return fmt.Errorf("failed to save parsed document: %v", err)
     }
 
+    // Keep this version's text for comparing it with later versions
+    if err := w.couchbaseService.SaveVersionText(services.NewVersionText(doc)); err != nil {
+        log.Printf("Failed to save version text of %s: %v", doc.ID, err)
+    }
+
+    // The document is parsed either way; a rebuild picks up index failures
+    w.indexDocument(doc)
+
     return nil
 }
+
+// indexDocument brings the search index, suggestions and keyword corpus up
+// to date with a saved document.
+func (w *ParserWorker) indexDocument(doc *models.Document) {
+    if err := w.searchBackend.Index(doc); err != nil {
+        log.Printf("Failed to index %s for search: %v", doc.ID, err)
+    }
+    w.suggester.Add(doc)
+    w.corpus.Add(doc)
+}
+
+// DocumentDeleted drops a deleted document from the search index,
+// suggestions and keyword corpus.
+func (w *ParserWorker) DocumentDeleted(documentID string) {
+    if err := w.searchBackend.Remove(documentID); err != nil {
+        log.Printf("Failed to remove %s from search index: %v", documentID, err)
+    }
+    w.suggester.Remove(documentID)
+    w.corpus.Remove(documentID)
+}
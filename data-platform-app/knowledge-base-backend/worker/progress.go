@@ -0,0 +1,219 @@
+package worker
+
+import (
+    "errors"
+    "log"
+    "sync"
+    "time"
+
+    "knowledge-base-backend/models"
+    "knowledge-base-backend/services"
+)
+
+// stagePersistInterval throttles how often page/sheet progress is written to
+// the job document. Stage changes are always written.
+const stagePersistInterval = 2 * time.Second
+
+// progressTracker holds the live progress of jobs running on this instance
+// and fans updates out to subscribers such as SSE streams.
+type progressTracker struct {
+    mu          sync.Mutex
+    current     map[string]models.ParseProgress
+    subscribers map[string]map[chan models.ParseProgress]struct{}
+}
+
+func newProgressTracker() *progressTracker {
+    return &progressTracker{
+        current:     make(map[string]models.ParseProgress),
+        subscribers: make(map[string]map[chan models.ParseProgress]struct{}),
+    }
+}
+
+func (t *progressTracker) publish(p models.ParseProgress) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    if p.Final() || p.Stage == "queued" {
+        delete(t.current, p.DocumentID)
+    } else {
+        t.current[p.DocumentID] = p
+    }
+
+    for ch := range t.subscribers[p.DocumentID] {
+        // Drop the update for slow subscribers; they resync from the next one
+        select {
+        case ch <- p:
+        default:
+        }
+    }
+}
+
+func (t *progressTracker) get(documentID string) (models.ParseProgress, bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    p, ok := t.current[documentID]
+    return p, ok
+}
+
+func (t *progressTracker) subscribe(documentID string) (<-chan models.ParseProgress, func()) {
+    ch := make(chan models.ParseProgress, 16)
+
+    t.mu.Lock()
+    if t.subscribers[documentID] == nil {
+        t.subscribers[documentID] = make(map[chan models.ParseProgress]struct{})
+    }
+    t.subscribers[documentID][ch] = struct{}{}
+    t.mu.Unlock()
+
+    return ch, func() {
+        t.mu.Lock()
+        defer t.mu.Unlock()
+
+        delete(t.subscribers[documentID], ch)
+        if len(t.subscribers[documentID]) == 0 {
+            delete(t.subscribers, documentID)
+        }
+    }
+}
+
+// Subscribe streams progress updates for a document processed by this
+// instance. Callers must invoke the returned function when done.
+func (w *ParserWorker) Subscribe(documentID string) (<-chan models.ParseProgress, func()) {
+    return w.progress.subscribe(documentID)
+}
+
+// Status builds the current progress of a document from the live tracker
+// when this instance is parsing it, and from the document and its job
+// otherwise.
+func (w *ParserWorker) Status(documentID string) (*models.ParseProgress, error) {
+    if p, ok := w.progress.get(documentID); ok {
+        return &p, nil
+    }
+
+    doc, err := w.couchbaseService.GetDocument(documentID)
+    if err != nil {
+        return nil, err
+    }
+
+    status := &models.ParseProgress{
+        DocumentID: doc.ID,
+        Status:     doc.Status,
+        Error:      doc.ParseError,
+        UpdatedAt:  doc.UpdatedAt,
+    }
+
+    job, err := w.couchbaseService.GetParseJob(documentID)
+    if err != nil {
+        // No pending job: the document has been through the pipeline
+        switch doc.Status {
+        case "parsed":
+            status.Stage = "done"
+        case "failed", "error":
+            status.Stage = "failed"
+        default:
+            status.Stage = "queued"
+        }
+        return status, nil
+    }
+
+    status.Attempts = job.Attempts
+    status.NextRetryAt = job.NextRetryAt
+    if job.LastError != "" {
+        status.Error = job.LastError
+    }
+
+    switch job.Status {
+    case "leased":
+        status.Stage = job.Stage
+        status.Progress = job.Progress
+        status.UpdatedAt = job.UpdatedAt
+    case "failed":
+        status.Stage = "failed"
+    default:
+        status.Stage = "queued"
+        if job.NextRetryAt == nil || !job.NextRetryAt.After(time.Now()) {
+            position, err := w.couchbaseService.ParseQueuePosition(job)
+            if err == nil {
+                status.QueuePosition = position
+            }
+        }
+    }
+
+    return status, nil
+}
+
+// QueueStats summarizes the shared parse queue.
+func (w *ParserWorker) QueueStats() (*models.QueueStats, error) {
+    return w.couchbaseService.ParseQueueStats()
+}
+
+// stageReporter publishes progress for one attempt at a job and mirrors it
+// onto the job document, throttled to stagePersistInterval.
+type stageReporter struct {
+    worker      *ParserWorker
+    job         *models.ParseJob
+    owner       string
+    stage       string
+    lastPersist time.Time
+}
+
+func (w *ParserWorker) newStageReporter(job *models.ParseJob, owner string) *stageReporter {
+    return &stageReporter{worker: w, job: job, owner: owner}
+}
+
+func (r *stageReporter) report(stage string, current, total int, unit string) {
+    var progress *models.StageProgress
+    if total > 0 {
+        progress = &models.StageProgress{Current: current, Total: total, Unit: unit}
+    }
+
+    r.worker.progress.publish(models.ParseProgress{
+        DocumentID: r.job.DocumentID,
+        Status:     "parsing",
+        Stage:      stage,
+        Progress:   progress,
+        Attempts:   r.job.Attempts,
+        UpdatedAt:  time.Now(),
+    })
+
+    if stage == r.stage && time.Since(r.lastPersist) < stagePersistInterval && current != total {
+        return
+    }
+    r.stage = stage
+    r.lastPersist = time.Now()
+
+    err := r.worker.couchbaseService.SetParseJobStage(r.job.ID, r.owner, stage, progress)
+    if err != nil && !errors.Is(err, services.ErrLeaseLost) {
+        log.Printf("Failed to record stage of job %s: %v", r.job.ID, err)
+    }
+}
+
+// finish publishes the outcome of an attempt to local subscribers; cause is
+// nil when it succeeded.
+func (r *stageReporter) finish(doc *models.Document, cause error, retryAt *time.Time) {
+    p := models.ParseProgress{
+        DocumentID:  r.job.DocumentID,
+        Attempts:    r.job.Attempts,
+        NextRetryAt: retryAt,
+        UpdatedAt:   time.Now(),
+    }
+    if doc != nil {
+        p.Status = doc.Status
+        p.Error = doc.ParseError
+    }
+    if cause != nil {
+        p.Error = cause.Error()
+    }
+
+    switch {
+    case cause == nil && p.Status == "parsed":
+        p.Stage = "done"
+    case retryAt != nil:
+        p.Stage = "queued"
+    default:
+        p.Stage = "failed"
+    }
+
+    r.worker.progress.publish(p)
+}
@@ -0,0 +1,137 @@
+package worker
+
+import (
+    "fmt"
+    "log"
+    "sync"
+    "time"
+
+    "github.com/google/uuid"
+    "knowledge-base-backend/models"
+    "knowledge-base-backend/services"
+)
+
+const (
+    defaultReparseRate = 60  // documents per minute
+    maxReparseRate     = 600 // documents per minute
+)
+
+// reparseRuns keeps the bulk reparses started on this instance. Runs are not
+// persisted: documents already enqueued survive a restart, the rest of an
+// interrupted run has to be started again.
+type reparseRuns struct {
+    mu   sync.Mutex
+    runs map[string]*models.ReparseRun
+}
+
+func newReparseRuns() *reparseRuns {
+    return &reparseRuns{runs: make(map[string]*models.ReparseRun)}
+}
+
+func (r *reparseRuns) update(id string, mutate func(run *models.ReparseRun)) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if run, ok := r.runs[id]; ok {
+        mutate(run)
+    }
+}
+
+func (r *reparseRuns) get(id string) (models.ReparseRun, bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    run, ok := r.runs[id]
+    if !ok {
+        return models.ReparseRun{}, false
+    }
+    return *run, true
+}
+
+// BulkReparse selects documents matching filter and feeds them to the queue
+// in the background at the requested rate. Jobs are enqueued at the lowest
+// priority, and feeding pauses while the backlog is above half its limit, so
+// a large run never pushes new uploads into 429s.
+func (w *ParserWorker) BulkReparse(filter models.ReparseRequest) (*models.ReparseRun, error) {
+    if filter.RatePerMinute <= 0 {
+        filter.RatePerMinute = defaultReparseRate
+    }
+    if filter.RatePerMinute > maxReparseRate {
+        filter.RatePerMinute = maxReparseRate
+    }
+
+    ids, err := w.couchbaseService.ListDocumentIDsForReparse(&filter)
+    if err != nil {
+        return nil, err
+    }
+
+    run := &models.ReparseRun{
+        ID:        uuid.New().String(),
+        Filter:    filter,
+        Matched:   len(ids),
+        Status:    "running",
+        StartedAt: time.Now(),
+    }
+
+    w.reparses.mu.Lock()
+    w.reparses.runs[run.ID] = run
+    snapshot := *run
+    w.reparses.mu.Unlock()
+
+    go w.feedReparse(run.ID, ids, time.Minute/time.Duration(filter.RatePerMinute))
+
+    return &snapshot, nil
+}
+
+// ReparseRun returns the progress of a bulk reparse started on this instance.
+func (w *ParserWorker) ReparseRun(id string) (*models.ReparseRun, bool) {
+    run, ok := w.reparses.get(id)
+    if !ok {
+        return nil, false
+    }
+    return &run, true
+}
+
+func (w *ParserWorker) feedReparse(runID string, ids []string, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    var failure error
+    for _, id := range ids {
+        <-ticker.C
+
+        for w.backlogLimit > 0 && w.Backlog() >= w.backlogLimit/2 {
+            time.Sleep(pollInterval)
+        }
+
+        doc, err := w.couchbaseService.GetDocument(id)
+        if err != nil {
+            // Deleted since the run started
+            continue
+        }
+        if err := w.reparse(doc, services.PriorityBulkReparse); err != nil {
+            failure = fmt.Errorf("failed to enqueue %s: %v", id, err)
+            break
+        }
+
+        w.reparses.update(runID, func(run *models.ReparseRun) {
+            run.Enqueued++
+        })
+    }
+
+    now := time.Now()
+    w.reparses.update(runID, func(run *models.ReparseRun) {
+        run.Status = "completed"
+        if failure != nil {
+            run.Status = "failed"
+            run.Error = failure.Error()
+        }
+        run.FinishedAt = &now
+    })
+
+    if failure != nil {
+        log.Printf("Bulk reparse %s stopped: %v", runID, failure)
+    } else {
+        log.Printf("Bulk reparse %s finished", runID)
+    }
+}